@@ -0,0 +1,100 @@
+package finto
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ClientACL restricts the clients a role's credentials are served to, by IP
+// address. Denied networks take precedence over allowed ones, and when any are
+// allowed, clients outside them are denied.
+type ClientACL struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// Returns a ClientACL from lists of IP addresses and CIDR blocks, e.g.
+// "127.0.0.1" or "10.0.0.0/8".
+func ParseClientACL(allow, deny []string) (*ClientACL, error) {
+	var (
+		acl ClientACL
+		err error
+	)
+
+	if acl.allow, err = parseNets(allow); err != nil {
+		return nil, err
+	}
+
+	if acl.deny, err = parseNets(deny); err != nil {
+		return nil, err
+	}
+
+	return &acl, nil
+}
+
+func parseNets(addrs []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+
+	for _, a := range addrs {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid client address: %q", a)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client network: %q", a)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// Returns whether the client at ip may be served. A nil ClientACL permits
+// every client, while a nil ip is only permitted by a nil ClientACL.
+func (a *ClientACL) Permits(ip net.IP) bool {
+	if a == nil {
+		return true
+	}
+
+	if ip == nil || containsIP(a.deny, ip) {
+		return false
+	}
+
+	return len(a.allow) == 0 || containsIP(a.allow, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the IP address a request was made from, or nil if it can't be
+// determined.
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return net.ParseIP(host)
+}
@@ -0,0 +1,59 @@
+package finto
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientACL(t *testing.T) {
+	acl, err := ParseClientACL([]string{"127.0.0.1", "10.0.0.0/8", "::1"}, []string{"10.0.0.66"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		ip      string
+		permits bool
+	}{
+		{"127.0.0.1", true},
+		{"127.0.0.2", false},
+		{"10.1.2.3", true},
+		{"10.0.0.66", false},
+		{"::1", true},
+		{"::2", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.permits, acl.Permits(net.ParseIP(c.ip)), c.ip)
+	}
+
+	assert.False(t, acl.Permits(nil))
+
+	// Without an allow list, only denied clients are refused.
+	acl, _ = ParseClientACL(nil, []string{"192.168.0.0/16"})
+	assert.True(t, acl.Permits(net.ParseIP("127.0.0.1")))
+	assert.False(t, acl.Permits(net.ParseIP("192.168.1.1")))
+
+	var none *ClientACL
+	assert.True(t, none.Permits(nil))
+
+	_, err = ParseClientACL([]string{"localhost"}, nil)
+	assert.Error(t, err)
+
+	_, err = ParseClientACL(nil, []string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	r := &http.Request{RemoteAddr: "127.0.0.1:54321"}
+	assert.Equal(t, "127.0.0.1", clientIP(r).String())
+
+	r.RemoteAddr = "[::1]:54321"
+	assert.Equal(t, "::1", clientIP(r).String())
+
+	r.RemoteAddr = ""
+	assert.Nil(t, clientIP(r))
+}
@@ -0,0 +1,102 @@
+package finto
+
+import (
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The components of an Amazon Resource Name, which takes the form
+// arn:partition:service:region:account-id:resource.
+type arnParts struct {
+	Partition string
+	Service   string
+	Region    string
+	AccountId string
+	Resource  string
+}
+
+func parseArn(arn string) (arnParts, error) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return arnParts{}, fmt.Errorf("malformed arn: %s", arn)
+	}
+
+	return arnParts{
+		Partition: parts[1],
+		Service:   parts[2],
+		Region:    parts[3],
+		AccountId: parts[4],
+		Resource:  parts[5],
+	}, nil
+}
+
+// Account IDs are 12 digits.
+var accountIdPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// Returns an error if arn isn't the ARN of an IAM role, e.g.
+// arn:aws:iam::123456789012:role/example.
+func ValidateRoleArn(arn string) error {
+	parts, err := parseArn(arn)
+	if err != nil {
+		return err
+	}
+
+	if parts.Service != "iam" || !strings.HasPrefix(parts.Resource, "role/") || len(parts.Resource) == len("role/") {
+		return fmt.Errorf("not a role arn: %s", arn)
+	}
+
+	if !accountIdPattern.MatchString(parts.AccountId) {
+		return fmt.Errorf("invalid account id in arn: %s", arn)
+	}
+
+	return nil
+}
+
+// Returns the account ID embedded in arn, or an empty string if arn is
+// malformed.
+func accountFromArn(arn string) string {
+	parts, err := parseArn(arn)
+	if err != nil {
+		return ""
+	}
+
+	return parts.AccountId
+}
+
+// Returns the partition embedded in arn, e.g. aws, aws-cn, or aws-us-gov, or an
+// empty string if arn is malformed. ARNs synthesized from a role's ARN must
+// share its partition.
+func partitionFromArn(arn string) string {
+	parts, err := parseArn(arn)
+	if err != nil {
+		return ""
+	}
+
+	return parts.Partition
+}
+
+// Returns the ARN and ID of the instance profile of the role arn, in the
+// role's partition and account. The profile is named name, or after the role if
+// name is empty. The ID is derived from arn, so it is stable.
+func instanceProfileFromArn(arn, name string) (string, string, error) {
+	parts, err := parseArn(arn)
+	if err != nil {
+		return "", "", err
+	}
+
+	if name == "" {
+		resource := parts.Resource
+		name = resource[strings.LastIndex(resource, "/")+1:]
+	}
+
+	sum := sha1.Sum([]byte(arn))
+	id := "AIPA" + base32.StdEncoding.EncodeToString(sum[:])[:17]
+
+	profile := fmt.Sprintf("arn:%s:iam::%s:instance-profile/%s",
+		partitionFromArn(arn), parts.AccountId, name)
+
+	return profile, id, nil
+}
@@ -0,0 +1,82 @@
+package finto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArn(t *testing.T) {
+	parts, err := parseArn("arn:aws:iam::123456789012:role/path/example")
+	if assert.NoError(t, err) {
+		assert.Equal(t, arnParts{
+			Partition: "aws",
+			Service:   "iam",
+			AccountId: "123456789012",
+			Resource:  "role/path/example",
+		}, parts)
+	}
+
+	for _, arn := range []string{"", "test-arn", "arn:aws:iam", "nra:aws:iam::123456789012:role/x"} {
+		_, err := parseArn(arn)
+		assert.Error(t, err, arn)
+	}
+}
+
+func TestValidateRoleArn(t *testing.T) {
+	assert.NoError(t, ValidateRoleArn("arn:aws:iam::123456789012:role/path/example"))
+	assert.NoError(t, ValidateRoleArn("arn:aws-cn:iam::123456789012:role/example"))
+
+	for _, arn := range []string{
+		"test-arn",
+		"arn:aws:iam::123456789012:user/example",
+		"arn:aws:sts::123456789012:role/example",
+		"arn:aws:iam::123456789012:role/",
+		"arn:aws:iam::12345:role/example",
+	} {
+		assert.Error(t, ValidateRoleArn(arn), arn)
+	}
+}
+
+func TestAccountFromArn(t *testing.T) {
+	assert.Equal(t, "123456789012", accountFromArn("arn:aws:iam::123456789012:role/example"))
+	assert.Equal(t, "", accountFromArn("test-arn"))
+}
+
+func TestPartitionFromArn(t *testing.T) {
+	assert.Equal(t, "aws", partitionFromArn("arn:aws:iam::123456789012:role/example"))
+	assert.Equal(t, "aws-cn", partitionFromArn("arn:aws-cn:iam::123456789012:role/example"))
+	assert.Equal(t, "aws-us-gov", partitionFromArn("arn:aws-us-gov:iam::123456789012:role/example"))
+	assert.Equal(t, "", partitionFromArn("test-arn"))
+}
+
+func TestInstanceProfileFromArn(t *testing.T) {
+	arn, id, err := instanceProfileFromArn("arn:aws:iam::123456789012:role/path/example", "")
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "arn:aws:iam::123456789012:instance-profile/example", arn)
+		assert.Regexp(t, `^AIPA[A-Z2-7]{17}$`, id)
+	}
+
+	_, again, _ := instanceProfileFromArn("arn:aws:iam::123456789012:role/path/example", "")
+	_, other, _ := instanceProfileFromArn("arn:aws:iam::123456789012:role/other", "")
+
+	assert.Equal(t, id, again)
+	assert.NotEqual(t, id, other)
+
+	for _, partition := range []string{"aws", "aws-cn", "aws-us-gov"} {
+		arn, _, err := instanceProfileFromArn("arn:"+partition+":iam::123456789012:role/example", "")
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, "arn:"+partition+":iam::123456789012:instance-profile/example", arn)
+		}
+	}
+
+	arn, _, err = instanceProfileFromArn("arn:aws:iam::123456789012:role/path/example", "named")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "arn:aws:iam::123456789012:instance-profile/named", arn)
+	}
+
+	_, _, err = instanceProfileFromArn("test-arn", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,216 @@
+package finto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// The length of a cache key: AES-256.
+const CacheKeySize = 32
+
+// Decodes a cache key from base64, e.g. as generated by
+// `head -c 32 /dev/urandom | base64`.
+func ParseCacheKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cache key: %s", err)
+	}
+
+	if len(key) != CacheKeySize {
+		return nil, fmt.Errorf("invalid cache key: must be %d bytes, not %d", CacheKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// CredentialCache keeps roles' credentials in a file, encrypted with AES-GCM,
+// so that a restart serves them until they expire rather than assuming each
+// role again. Credentials are recorded as they're refreshed, by its Hook.
+type CredentialCache struct {
+	file string
+	aead cipher.AEAD
+
+	entries map[string]cachedCredentials // Credentials by alias
+	m       sync.Mutex                   // Held while entries are changed or written
+}
+
+// Credentials as kept in the cache. The ARN they were assumed for is kept so
+// that a role since pointed at another isn't served the old one's.
+type cachedCredentials struct {
+	Arn             string    `json:"arn"`
+	AccessKeyId     string    `json:"access_key_id"`
+	SecretAccessKey string    `json:"secret_access_key"`
+	SessionToken    string    `json:"session_token"`
+	Expiration      time.Time `json:"expiration"`
+	LastUpdated     time.Time `json:"last_updated"`
+}
+
+// Returns a cache kept in file, encrypted with key, which must be
+// CacheKeySize bytes. Nothing is read until Load.
+func NewCredentialCache(file string, key []byte) (*CredentialCache, error) {
+	if len(key) != CacheKeySize {
+		return nil, fmt.Errorf("invalid cache key: must be %d bytes, not %d", CacheKeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialCache{
+		file:    file,
+		aead:    aead,
+		entries: make(map[string]cachedCredentials),
+	}, nil
+}
+
+// Reads the cache file. Expired credentials are left for Restore to pass over
+// and the next write to drop, as only a role set's clock tells them apart. A
+// missing file is an empty cache. A file that is corrupt, or was encrypted with
+// another key, returns an error and leaves the cache empty, to be overwritten
+// by the next refresh.
+func (c *CredentialCache) Load() error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	b, err := ioutil.ReadFile(c.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	plain, err := c.open(b)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %s: %s", c.file, err)
+	}
+
+	var entries map[string]cachedCredentials
+	if err := json.Unmarshal(plain, &entries); err != nil {
+		return fmt.Errorf("failed to decode %s: %s", c.file, err)
+	}
+
+	for alias, e := range entries {
+		c.entries[alias] = e
+	}
+
+	return nil
+}
+
+// Serves cached credentials from the set's roles that have none of their own
+// yet, for those whose ARN is unchanged and that haven't expired by the set's
+// clock. Returns the aliases of the roles given credentials.
+func (c *CredentialCache) Restore(rs *RoleSet) []string {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var restored []string
+
+	for alias, e := range c.entries {
+		role, err := rs.Role(alias)
+		if err != nil || role.Arn() != e.Arn {
+			continue
+		}
+
+		creds := Credentials{
+			AccessKeyId:     e.AccessKeyId,
+			SecretAccessKey: e.SecretAccessKey,
+			SessionToken:    e.SessionToken,
+			Expiration:      e.Expiration,
+			LastUpdated:     e.LastUpdated,
+		}
+
+		if role.restoreCredentials(creds) {
+			restored = append(restored, alias)
+		}
+	}
+
+	return restored
+}
+
+// Returns a RefreshHook that records the set's refreshed credentials. They're
+// written in the background, so the hook never blocks the refresh.
+func (c *CredentialCache) Hook(rs *RoleSet) RefreshHook {
+	return func(alias string, creds Credentials) {
+		go func() {
+			role, err := rs.Role(alias)
+			if err != nil {
+				return
+			}
+
+			if err := c.store(alias, role.Arn(), creds, rs.now()); err != nil {
+				log.Printf("warning: failed to cache credentials of role %s: %s", alias, err)
+			}
+		}()
+	}
+}
+
+// Records a role's credentials and writes the cache, dropping any that have
+// expired by now.
+func (c *CredentialCache) store(alias, arn string, creds Credentials, now time.Time) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.entries[alias] = cachedCredentials{
+		Arn:             arn,
+		AccessKeyId:     creds.AccessKeyId,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.SessionToken,
+		Expiration:      creds.Expiration,
+		LastUpdated:     creds.LastUpdated,
+	}
+
+	for a, e := range c.entries {
+		if !e.Expiration.After(now) {
+			delete(c.entries, a)
+		}
+	}
+
+	plain, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := c.seal(plain)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(c.file, sealed, 0600)
+}
+
+// Encrypts plain, prefixing the result with its random nonce.
+func (c *CredentialCache) seal(plain []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return c.aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// Decrypts what seal encrypted, authenticating it.
+func (c *CredentialCache) open(sealed []byte) ([]byte, error) {
+	n := c.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, errors.New("file is truncated")
+	}
+
+	return c.aead.Open(nil, sealed[:n], sealed[n:], nil)
+}
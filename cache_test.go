@@ -0,0 +1,112 @@
+package finto
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCacheKey(t *testing.T) {
+	key, err := ParseCacheKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("0123456789abcdef0123456789abcdef"), key)
+	}
+
+	for _, s := range []string{"", "not base64!", "c2hvcnQ="} {
+		_, err := ParseCacheKey(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestCredentialCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "finto-cache")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "cache")
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	cache, err := NewCredentialCache(file, key)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Nothing is cached yet.
+	assert.NoError(t, cache.Load())
+
+	fresh := Credentials{
+		AccessKeyId:     "cached-key",
+		SecretAccessKey: "cached-secret",
+		SessionToken:    "cached-token",
+		Expiration:      time.Now().Add(time.Hour),
+		LastUpdated:     time.Now(),
+	}
+	expired := fresh
+	expired.Expiration = time.Now().Add(-time.Minute)
+
+	assert.NoError(t, cache.store("test-alias", testArn, fresh, time.Now()))
+	assert.NoError(t, cache.store("another-alias", anotherArn, fresh, time.Now()))
+	assert.NoError(t, cache.store("expired-alias", testArn, expired, time.Now()))
+
+	// Secrets aren't written in the clear.
+	b, _ := ioutil.ReadFile(file)
+	assert.False(t, bytes.Contains(b, []byte("cached-secret")))
+
+	info, err := os.Stat(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// A restart serves the cached credentials, unless the role has changed.
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("test-alias", testArn)
+	rs.SetRole("another-alias", "arn:aws:iam::123456789012:role/changed")
+	rs.SetRole("expired-alias", testArn)
+
+	restarted, _ := NewCredentialCache(file, key)
+	assert.NoError(t, restarted.Load())
+	assert.Equal(t, []string{"test-alias"}, restarted.Restore(rs))
+
+	role, _ := rs.Role("test-alias")
+	creds, fetched, err := role.credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.False(t, fetched)
+		assert.Equal(t, "cached-key", creds.AccessKeyId)
+	}
+
+	role, _ = rs.Role("another-alias")
+	creds, fetched, _ = role.credentials(context.Background())
+	assert.True(t, fetched)
+	assert.NotEqual(t, "cached-key", creds.AccessKeyId)
+
+	// Files encrypted with another key, or corrupted, are refused.
+	other, _ := NewCredentialCache(file, []byte("fedcba9876543210fedcba9876543210"))
+	assert.Error(t, other.Load())
+	assert.Empty(t, other.Restore(rs))
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("garbage"), 0600))
+	corrupt, _ := NewCredentialCache(file, key)
+	assert.Error(t, corrupt.Load())
+
+	_, err = NewCredentialCache(file, []byte("short"))
+	assert.Error(t, err)
+
+	// Expiration is judged by the set's clock, not the system's.
+	assert.NoError(t, cache.store("expired-alias", testArn, expired, time.Now().Add(-time.Hour)))
+
+	rs = NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetClock(&fakeClock{now: time.Now().Add(-time.Hour)})
+	rs.SetRole("expired-alias", testArn)
+
+	restarted, _ = NewCredentialCache(file, key)
+	assert.NoError(t, restarted.Load())
+	assert.Contains(t, restarted.Restore(rs), "expired-alias")
+}
@@ -0,0 +1,83 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// Checks the identity of the credentials a role is assumed with, so that finto
+// run with the wrong base credentials, e.g. another environment's, refuses to
+// assume the role rather than use whatever privileges they grant.
+type callerCheck struct {
+	pattern string
+	match   *regexp.Regexp
+	client  CallerIdentityClient
+}
+
+// CallerMismatchError is returned in place of a role's credentials when the
+// identity of the credentials it's assumed with doesn't match the pattern it
+// expects.
+type CallerMismatchError struct {
+	Role     string // The role's ARN
+	Caller   string // The ARN of the base credentials' identity
+	Expected string // The pattern the identity was expected to match
+}
+
+func (e *CallerMismatchError) Error() string {
+	return fmt.Sprintf("refusing to assume role %s: base credentials are %s, not %s",
+		e.Role, e.Caller, e.Expected)
+}
+
+// Returns an error if pattern can't match the ARN of a caller identity.
+func ValidateCallerPattern(pattern string) error {
+	if !strings.HasPrefix(pattern, "arn:") {
+		return fmt.Errorf("invalid caller pattern: %q; must be an ARN, optionally with wildcards", pattern)
+	}
+
+	return nil
+}
+
+// Returns a regexp matching what pattern does as an IAM ArnLike condition:
+// * matches any run of characters, and ? any single one.
+func arnLike(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.Replace(quoted, `\*`, `.*`, -1)
+	quoted = strings.Replace(quoted, `\?`, `.`, -1)
+
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+// Checks, before each assumption of the role, that the credentials it's
+// assumed with belong to an identity whose ARN matches pattern, e.g.
+// arn:aws:iam::123456789012:user/*. The identity is looked up through c, which
+// must use the same credentials as the role's client. A mismatch fails the
+// assumption with a *CallerMismatchError.
+func WithCallerCheck(pattern string, c CallerIdentityClient) RoleOption {
+	return func(r *Role) {
+		r.caller = &callerCheck{pattern: pattern, match: arnLike(pattern), client: c}
+	}
+}
+
+// Returns an error if the role expects a caller identity its base credentials
+// don't have.
+func (r *Role) checkCaller(ctx context.Context) error {
+	if r.caller == nil {
+		return nil
+	}
+
+	resp, err := r.caller.client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return err
+	}
+
+	if arn := aws.StringValue(resp.Arn); !r.caller.match.MatchString(arn) {
+		return &CallerMismatchError{Role: r.arn, Caller: arn, Expected: r.caller.pattern}
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package finto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArnLike(t *testing.T) {
+	cases := []struct {
+		pattern, arn string
+		match        bool
+	}{
+		{"arn:aws:iam::123456789012:user/deploy", "arn:aws:iam::123456789012:user/deploy", true},
+		{"arn:aws:iam::123456789012:user/deploy", "arn:aws:iam::123456789012:user/deployer", false},
+		{"arn:aws:iam::123456789012:user/*", "arn:aws:iam::123456789012:user/deploy", true},
+		{"arn:aws:iam::123456789012:user/*", "arn:aws:iam::210987654321:user/deploy", false},
+		{"arn:aws:sts::123456789012:assumed-role/ci/*", "arn:aws:sts::123456789012:assumed-role/ci/build-1", true},
+		{"arn:aws:iam::12345678901?:user/deploy", "arn:aws:iam::123456789012:user/deploy", true},
+		{"arn:aws-cn:iam::*:user/deploy", "arn:aws-cn:iam::123456789012:user/deploy", true},
+		{"arn:aws-cn:iam::*:user/deploy", "arn:aws:iam::123456789012:user/deploy", false},
+
+		// Other regexp metacharacters are literal.
+		{"arn:aws:iam::123456789012:user/a.b", "arn:aws:iam::123456789012:user/aab", false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.match, arnLike(c.pattern).MatchString(c.arn), c.pattern+" "+c.arn)
+	}
+}
+
+func TestValidateCallerPattern(t *testing.T) {
+	assert.NoError(t, ValidateCallerPattern("arn:aws:iam::123456789012:user/*"))
+	assert.Error(t, ValidateCallerPattern("deploy"))
+	assert.Error(t, ValidateCallerPattern(""))
+}
+
+func TestCallerCheck(t *testing.T) {
+	client := &RecordingAssumeRoleClient{}
+	caller := &mockCallerIdentityClient{arn: "arn:aws:iam::123456789012:user/deploy"}
+
+	rs := NewRoleSet(client)
+	rs.SetRole("checked-alias", testArn, WithCallerCheck("arn:aws:iam::123456789012:user/*", caller))
+
+	role, _ := rs.Role("checked-alias")
+
+	_, err := role.Credentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, caller.calls)
+	assert.Len(t, client.inputs, 1)
+
+	// Credentials of the wrong identity are never used to assume the role.
+	caller.arn = "arn:aws:iam::210987654321:user/deploy"
+
+	err = role.Refresh(context.Background())
+	if assert.IsType(t, &CallerMismatchError{}, err) {
+		assert.Equal(t, &CallerMismatchError{
+			Role:     testArn,
+			Caller:   "arn:aws:iam::210987654321:user/deploy",
+			Expected: "arn:aws:iam::123456789012:user/*",
+		}, err)
+	}
+	assert.Len(t, client.inputs, 1)
+
+	// Failing to look up the identity is retried like a failed assumption.
+	role.retry = RetryPolicy{MaxAttempts: 3}
+	caller.calls, caller.arn = 0, "arn:aws:iam::123456789012:user/deploy"
+	caller.err = awserr.New("Throttling", "Rate exceeded", nil)
+
+	assert.Equal(t, caller.err, role.Refresh(context.Background()))
+	assert.Equal(t, 3, caller.calls)
+	assert.Len(t, client.inputs, 1)
+}
@@ -0,0 +1,82 @@
+package finto
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// ChainSource is a named source of the credentials a role is assumed with, such
+// as an SSO session or a shared credentials profile.
+type ChainSource struct {
+	Name   string
+	Client AssumeRoleClient
+}
+
+// Assumes roles through the first of its sources that succeeds.
+type chainAssumeRoleClient struct {
+	sources []ChainSource
+	last    string // The source of the most recent successful assumption
+	m       sync.Mutex
+}
+
+// Returns an AssumeRoleClient that tries each of sources in order until one
+// assumes the role, so that one config can serve machines with different
+// credentials available. Pass it to a role with WithClient.
+func NewChainAssumeRoleClient(sources ...ChainSource) AssumeRoleClient {
+	return &chainAssumeRoleClient{sources: sources}
+}
+
+func (c *chainAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	var failures []SourceFailure
+
+	for _, source := range c.sources {
+		resp, err := source.Client.AssumeRoleWithContext(ctx, input, opts...)
+		if err != nil {
+			failures = append(failures, SourceFailure{Source: source.Name, Err: err})
+			continue
+		}
+
+		// Log the source only as it changes, rather than on every refresh.
+		c.m.Lock()
+		if c.last != source.Name {
+			log.Printf("assumed role %s through credential source %s",
+				aws.StringValue(input.RoleArn), source.Name)
+			c.last = source.Name
+		}
+		c.m.Unlock()
+
+		return resp, nil
+	}
+
+	return nil, &ChainError{Failures: failures}
+}
+
+// SourceFailure is the failure of one source in a chain.
+type SourceFailure struct {
+	Source string
+	Err    error
+}
+
+// ChainError reports that every source in a chain failed to assume a role.
+type ChainError struct {
+	Failures []SourceFailure // In the order the sources were tried
+}
+
+func (e *ChainError) Error() string {
+	if len(e.Failures) == 0 {
+		return "no credential sources to assume role with"
+	}
+
+	msgs := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		msgs[i] = fmt.Sprintf("%s: %s", f.Source, f.Err)
+	}
+
+	return "all credential sources failed: " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,51 @@
+package finto
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChainAssumeRoleClient(t *testing.T) {
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	expired := awserr.New("ExpiredToken", "sso session expired", nil)
+
+	sso := &FailingAssumeRoleClient{errs: []error{expired}}
+	profile := &FailingAssumeRoleClient{}
+
+	client := NewChainAssumeRoleClient(
+		ChainSource{Name: "sso", Client: sso},
+		ChainSource{Name: "profile", Client: profile},
+	)
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithClient(client)))
+	role, _ := rs.Role("test-alias")
+
+	// The first source fails, so the second is used.
+	_, err := role.Credentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sso.calls)
+	assert.Equal(t, 1, profile.calls)
+
+	// Once the first source recovers, it is preferred again.
+	assert.NoError(t, role.Refresh(context.Background()))
+	assert.Equal(t, 2, sso.calls)
+	assert.Equal(t, 1, profile.calls)
+
+	// When every source fails, each failure is reported.
+	client = NewChainAssumeRoleClient(
+		ChainSource{Name: "sso", Client: &FailingAssumeRoleClient{errs: []error{expired}}},
+		ChainSource{Name: "env", Client: &FailingAssumeRoleClient{errs: []error{denied}}},
+	)
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithClient(client)))
+	role, _ = rs.Role("test-alias")
+
+	_, err = role.Credentials(context.Background())
+	if cerr, ok := err.(*ChainError); assert.True(t, ok) {
+		assert.Equal(t, []SourceFailure{{"sso", expired}, {"env", denied}}, cerr.Failures)
+		assert.Equal(t, "all credential sources failed: sso: ExpiredToken: sso session expired; env: AccessDenied: not authorized", err.Error())
+	}
+}
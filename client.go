@@ -0,0 +1,177 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client is a typed client for finto's control API.
+type Client struct {
+	BaseURL    string       // Base URL of finto, e.g. http://169.254.169.254
+	Token      string       // Sent as a bearer token when not empty
+	HTTPClient *http.Client // Defaults to http.DefaultClient
+}
+
+func NewClient(baseURL string) *Client {
+	return &Client{BaseURL: baseURL}
+}
+
+// RoleInfo is a role's configuration as reported by finto.
+type RoleInfo struct {
+	Arn         string   `json:"arn"`
+	SessionName string   `json:"session_name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	ProfileName string   `json:"profile_name,omitempty"`
+}
+
+// Machine-readable codes of control API errors. Unlike messages, they are
+// stable, so clients can branch on them.
+const (
+	ErrCodeNotFound         = "not_found"          // No route matches the request
+	ErrCodeMethodNotAllowed = "method_not_allowed" // The request's path doesn't accept its method
+	ErrCodeRoleNotFound     = "role_not_found"     // No role has the requested alias or ARN
+	ErrCodeAmbiguousArn     = "ambiguous_arn"      // More than one role has the requested ARN
+	ErrCodeNoActiveRole     = "no_active_role"     // No role is served as the instance role
+	ErrCodeGroupNotFound    = "group_not_found"    // No role group has the requested name
+	ErrCodeGroupNotActive   = "group_not_active"   // The role group must be activated first
+	ErrCodeInvalidRequest   = "invalid_request"    // The request body is malformed or incomplete
+	ErrCodeBodyTooLarge     = "body_too_large"     // The request body exceeds the size finto reads
+	ErrCodeClientForbidden  = "client_forbidden"   // The role isn't served to the requesting client
+	ErrCodeAssumeFailed     = "assume_failed"      // The role's credentials couldn't be retrieved
+	ErrCodeRefreshing       = "refreshing"         // The role's credentials are being refreshed; retry shortly
+	ErrCodeInstanceNotFound = "instance_not_found" // No hosted instance has the requested name
+	ErrCodeReadOnly         = "read_only"          // finto runs read-only, refusing changes
+	ErrCodeInternal         = "internal_error"     // finto failed to render a response
+)
+
+// APIError is an error reported by finto.
+type APIError struct {
+	StatusCode   int
+	Code         string // One of the ErrCode constants, if finto sent one
+	Message      string
+	RequestID    string // For finding the request in finto's logs, if it has one
+	AWSRequestID string // AWS's ID for the failed STS request behind the error, if any
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// The body of an error response.
+type errorBody struct {
+	Error        string `json:"error"`
+	Code         string `json:"code"`
+	RequestID    string `json:"request_id,omitempty"`
+	AWSRequestID string `json:"aws_request_id,omitempty"`
+}
+
+// Returns the aliases of all available roles.
+func (c *Client) Roles() ([]string, error) {
+	var resp struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := c.do("GET", "/roles", nil, &resp)
+	return resp.Roles, err
+}
+
+// Returns the configuration of the role with the given alias.
+func (c *Client) Role(alias string) (RoleInfo, error) {
+	var resp RoleInfo
+
+	err := c.do("GET", "/roles/"+url.PathEscape(alias), nil, &resp)
+	return resp, err
+}
+
+// Sets the role served as the instance profile role. Returns the alias finto
+// reports as active.
+func (c *Client) SetActive(alias string) (string, error) {
+	var resp struct {
+		ActiveRole string `json:"active_role"`
+	}
+
+	err := c.do("PUT", "/roles", map[string]string{"alias": alias}, &resp)
+	return resp.ActiveRole, err
+}
+
+// Returns the alias of the role served as the instance profile role.
+func (c *Client) ActiveRole() (string, error) {
+	var resp struct {
+		Roles []string `json:"roles"`
+	}
+
+	if err := c.do("GET", "/roles?status=active", nil, &resp); err != nil {
+		return "", err
+	}
+
+	if len(resp.Roles) == 0 {
+		return "", nil
+	}
+
+	return resp.Roles[0], nil
+}
+
+// Sends a request with an optional JSON body, and decodes the JSON response
+// into out. Error responses are returned as an *APIError.
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(c.BaseURL, "/")+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Error == "" {
+			e.Error = resp.Status
+		}
+
+		return &APIError{
+			StatusCode:   resp.StatusCode,
+			Code:         e.Code,
+			Message:      e.Error,
+			RequestID:    resp.Header.Get(RequestIDHeader),
+			AWSRequestID: e.AWSRequestID,
+		}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %s", err)
+	}
+
+	return nil
+}
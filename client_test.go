@@ -0,0 +1,55 @@
+package finto
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestClient() (*Client, *httptest.Server) {
+	ts := httptest.NewServer(FintoRouter(setupTestFintoContext()))
+	return NewClient(ts.URL), ts
+}
+
+func TestClient(t *testing.T) {
+	c, ts := setupTestClient()
+	defer ts.Close()
+
+	roles, err := c.Roles()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"another-alias", "test-alias"}, roles)
+	}
+
+	role, err := c.Role("test-alias")
+	if assert.NoError(t, err) {
+		assert.Equal(t, RoleInfo{Arn: testArn, SessionName: "finto-test-alias"}, role)
+	}
+
+	active, err := c.ActiveRole()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test-alias", active)
+	}
+
+	active, err = c.SetActive("another-alias")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "another-alias", active)
+	}
+
+	active, err = c.ActiveRole()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "another-alias", active)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	c, ts := setupTestClient()
+	defer ts.Close()
+
+	_, err := c.Role("missing-alias")
+	assert.Equal(t, &APIError{http.StatusNotFound, ErrCodeRoleNotFound, "unknown role: missing-alias", "", ""}, err)
+
+	_, err = c.SetActive("missing-alias")
+	assert.Equal(t, &APIError{http.StatusBadRequest, ErrCodeRoleNotFound, "unknown role: missing-alias", "", ""}, err)
+}
@@ -0,0 +1,137 @@
+package finto
+
+import (
+	"log"
+	"time"
+)
+
+// Clock tells the time. Roles judge their credentials' expiration by it, so
+// that tests can substitute a clock of their own.
+type Clock interface {
+	Now() time.Time
+}
+
+// The system's clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Returns the time by the role's clock.
+func (r *Role) now() time.Time {
+	if r.clock == nil {
+		return time.Now()
+	}
+
+	return r.clock.Now()
+}
+
+// Returns the time by the role's clock, and how far it may be skewed.
+func (r *Role) clockSkew() (time.Time, time.Duration) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.now(), r.skew
+}
+
+// Returns the time by the set's clock.
+func (rs *RoleSet) now() time.Time {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+
+	return rs.clock.Now()
+}
+
+// Sets the clock of the set's roles, including those added later. A nil clock
+// restores the system's.
+func (rs *RoleSet) SetClock(c Clock) {
+	if c == nil {
+		c = systemClock{}
+	}
+
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.clock = c
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.clock = c
+		role.m.Unlock()
+	}
+}
+
+// Sets how far the local clock may disagree with STS's, for the set's roles,
+// including those added later. Credentials are refreshed once they're within
+// skew of expiring, lest a slow clock serve them past their expiration. And
+// credentials minted less than skew ago are kept even if they appear expired,
+// lest a fast clock have them assumed anew on every request.
+func (rs *RoleSet) SetClockSkew(skew time.Duration) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.skew = skew
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.skew = skew
+		role.m.Unlock()
+	}
+}
+
+// Returns whether credentials minted at updated and expiring at expiration are
+// to be treated as expired at now, allowing for skew.
+func expiredWithSkew(now, updated, expiration time.Time, skew time.Duration) bool {
+	if skew > 0 && now.Sub(updated) < skew {
+		return false
+	}
+
+	return now.Add(skew).After(expiration)
+}
+
+// Sets how far the local clock may disagree with STS's before a warning is
+// logged, for the set's roles, including those added later. Zero disables the
+// check. The disagreement is judged from the expiration of each assumption,
+// which STS sets a session duration after minting the credentials, so only
+// roles assumed through STS are checked.
+func (rs *RoleSet) SetMaxClockSkew(max time.Duration) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.maxSkew = max
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.maxSkew = max
+		role.m.Unlock()
+	}
+}
+
+// Returns how far the clock reading now is behind STS's, judging by
+// credentials lasting duration that STS says expire at expiration. It's
+// negative if the clock is ahead, and includes the latency of the request.
+func clockSkew(now, expiration time.Time, duration time.Duration) time.Duration {
+	return expiration.Add(-duration).Sub(now)
+}
+
+// Logs a warning if credentials STS says expire at expiration imply that the
+// role's clock disagrees with STS's by more than its maximum skew. The role
+// must be locked.
+func (r *Role) checkClockSkew(expiration time.Time) {
+	if r.maxSkew <= 0 || r.provider != nil {
+		return
+	}
+
+	duration := r.duration
+	if duration == 0 {
+		duration = DefaultSessionDuration
+	}
+
+	skew := clockSkew(r.now(), expiration, duration)
+	switch {
+	case skew > r.maxSkew:
+		log.Printf("warning: local clock is %s behind STS's, judging by role %s's expiration; check NTP",
+			skew.Round(time.Second), r.arn)
+	case -skew > r.maxSkew:
+		log.Printf("warning: local clock is %s ahead of STS's, judging by role %s's expiration; check NTP",
+			(-skew).Round(time.Second), r.arn)
+	}
+}
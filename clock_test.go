@@ -0,0 +1,162 @@
+package finto
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A clock that moves only when told to. For testing purposes.
+type fakeClock struct {
+	now time.Time
+	m   sync.Mutex
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+func TestClockSkew(t *testing.T) {
+	// MockAssumeRoleClient's credentials expire at MockExpiry by STS's clock.
+	expiry := MockExpiry
+
+	cases := []struct {
+		name    string
+		start   time.Time     // The local time credentials are minted at
+		skew    time.Duration // The allowance for skew
+		advance time.Duration // How long until they're requested again
+		calls   int           // The assumptions made by then
+	}{
+		// A slow clock would serve the credentials until they expire by its
+		// own reckoning, past when they do by STS's. The allowance refreshes
+		// them ahead of it.
+		{"slow, no allowance", expiry.Add(-time.Hour), 0, 55 * time.Minute, 1},
+		{"slow", expiry.Add(-time.Hour), 10 * time.Minute, 55 * time.Minute, 2},
+		{"slow, not yet due", expiry.Add(-time.Hour), 10 * time.Minute, 45 * time.Minute, 1},
+
+		// A fast clock sees freshly minted credentials as expired. The
+		// allowance keeps them rather than assuming anew on every request.
+		{"fast, no allowance", expiry.Add(time.Hour), 0, time.Minute, 2},
+		{"fast", expiry.Add(time.Hour), 10 * time.Minute, time.Minute, 1},
+		{"fast, past allowance", expiry.Add(time.Hour), 10 * time.Minute, 11 * time.Minute, 2},
+	}
+
+	for _, c := range cases {
+		client := &FailingAssumeRoleClient{}
+		clock := &fakeClock{now: c.start}
+
+		rs := NewRoleSet(client)
+		rs.SetClock(clock)
+		rs.SetClockSkew(c.skew)
+		assert.NoError(t, rs.SetRole("test-alias", testArn))
+		role, _ := rs.Role("test-alias")
+
+		creds, err := role.Credentials(context.Background())
+		if assert.NoError(t, err, c.name) {
+			assert.Equal(t, c.start, creds.LastUpdated, c.name)
+		}
+
+		clock.Advance(c.advance)
+		_, err = role.Credentials(context.Background())
+		assert.NoError(t, err, c.name)
+		assert.Equal(t, c.calls, client.calls, c.name)
+	}
+}
+
+func TestRefreshDelayClockSkew(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	window := RefreshWindow{Lead: 5 * time.Minute}
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetClock(clock)
+	assert.NoError(t, rs.SetRole("test-alias", testArn))
+	role, _ := rs.Role("test-alias")
+
+	role.lastRefresh = clock.Now()
+	role.creds.SetExpiration(role.lastRefresh.Add(time.Hour), 0)
+
+	// The delay is reckoned by the role's clock, and brought forward by the
+	// allowance.
+	assert.Equal(t, 55*time.Minute, refreshDelay(role, window, 0))
+
+	rs.SetClockSkew(10 * time.Minute)
+	assert.Equal(t, 45*time.Minute, refreshDelay(role, window, 0))
+
+	// Credentials that look due on a fast clock are kept for the allowance.
+	role.creds.SetExpiration(role.lastRefresh.Add(-time.Hour), 0)
+	assert.Equal(t, 10*time.Minute, refreshDelay(role, window, 0))
+
+	clock.Advance(4 * time.Minute)
+	assert.Equal(t, 6*time.Minute, refreshDelay(role, window, 0))
+}
+
+func TestMaxClockSkew(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	// MockAssumeRoleClient's credentials expire at MockExpiry, an hour after
+	// STS minted them.
+	minted := MockExpiry.Add(-DefaultSessionDuration)
+
+	cases := []struct {
+		name  string
+		now   time.Time
+		max   time.Duration
+		warns string
+	}{
+		{"in sync", minted, time.Minute, ""},
+		{"within max", minted.Add(-30 * time.Second), time.Minute, ""},
+		{"behind", minted.Add(-5 * time.Minute), time.Minute, "local clock is 5m0s behind STS's"},
+		{"ahead", minted.Add(5 * time.Minute), time.Minute, "local clock is 5m0s ahead of STS's"},
+		{"disabled", minted.Add(5 * time.Minute), 0, ""},
+	}
+
+	for _, c := range cases {
+		logged.Reset()
+
+		rs := NewRoleSet(&MockAssumeRoleClient{})
+		rs.SetClock(&fakeClock{now: c.now})
+		rs.SetMaxClockSkew(c.max)
+		assert.NoError(t, rs.SetRole("test-alias", testArn))
+		role, _ := rs.Role("test-alias")
+
+		_, err := role.Credentials(context.Background())
+		assert.NoError(t, err, c.name)
+
+		if c.warns == "" {
+			assert.Empty(t, logged.String(), c.name)
+		} else {
+			assert.Contains(t, logged.String(), c.warns, c.name)
+		}
+	}
+
+	// A requested session duration is taken into account.
+	logged.Reset()
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetClock(&fakeClock{now: MockExpiry.Add(-2 * time.Hour)})
+	rs.SetMaxClockSkew(time.Minute)
+	assert.NoError(t, rs.SetRole("test-alias", testArn, WithSessionDuration(2*time.Hour)))
+	role, _ := rs.Role("test-alias")
+
+	_, err := role.Credentials(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, logged.String())
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The first file descriptor passed by systemd, after stdin, stdout, and stderr.
+const listenFdsStart = 3
+
+// Returns the listeners systemd passed to finto through socket activation, or
+// nil if it wasn't socket-activated. The listeners are ordered by
+// LISTEN_FDNAMES if it names them "metadata" and "control", and otherwise as
+// passed: metadata first, then control. The variables are unset so that child
+// processes don't mistake the listeners for their own.
+//
+// https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+func activationListeners(start int) ([]net.Listener, error) {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("socket activation: invalid LISTEN_FDS: %q", os.Getenv("LISTEN_FDS"))
+	}
+
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+
+	for _, v := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(v)
+	}
+
+	listeners := make([]net.Listener, n)
+	for i := range listeners {
+		f := os.NewFile(uintptr(start+i), "LISTEN_FD_"+strconv.Itoa(start+i))
+
+		// FileListener duplicates the descriptor, so the original is closed.
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("socket activation: fd %d: %s", start+i, err)
+		}
+
+		listeners[i] = l
+	}
+
+	if len(names) == 2 && names[0] == "control" && names[1] == "metadata" {
+		listeners[0], listeners[1] = listeners[1], listeners[0]
+	}
+
+	return listeners, nil
+}
+
+// Returns a listener for each of addrs, using those passed by socket activation
+// in order and binding the rest.
+func bindListeners(addrs []string, activated []net.Listener) ([]net.Listener, error) {
+	if len(activated) > len(addrs) {
+		return nil, fmt.Errorf("socket activation: %d sockets passed, %d used", len(activated), len(addrs))
+	}
+
+	listeners := make([]net.Listener, len(addrs))
+	for i, addr := range addrs {
+		if i < len(activated) {
+			listeners[i] = activated[i]
+			continue
+		}
+
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		listeners[i] = l
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivationListeners(t *testing.T) {
+	os.Unsetenv("LISTEN_PID")
+
+	// Without LISTEN_PID, finto binds its own listeners.
+	activated, err := activationListeners(listenFdsStart)
+	assert.NoError(t, err)
+	assert.Nil(t, activated)
+
+	// Simulate systemd by passing the descriptor of a bound socket.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Error listening", err)
+	}
+	defer l.Close()
+
+	f, err := l.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal("Error getting file", err)
+	}
+
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	os.Setenv("LISTEN_FDS", "1")
+
+	activated, err = activationListeners(int(f.Fd()))
+	if !assert.NoError(t, err) || !assert.Len(t, activated, 1) {
+		return
+	}
+	defer activated[0].Close()
+
+	assert.Equal(t, l.Addr().String(), activated[0].Addr().String())
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	listeners, err := bindListeners([]string{"169.254.169.254:80", "127.0.0.1:0"}, activated)
+	if assert.NoError(t, err) {
+		defer listeners[1].Close()
+		assert.Equal(t, activated[0], listeners[0])
+	}
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if assert.NoError(t, err) {
+		conn.Close()
+	}
+
+	_, err = bindListeners([]string{"127.0.0.1:0"}, []net.Listener{activated[0], activated[0]})
+	assert.Error(t, err)
+
+	// Another process's sockets are left alone.
+	os.Setenv("LISTEN_PID", "1")
+	os.Setenv("LISTEN_FDS", "1")
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+
+	activated, err = activationListeners(listenFdsStart)
+	assert.NoError(t, err)
+	assert.Nil(t, activated)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Returns the location of the AWS config file: file if given, else
+// $AWS_CONFIG_FILE, else ~/.aws/config.
+func awsConfigFile(file string) string {
+	if file != "" {
+		return file
+	}
+
+	if env := os.Getenv("AWS_CONFIG_FILE"); env != "" {
+		return env
+	}
+
+	dir, err := homeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, ".aws", "config")
+}
+
+// Reads the profiles of an AWS config file that assume a role, i.e. those with
+// a role_arn, as roles aliased by profile name. Returns the roles, and the
+// alias of the default profile if it assumes a role.
+func loadAWSProfiles(file string) (RolesConfig, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read AWS config: %s", err)
+	}
+	defer f.Close()
+
+	var (
+		profiles = make(map[string]map[string]string)
+		section  map[string]string
+	)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Indented lines continue nested settings, e.g. those under s3.
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+
+			switch {
+			case name == "default":
+			case strings.HasPrefix(name, "profile "):
+				name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+			default:
+				// sso-session and other sections don't describe profiles.
+				section = nil
+				continue
+			}
+
+			section = make(map[string]string)
+			profiles[name] = section
+			continue
+		}
+
+		if section == nil {
+			continue
+		}
+
+		if i := strings.Index(line, "="); i > 0 {
+			section[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, "", fmt.Errorf("failed to read AWS config: %s", err)
+	}
+
+	roles, defaultRole := make(RolesConfig), ""
+	for name, settings := range profiles {
+		if settings["role_arn"] == "" {
+			continue
+		}
+
+		roles[name] = RoleConfig{
+			Arn:           settings["role_arn"],
+			SourceProfile: settings["source_profile"],
+			Region:        settings["region"],
+		}
+
+		if name == "default" {
+			defaultRole = name
+		}
+	}
+
+	return roles, defaultRole, nil
+}
+
+// Adds roles read from an AWS config file to c's own, and makes defaultRole
+// the default role if c doesn't name one. Returns an error naming every alias
+// defined by both.
+func (c *Config) mergeAWSProfiles(roles RolesConfig, defaultRole string) error {
+	var conflicts []string
+	for alias := range roles {
+		if _, ok := c.Roles[alias]; ok {
+			conflicts = append(conflicts, alias)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		return fmt.Errorf("roles defined by both finto and AWS config: %s",
+			strings.Join(conflicts, ", "))
+	}
+
+	if c.Roles == nil {
+		c.Roles = make(RolesConfig)
+	}
+
+	for alias, role := range roles {
+		c.Roles[alias] = role
+	}
+
+	if c.DefaultRole == "" {
+		c.DefaultRole = defaultRole
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const awsConfigExample = `[default]
+region = us-east-1
+role_arn = arn:aws:iam::123456789012:role/default
+
+# Profiles without a role_arn aren't roles.
+[profile base]
+region = us-west-2
+s3 =
+  max_concurrent_requests = 20
+
+[profile admin]
+role_arn = arn:aws:iam::123456789012:role/admin
+source_profile = base
+region = us-west-2
+
+[sso-session corp]
+role_arn = arn:aws:iam::123456789012:role/ignored
+`
+
+func writeAWSConfig(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "aws-config-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte(content), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	return f.Name()
+}
+
+func TestLoadAWSProfiles(t *testing.T) {
+	file := writeAWSConfig(t, awsConfigExample)
+	defer os.Remove(file)
+
+	roles, defaultRole, err := loadAWSProfiles(file)
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, RolesConfig{
+			"default": {Arn: "arn:aws:iam::123456789012:role/default", Region: "us-east-1"},
+			"admin": {
+				Arn:           "arn:aws:iam::123456789012:role/admin",
+				SourceProfile: "base",
+				Region:        "us-west-2",
+			},
+		}, roles)
+		assert.Equal(t, "default", defaultRole)
+	}
+
+	_, _, err = loadAWSProfiles("/nonexistent/aws-config")
+	assert.Error(t, err)
+}
+
+func TestMergeAWSProfiles(t *testing.T) {
+	roles := RolesConfig{"admin": {Arn: "admin-arn"}, "dev": {Arn: "dev-arn"}}
+
+	c := &Config{DefaultRole: "ops", Roles: RolesConfig{"ops": {Arn: "ops-arn"}}}
+	if assert.NoError(t, c.mergeAWSProfiles(roles, "default")) {
+		assert.Len(t, c.Roles, 3)
+		assert.Equal(t, "ops", c.DefaultRole)
+	}
+
+	c = &Config{}
+	if assert.NoError(t, c.mergeAWSProfiles(roles, "admin")) {
+		assert.Equal(t, roles, c.Roles)
+		assert.Equal(t, "admin", c.DefaultRole)
+	}
+
+	c = &Config{Roles: RolesConfig{"admin": {Arn: "other-arn"}, "dev": {Arn: "dev-arn"}}}
+	err := c.mergeAWSProfiles(roles, "")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "admin, dev")
+	}
+}
+
+func TestLoadConfigAWSConfig(t *testing.T) {
+	file := writeAWSConfig(t, awsConfigExample)
+	defer os.Remove(file)
+
+	rc := writeAWSConfig(t, `{"aws_config": {"file": "`+file+`"}, "roles": {"ops": "ops-arn"}}`)
+	defer os.Remove(rc)
+
+	c, err := LoadConfig(rc)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "default", c.DefaultRole)
+		assert.Len(t, c.Roles, 3)
+		assert.Equal(t, "base", c.Roles["admin"].SourceProfile)
+	}
+}
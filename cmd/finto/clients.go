@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/threadwaste/finto"
+)
+
+// Returns an STS client using the given base credentials, calling the region's
+// endpoint if region is not empty, or else endpoint if that isn't, through
+// httpClient if it isn't nil. Retries are left to the role set's RetryPolicy.
+func newSTSClient(creds *credentials.Credentials, region, endpoint string, httpClient *http.Client) *sts.STS {
+	config := &aws.Config{
+		Credentials: creds,
+		HTTPClient:  httpClient,
+		MaxRetries:  aws.Int(0),
+	}
+
+	if region != "" {
+		config.Region = aws.String(region)
+	} else if endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+
+	return sts.New(session.New(), config)
+}
+
+// Caches STS clients by credential source and region, so that roles sharing
+// both share a client, along with the source's cached credentials. Sources
+// are loaded once, on first use.
+type stsClients struct {
+	file     string       // The shared credentials file; the SDK's default if empty
+	profile  string       // The profile of the top-level credentials
+	endpoint string       // The STS endpoint of clients without a region; the SDK's default if empty
+	http     *http.Client // The HTTP client STS is called through; the SDK's default if nil
+
+	creds   map[string]*credentials.Credentials // Keyed by source
+	clients map[stsClientKey]*sts.STS
+	m       sync.Mutex
+}
+
+type stsClientKey struct {
+	source, region string
+}
+
+// Returns a cache of STS clients whose top-level credentials come from profile
+// in the shared credentials file.
+func newSTSClients(file, profile string) *stsClients {
+	return &stsClients{
+		file:    file,
+		profile: profile,
+		creds:   make(map[string]*credentials.Credentials),
+		clients: make(map[stsClientKey]*sts.STS),
+	}
+}
+
+// Returns the client for a source and region, creating it, and the source's
+// credentials with newCreds, on first use.
+func (c *stsClients) get(source, region string, newCreds func() (*credentials.Credentials, error)) (*sts.STS, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	key := stsClientKey{source, region}
+	if client, ok := c.clients[key]; ok {
+		return client, nil
+	}
+
+	creds, ok := c.creds[source]
+	if !ok {
+		var err error
+		if creds, err = newCreds(); err != nil {
+			return nil, err
+		}
+
+		c.creds[source] = creds
+	}
+
+	client := newSTSClient(creds, region, c.endpoint, c.http)
+	c.clients[key] = client
+
+	return client, nil
+}
+
+// Returns the HTTP client STS is called through as configured: through proxy,
+// if set, or else the proxy HTTPS_PROXY and NO_PROXY select, as by default,
+// and with each call bounded by timeout, if set.
+func newSTSHTTPClient(c *STSHTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if c.Proxy != "" {
+		u, err := url.Parse(c.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("sts_http: invalid proxy: %q", c.Proxy)
+		}
+
+		transport.Proxy = http.ProxyURL(u)
+	}
+
+	client := &http.Client{Transport: transport}
+	if c.Timeout != nil {
+		client.Timeout = c.Timeout.Duration
+	}
+
+	return client, nil
+}
+
+// Returns a client using the top-level credentials. They aren't read until
+// first used.
+func (c *stsClients) base(region string) *sts.STS {
+	client, _ := c.get("credentials", region, func() (*credentials.Credentials, error) {
+		return sharedCredentials(c.file, c.profile), nil
+	})
+
+	return client
+}
+
+// Returns a client using a profile from the shared credentials file. The
+// profile is read immediately so that a missing profile fails at load time.
+func (c *stsClients) sourceProfile(profile, region string) (*sts.STS, error) {
+	return c.get("profile "+profile, region, func() (*credentials.Credentials, error) {
+		creds := sharedCredentials(c.file, profile)
+		if _, err := creds.Get(); err != nil {
+			return nil, fmt.Errorf("failed to load profile %s: %s", profile, err)
+		}
+
+		return creds, nil
+	})
+}
+
+// Returns a client using a profile as the AWS CLI resolves it.
+func (c *stsClients) session(profile, region string) *sts.STS {
+	client, _ := c.get("session "+profile, region, func() (*credentials.Credentials, error) {
+		return sessionCredentials(profile, c.http), nil
+	})
+
+	return client
+}
+
+// Returns a client using credentials from the environment.
+func (c *stsClients) env(region string) *sts.STS {
+	client, _ := c.get("env", region, func() (*credentials.Credentials, error) {
+		return credentials.NewEnvCredentials(), nil
+	})
+
+	return client
+}
+
+// Returns the credentials of a profile in the shared credentials file.
+//
+// SharedCredentialsProvider defaults to file=$AWS_SHARED_CREDENTIALS_FILE or
+// ~/.aws/credentials, and profile=default, when provided zero-value strings.
+func sharedCredentials(file, profile string) *credentials.Credentials {
+	return credentials.NewCredentials(&sharedCredentialsProvider{
+		SharedCredentialsProvider: credentials.SharedCredentialsProvider{
+			Filename: file,
+			Profile:  profile,
+		},
+	})
+}
+
+// A SharedCredentialsProvider that reads its profile anew once the file
+// changes, e.g. when rotated keys are written to it. Otherwise the profile is
+// read only once, and clients would sign with the old keys until restarted.
+type sharedCredentialsProvider struct {
+	credentials.SharedCredentialsProvider
+	modTime time.Time // The file's modification time when last read
+}
+
+func (p *sharedCredentialsProvider) Retrieve() (credentials.Value, error) {
+	v, err := p.SharedCredentialsProvider.Retrieve()
+	if err == nil {
+		p.modTime = p.fileModTime()
+	}
+
+	return v, err
+}
+
+func (p *sharedCredentialsProvider) IsExpired() bool {
+	return p.SharedCredentialsProvider.IsExpired() || !p.fileModTime().Equal(p.modTime)
+}
+
+// Returns the file's modification time, or the zero time if it can't be read.
+// Retrieve resolves the default file into Filename.
+func (p *sharedCredentialsProvider) fileModTime() time.Time {
+	fi, err := os.Stat(p.Filename)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return fi.ModTime()
+}
+
+// Returns a function that obtains a SAML assertion as configured: read from
+// assertion_file, or printed by assertion_command. Either is consulted anew on
+// each assumption, so a refreshed assertion is picked up without a restart.
+func samlAssertion(c *SAMLConfig) (finto.SAMLAssertionFunc, error) {
+	switch {
+	case c.PrincipalArn == "":
+		return nil, fmt.Errorf("saml: principal_arn is required")
+	case c.AssertionFile != "" && len(c.AssertionCommand) > 0:
+		return nil, fmt.Errorf("saml: assertion_file and assertion_command are exclusive")
+	case c.AssertionFile != "":
+		return func(context.Context) (string, error) {
+			b, err := ioutil.ReadFile(c.AssertionFile)
+			if err != nil {
+				return "", err
+			}
+
+			return strings.TrimSpace(string(b)), nil
+		}, nil
+	case len(c.AssertionCommand) > 0:
+		return func(ctx context.Context) (string, error) {
+			var stderr bytes.Buffer
+
+			cmd := exec.CommandContext(ctx, c.AssertionCommand[0], c.AssertionCommand[1:]...)
+			cmd.Stderr = &stderr
+
+			out, err := cmd.Output()
+			if err != nil {
+				return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(stderr.String()))
+			}
+
+			return strings.TrimSpace(string(out)), nil
+		}, nil
+	}
+
+	return nil, fmt.Errorf("saml: assertion_file or assertion_command is required")
+}
+
+// Returns an STS client for each of a role's credential sources, named for the
+// logs. Sources are resolved as they're tried rather than at load time, since a
+// chain exists for hosts where only some of them are available.
+func (c *stsClients) chain(sources SourceChain, region string) ([]finto.ChainSource, error) {
+	chain := make([]finto.ChainSource, len(sources))
+
+	for i, s := range sources {
+		switch {
+		case s.Profile != "" && s.Env:
+			return nil, fmt.Errorf("source %d: profile and env are exclusive", i)
+		case s.Profile != "":
+			chain[i] = finto.ChainSource{Name: "profile " + s.Profile, Client: c.session(s.Profile, region)}
+		case s.Env:
+			chain[i] = finto.ChainSource{Name: "env", Client: c.env(region)}
+		default:
+			return nil, fmt.Errorf("source %d: profile or env is required", i)
+		}
+	}
+
+	return chain, nil
+}
+
+// Returns the credentials of a profile as the AWS CLI resolves them, from the
+// shared config and credentials files, including SSO and credential_process
+// profiles. The calls resolving them, e.g. to SSO or STS, are made through
+// httpClient if it isn't nil. A profile that can't be loaded yields
+// credentials that fail with the reason.
+func sessionCredentials(profile string, httpClient *http.Client) *credentials.Credentials {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            aws.Config{HTTPClient: httpClient},
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return credentials.NewCredentials(&credentials.ErrorProvider{
+			Err:          err,
+			ProviderName: "SessionProvider",
+		})
+	}
+
+	return sess.Config.Credentials
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+const credentialsExample = `[base]
+aws_access_key_id = AKIDEXAMPLE
+aws_secret_access_key = SECRETEXAMPLE
+`
+
+func TestSTSClientsSourceProfile(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := ioutil.WriteFile(f.Name(), []byte(credentialsExample), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	clients := newSTSClients(f.Name(), "")
+
+	client, err := clients.sourceProfile("base", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+
+	regional, err := clients.sourceProfile("base", "us-gov-west-1")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "us-gov-west-1", *regional.Config.Region)
+	}
+
+	// Roles sharing a source and region share a client, and regions of a
+	// source share its credentials.
+	again, _ := clients.sourceProfile("base", "")
+	assert.True(t, client == again)
+	assert.True(t, client.Config.Credentials == regional.Config.Credentials)
+	assert.False(t, client == regional)
+
+	_, err = clients.sourceProfile("missing", "")
+	assert.Error(t, err)
+}
+
+// An AssumeRole response, as STS sends it.
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAPROXIED</AccessKeyId>
+      <SecretAccessKey>proxied-secret</SecretAccessKey>
+      <SessionToken>proxied-token</SessionToken>
+      <Expiration>2345-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+  <ResponseMetadata>
+    <RequestId>proxied-request</RequestId>
+  </ResponseMetadata>
+</AssumeRoleResponse>`
+
+func TestSTSClientsHTTP(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := ioutil.WriteFile(f.Name(), []byte(credentialsExample), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	defer os.Setenv("AWS_REGION", os.Getenv("AWS_REGION"))
+	os.Setenv("AWS_REGION", "us-east-1")
+
+	// A proxy that plays STS itself, recording the hosts it's asked for.
+	hosts := make(chan string, 2)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts <- r.URL.Host
+
+		if r.Header.Get("X-Slow") != "" {
+			time.Sleep(time.Second)
+		}
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, assumeRoleResponse)
+	}))
+	defer proxy.Close()
+
+	httpClient, err := newSTSHTTPClient(&STSHTTPConfig{Proxy: proxy.URL, Timeout: &Duration{100 * time.Millisecond}})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	clients := newSTSClients(f.Name(), "base")
+	clients.endpoint = "http://sts.example.test"
+	clients.http = httpClient
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String("arn:aws:iam::123456789012:role/test"),
+		RoleSessionName: aws.String("finto-test"),
+	}
+
+	resp, err := clients.base("").AssumeRoleWithContext(context.Background(), input)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ASIAPROXIED", aws.StringValue(resp.Credentials.AccessKeyId))
+	}
+	assert.Equal(t, "sts.example.test", <-hosts)
+
+	// Calls outlasting the timeout are abandoned.
+	_, err = clients.base("").AssumeRoleWithContext(context.Background(), input, func(r *request.Request) {
+		r.HTTPRequest.Header.Set("X-Slow", "1")
+	})
+	assert.Error(t, err)
+
+	_, err = newSTSHTTPClient(&STSHTTPConfig{Proxy: "proxy.example.test"})
+	assert.EqualError(t, err, `sts_http: invalid proxy: "proxy.example.test"`)
+}
+
+func TestSessionCredentialsHTTP(t *testing.T) {
+	creds, err := ioutil.TempFile("", "credentials-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(creds.Name())
+
+	config, err := ioutil.TempFile("", "config-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(config.Name())
+
+	ioutil.WriteFile(creds.Name(), []byte(credentialsExample), 0600)
+	ioutil.WriteFile(config.Name(), []byte("[profile chained]\nrole_arn = arn:aws:iam::123456789012:role/test\nsource_profile = base\nregion = us-east-1\n"), 0600)
+
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	defer os.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.Getenv("AWS_SHARED_CREDENTIALS_FILE"))
+	os.Setenv("AWS_CONFIG_FILE", config.Name())
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", creds.Name())
+
+	// A proxy that refuses to tunnel, recording the hosts it's asked for.
+	hosts := make(chan string, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case hosts <- r.Host:
+		default:
+		}
+
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+
+	httpClient, err := newSTSHTTPClient(&STSHTTPConfig{Proxy: proxy.URL})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The profile's own AssumeRole call goes through the proxy too.
+	_, err = sessionCredentials("chained", httpClient).Get()
+	assert.Error(t, err)
+
+	select {
+	case host := <-hosts:
+		assert.True(t, strings.HasPrefix(host, "sts."), host)
+	default:
+		t.Error("profile's STS call bypassed the proxy")
+	}
+}
+
+func TestSharedCredentialsRotation(t *testing.T) {
+	f, err := ioutil.TempFile("", "credentials-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := ioutil.WriteFile(f.Name(), []byte(credentialsExample), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	creds := sharedCredentials(f.Name(), "base")
+	if v, err := creds.Get(); assert.NoError(t, err) {
+		assert.Equal(t, "AKIDEXAMPLE", v.AccessKeyID)
+	}
+	assert.False(t, creds.IsExpired())
+
+	// Rotated keys are picked up once the file changes.
+	rotated := strings.Replace(credentialsExample, "AKIDEXAMPLE", "AKIDROTATED", 1)
+	if err := ioutil.WriteFile(f.Name(), []byte(rotated), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(f.Name(), later, later); err != nil {
+		t.Fatal("Error touching file", err)
+	}
+
+	assert.True(t, creds.IsExpired())
+	if v, err := creds.Get(); assert.NoError(t, err) {
+		assert.Equal(t, "AKIDROTATED", v.AccessKeyID)
+	}
+}
+
+func TestSAMLAssertion(t *testing.T) {
+	f, err := ioutil.TempFile("", "assertion-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer os.Remove(f.Name())
+
+	if err := ioutil.WriteFile(f.Name(), []byte("PHNhbWw+\n"), 0600); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	assertion, err := samlAssertion(&SAMLConfig{PrincipalArn: "provider", AssertionFile: f.Name()})
+	if assert.NoError(t, err) {
+		a, err := assertion(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "PHNhbWw+", a)
+	}
+
+	assertion, err = samlAssertion(&SAMLConfig{PrincipalArn: "provider", AssertionCommand: []string{"echo", "PHNhbWw+"}})
+	if assert.NoError(t, err) {
+		a, err := assertion(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "PHNhbWw+", a)
+	}
+
+	assertion, err = samlAssertion(&SAMLConfig{PrincipalArn: "provider", AssertionCommand: []string{"false"}})
+	if assert.NoError(t, err) {
+		_, err := assertion(context.Background())
+		assert.Error(t, err)
+	}
+
+	_, err = samlAssertion(&SAMLConfig{AssertionFile: f.Name()})
+	assert.Error(t, err)
+
+	_, err = samlAssertion(&SAMLConfig{PrincipalArn: "provider"})
+	assert.Error(t, err)
+
+	_, err = samlAssertion(&SAMLConfig{PrincipalArn: "provider", AssertionFile: f.Name(), AssertionCommand: []string{"echo"}})
+	assert.Error(t, err)
+}
+
+func TestSTSClientsChain(t *testing.T) {
+	clients := newSTSClients("", "")
+
+	sources, err := clients.chain(SourceChain{{Profile: "sso"}, {Env: true}}, "")
+	if assert.NoError(t, err) && assert.Len(t, sources, 2) {
+		assert.Equal(t, "profile sso", sources[0].Name)
+		assert.Equal(t, "env", sources[1].Name)
+	}
+
+	_, err = clients.chain(SourceChain{{Profile: "sso", Env: true}}, "")
+	assert.EqualError(t, err, "source 0: profile and env are exclusive")
+
+	_, err = clients.chain(SourceChain{{Env: true}, {}}, "")
+	assert.EqualError(t, err, "source 1: profile or env is required")
+}
+
+func TestSessionCredentials(t *testing.T) {
+	defer os.Setenv("AWS_CONFIG_FILE", os.Getenv("AWS_CONFIG_FILE"))
+	os.Setenv("AWS_CONFIG_FILE", "/nonexistent")
+
+	_, err := sessionCredentials("missing", nil).Get()
+	assert.Error(t, err)
+}
@@ -1,22 +1,276 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 )
 
+// Duration is a time.Duration that is written in JSON as a string, e.g. "5s".
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %s", b)
+	}
+
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = v
+	return nil
+}
+
 type CredentialsConfig struct {
 	File    string `json:"file"`    // location of AWS credentials file
 	Profile string `json:"profile"` // AWS credentials profile used by STS client
 }
 
-type RolesConfig map[string]string // collection of role alias->ARN pairs
+type STSHTTPConfig struct {
+	Proxy   string    `json:"proxy,omitempty"`   // proxy URL of STS calls, in place of HTTPS_PROXY and NO_PROXY
+	Timeout *Duration `json:"timeout,omitempty"` // bound on each STS call, including reading its response
+}
+
+type CacheConfig struct {
+	File   string `json:"file"`              // where credentials are kept across restarts, encrypted
+	KeyEnv string `json:"key_env,omitempty"` // environment variable holding the base64 key
+}
+
+type CredentialsFileConfig struct {
+	File    string `json:"file"`              // AWS credentials file the active role's credentials are written to
+	Profile string `json:"profile,omitempty"` // profile they're written as; "finto" by default
+}
+
+type ChaosConfig struct {
+	ExpirationMin Duration          `json:"expiration_min"`    // lower bound of reported credential lifetimes
+	ExpirationMax Duration          `json:"expiration_max"`    // upper bound of reported credential lifetimes
+	Latency       map[string]string `json:"latency,omitempty"` // injected latency by route pattern, or "*" for every route
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins"`           // origins allowed to call the control API
+	AllowedMethods []string `json:"allowed_methods,omitempty"` // defaults to the control API's methods
+	AllowedHeaders []string `json:"allowed_headers,omitempty"` // defaults to Content-Type
+}
+
+type ListenConfig struct {
+	Addr        string         `json:"addr,omitempty"`         // host:port serving metadata, and control unless split
+	ControlAddr string         `json:"control_addr,omitempty"` // separate host:port for the control API
+	Pinned      []PinnedListen `json:"pinned,omitempty"`       // further metadata listeners, each serving one role
+
+	TrustedProxies []string `json:"trusted_proxies,omitempty"` // proxies whose X-Forwarded-For is believed
+}
+
+type PinnedListen struct {
+	Addr string `json:"addr"` // host:port serving metadata as an instance of role
+	Role string `json:"role"` // role always served, regardless of the active role
+}
+
+type ReadinessConfig struct {
+	CheckSTS bool      `json:"check_sts"`       // check STS is reachable with the base credentials
+	Cache    *Duration `json:"cache,omitempty"` // how long a check's outcome is reused
+}
+
+type ServerHeaderConfig struct {
+	Metadata string `json:"metadata,omitempty"` // Server header of metadata responses; EC2ws when empty
+	Control  string `json:"control,omitempty"`  // Server header of control API responses; none when empty
+}
+
+type MetadataConfig struct {
+	Disabled     bool   `json:"disabled"`                // respond as if the metadata service is turned off
+	RequireToken bool   `json:"require_token"`           // require IMDSv2 session tokens, as HttpTokens=required
+	AmiId        string `json:"ami_id,omitempty"`        // served as ami-id; generated when empty
+	InstanceId   string `json:"instance_id,omitempty"`   // served as instance-id; generated when empty
+	InstanceType string `json:"instance_type,omitempty"` // served as instance-type; t2.micro when empty
+	IdentityKey  string `json:"identity_key,omitempty"`  // PEM RSA key signing the instance identity document
+	IdentityCert string `json:"identity_cert,omitempty"` // where the key's self-signed certificate is written
+}
+
+type RetryConfig struct {
+	MaxAttempts int       `json:"max_attempts"`        // total AssumeRole attempts for transient failures
+	MaxDelay    *Duration `json:"max_delay,omitempty"` // cap on the backoff between attempts
+}
+
+type AWSConfigConfig struct {
+	File string `json:"file"` // AWS config file; defaults to $AWS_CONFIG_FILE or ~/.aws/config
+}
+
+type WebhookConfig struct {
+	URL            string `json:"url"`                    // posted a notice each time credentials are refreshed
+	IncludeSecrets bool   `json:"include_secrets"`        // include the credentials themselves in notices
+	MaxAttempts    int    `json:"max_attempts,omitempty"` // delivery attempts per notice
+}
+
+type GroupConfig struct {
+	Primary string   `json:"primary"` // role served as the instance role while the group is active
+	Members []string `json:"members"` // companion roles served from /roles/group/{name}/{member}
+}
+
+type GroupsConfig map[string]GroupConfig // collection of group name->config pairs
+
+type FaultConfig struct {
+	Kind  string `json:"kind"`  // throttling, access_denied, or timeout
+	Count int    `json:"count"` // refreshes to fail before succeeding
+}
+
+type SAMLConfig struct {
+	PrincipalArn     string   `json:"principal_arn"`               // ARN of the IAM SAML provider trusted by the role
+	AssertionFile    string   `json:"assertion_file,omitempty"`    // file holding a base64 SAML assertion
+	AssertionCommand []string `json:"assertion_command,omitempty"` // command printing a base64 SAML assertion
+}
+
+type SourceConfig struct {
+	Profile string `json:"profile,omitempty"` // shared config or credentials profile, including SSO profiles
+	Env     bool   `json:"env,omitempty"`     // credentials from AWS_ACCESS_KEY_ID and related variables
+}
+
+// RoleConfig configures a role. It may be written as a bare ARN, or as an
+// object for roles that need more than an ARN.
+type RoleConfig struct {
+	Arn            string       `json:"arn"`
+	Type           string       `json:"type,omitempty"`            // "passthrough" serves the base credentials, assuming nothing
+	SourceProfile  string       `json:"source_profile,omitempty"`  // credentials profile the role is assumed from
+	SourceIdentity string       `json:"source_identity,omitempty"` // set on assumption, for CloudTrail
+	ProfileName    string       `json:"profile_name,omitempty"`    // instance profile name advertised by metadata
+	Region         string       `json:"region,omitempty"`          // region of the STS endpoint the role is assumed through
+	Duration       *Duration    `json:"duration,omitempty"`        // session duration requested on assumption
+	Aliases        []string     `json:"aliases,omitempty"`         // additional names the role is known by
+	Faults         *FaultConfig `json:"faults,omitempty"`          // injected failures; needs -fault-injection
+	SAML           *SAMLConfig  `json:"saml,omitempty"`            // assume with a SAML assertion, not credentials
+	AllowClients   []string     `json:"allow_clients,omitempty"`   // client IPs or CIDRs the role is served to
+	DenyClients    []string     `json:"deny_clients,omitempty"`    // client IPs or CIDRs the role is refused to
+	Sources        SourceChain  `json:"sources,omitempty"`         // credential sources tried in order
+	ExpectCaller   string       `json:"expect_caller,omitempty"`   // ARN pattern the base credentials' identity must match
+	CredentialType string       `json:"credential_type,omitempty"` // Type credentials are served with; AWS-HMAC unless the provider says otherwise
+}
+
+func (rc RoleConfig) MarshalJSON() ([]byte, error) {
+	if reflect.DeepEqual(rc, RoleConfig{Arn: rc.Arn}) {
+		return json.Marshal(rc.Arn)
+	}
+
+	type roleConfig RoleConfig
+	return json.Marshal(roleConfig(rc))
+}
+
+func (rc *RoleConfig) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &rc.Arn); err == nil {
+		return nil
+	}
+
+	type roleConfig RoleConfig
+	if err := decodeStrict(bytes.NewReader(b), (*roleConfig)(rc)); err != nil {
+		return err
+	}
+
+	// Passthrough roles serve the base credentials, assuming no role.
+	if rc.Arn == "" && rc.Type != "passthrough" {
+		return errors.New("arn is required")
+	}
+
+	return nil
+}
+
+type InstanceConfig struct {
+	DefaultRole string      `json:"default_role"`   // role the instance serves on startup
+	Roles       RolesConfig `json:"roles"`          // the instance's own roles
+	Addr        string      `json:"addr,omitempty"` // host:port serving the instance, besides /instances/{name}/
+}
+
+type InstancesConfig map[string]InstanceConfig // collection of instance name->config pairs
+
+// Decodes each instance in turn, so that errors name the instance at fault.
+func (ic *InstancesConfig) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil || raw == nil {
+		return err
+	}
+
+	instances := make(InstancesConfig, len(raw))
+	for _, name := range sortedKeys(raw) {
+		var instance InstanceConfig
+		if err := decodeStrict(bytes.NewReader(raw[name]), &instance); err != nil {
+			return fmt.Errorf("instance %s: %s", name, err)
+		}
+
+		if instance.DefaultRole == "" {
+			return fmt.Errorf("instance %s: default_role is required", name)
+		}
+
+		instances[name] = instance
+	}
+
+	*ic = instances
+	return nil
+}
+
+type SourceChain []SourceConfig // credential sources of a role, in the order tried
+
+type RolesConfig map[string]RoleConfig // collection of role alias->config pairs
+
+// Decodes each role in turn, so that errors name the role at fault.
+func (rc *RolesConfig) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil || raw == nil {
+		return err
+	}
+
+	roles := make(RolesConfig, len(raw))
+	for _, alias := range sortedKeys(raw) {
+		var role RoleConfig
+		if err := json.Unmarshal(raw[alias], &role); err != nil {
+			return fmt.Errorf("role %s: %s", alias, err)
+		}
+
+		roles[alias] = role
+	}
+
+	*rc = roles
+	return nil
+}
 
 type Config struct {
-	DefaultRole string            `json:"default_role"` // role served as instance profile on startup
-	Credentials CredentialsConfig `json:"credentials"`
-	Roles       RolesConfig       `json:"roles"`
+	DefaultRole      string                 `json:"default_role"`            // role served as instance profile on startup
+	FallbackRole     string                 `json:"fallback_role,omitempty"` // role served when the active role fails
+	Credentials      CredentialsConfig      `json:"credentials"`
+	CredentialsFile  *CredentialsFileConfig `json:"credentials_file,omitempty"`  // also write the active role's credentials to a credentials file
+	FieldNames       map[string]string      `json:"credential_fields,omitempty"` // metadata credential response field names, by EC2 name
+	AWSConfig        *AWSConfigConfig       `json:"aws_config,omitempty"`        // also serve the AWS config file's role profiles
+	Cache            *CacheConfig           `json:"cache,omitempty"`
+	Chaos            *ChaosConfig           `json:"chaos,omitempty"`
+	ClockSkew        *Duration              `json:"clock_skew,omitempty"` // allowance for the local clock disagreeing with STS's
+	CORS             *CORSConfig            `json:"cors,omitempty"`
+	Groups           GroupsConfig           `json:"groups,omitempty"`    // role groups activated together
+	Instances        InstancesConfig        `json:"instances,omitempty"` // further mocked instances, each with its own roles
+	Listen           *ListenConfig          `json:"listen,omitempty"`
+	MaxClockSkew     *Duration              `json:"max_clock_skew,omitempty"`     // disagreement with STS's clock warned of
+	MaxCredentialTTL *Duration              `json:"max_credential_ttl,omitempty"` // how long credentials are served after minting, whatever STS grants
+	MaxSTSCalls      int                    `json:"max_sts_calls,omitempty"`      // STS calls in flight at once, across roles; unlimited when zero
+	Metadata         *MetadataConfig        `json:"metadata,omitempty"`
+	RefreshAhead     string                 `json:"refresh_ahead,omitempty"` // background refresh lead, e.g. "5m", or "80%" of lifetime
+	Readiness        *ReadinessConfig       `json:"readiness,omitempty"`
+	Retry            *RetryConfig           `json:"retry,omitempty"`
+	Roles            RolesConfig            `json:"roles"`
+	ServerHeader     *ServerHeaderConfig    `json:"server_header,omitempty"`
+	StateFile        string                 `json:"state_file,omitempty"`   // where the active role is kept across restarts
+	STSEndpoint      string                 `json:"sts_endpoint,omitempty"` // STS endpoint of roles without a region
+	STSHTTP          *STSHTTPConfig         `json:"sts_http,omitempty"`     // how STS is called, e.g. through a proxy
+	Webhook          *WebhookConfig         `json:"webhook,omitempty"`
 }
 
 func LoadConfig(file string) (*Config, error) {
@@ -27,14 +281,51 @@ func LoadConfig(file string) (*Config, error) {
 
 	var c *Config
 
-	decoder := json.NewDecoder(cf)
-	if err := decoder.Decode(&c); err != nil {
+	if err := decodeStrict(cf, &c); err != nil {
 		return nil, fmt.Errorf("failed to decode %s: %s", file, err)
 	}
 
+	if c.AWSConfig != nil {
+		roles, defaultRole, err := loadAWSProfiles(awsConfigFile(c.AWSConfig.File))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.mergeAWSProfiles(roles, defaultRole); err != nil {
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
+// Decodes JSON from r into v, refusing fields v doesn't have, so that a
+// misspelled setting fails loudly rather than being ignored.
+func decodeStrict(r io.Reader, v interface{}) error {
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err != nil && strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+	}
+
+	return err
+}
+
+// Overrides the role activated on startup.
+const activeRoleEnv = "FINTO_ACTIVE_ROLE"
+
+// Returns the role to activate on startup, and whether it was chosen by the
+// FINTO_ACTIVE_ROLE environment variable rather than default_role.
+func (c *Config) InitialRole() (string, bool) {
+	if role := os.Getenv(activeRoleEnv); role != "" {
+		return role, true
+	}
+
+	return c.DefaultRole, false
+}
+
 func (c *Config) String() string {
 	config, _ := json.MarshalIndent(c, "", "  ")
 	return string(config[:])
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -46,8 +48,8 @@ func TestConfigFileStringer(t *testing.T) {
 			Profile: "a",
 		},
 		Roles: RolesConfig{
-			"1": "arn",
-			"2": "arn",
+			"1": {Arn: "arn"},
+			"2": {Arn: "arn"},
 		},
 	}
 
@@ -65,8 +67,8 @@ func TestLoadsConfigFile(t *testing.T) {
 			Profile: "a",
 		},
 		Roles: RolesConfig{
-			"1": "arn",
-			"2": "arn",
+			"1": {Arn: "arn"},
+			"2": {Arn: "arn"},
 		},
 	}
 
@@ -80,3 +82,93 @@ func TestLoadMissingConfigFile(t *testing.T) {
 	_, err := LoadConfig("")
 	assert.Error(t, err)
 }
+
+func TestLoadConfigStrict(t *testing.T) {
+	cases := []struct {
+		config, err string
+	}{
+		{`{"default_role": "1", "roels": {}}`, `unknown field "roels"`},
+		{`{"roles": {"1": {"arn": "arn", "sorce_profile": "base"}}}`, `role 1: unknown field "sorce_profile"`},
+		{`{"roles": {"1": {"source_profile": "base"}}}`, `role 1: arn is required`},
+		{`{"listen": {"adr": "127.0.0.1:80"}}`, `unknown field "adr"`},
+		{`{"instances": {"staging": {"roles": {"app": "arn"}}}}`, `instance staging: default_role is required`},
+		{`{"instances": {"staging": {"default_role": "app", "roles": {"app": {"arm": "arn"}}}}}`, `instance staging: role app: unknown field "arm"`},
+	}
+
+	for _, c := range cases {
+		file := writeValidateConfig(t, c.config)
+
+		_, err := LoadConfig(file)
+		if assert.Error(t, err, c.config) {
+			assert.Equal(t, "failed to decode "+file+": "+c.err, err.Error())
+		}
+
+		os.Remove(file)
+	}
+
+	// Passthrough roles need no ARN.
+	file := writeValidateConfig(t, `{"roles": {"1": {"type": "passthrough"}}}`)
+	defer os.Remove(file)
+
+	_, err := LoadConfig(file)
+	assert.NoError(t, err)
+}
+
+func TestInitialRole(t *testing.T) {
+	c := &Config{DefaultRole: "1"}
+
+	os.Unsetenv(activeRoleEnv)
+	role, fromEnv := c.InitialRole()
+	assert.Equal(t, "1", role)
+	assert.False(t, fromEnv)
+
+	os.Setenv(activeRoleEnv, "2")
+	defer os.Unsetenv(activeRoleEnv)
+
+	role, fromEnv = c.InitialRole()
+	assert.Equal(t, "2", role)
+	assert.True(t, fromEnv)
+}
+
+func TestDuration(t *testing.T) {
+	var d Duration
+
+	if assert.NoError(t, json.Unmarshal([]byte(`"1m30s"`), &d)) {
+		assert.Equal(t, 90*time.Second, d.Duration)
+	}
+
+	b, err := json.Marshal(d)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `"1m30s"`, string(b))
+	}
+
+	assert.Error(t, json.Unmarshal([]byte(`90`), &d))
+	assert.Error(t, json.Unmarshal([]byte(`"soon"`), &d))
+}
+
+func TestRoleConfig(t *testing.T) {
+	var roles RolesConfig
+
+	b := []byte(`{"1":"arn","2":{"arn":"arn2","source_profile":"base"},"3":{"arn":"arn3","aliases":["three"]},"4":{"arn":"arn4","source_identity":"demo"},"5":{"arn":"arn5","faults":{"kind":"timeout","count":2}},"6":{"arn":"arn6","profile_name":"six"},"7":{"arn":"arn7","saml":{"principal_arn":"provider","assertion_file":"assertion"}},"8":{"arn":"arn8","allow_clients":["127.0.0.1"],"deny_clients":["10.0.0.0/8"]},"9":{"arn":"arn9","duration":"2h0m0s"},"a":{"arn":"arna","sources":[{"profile":"sso"},{"env":true}]},"b":{"arn":"","type":"passthrough"}}`)
+
+	if assert.NoError(t, json.Unmarshal(b, &roles)) {
+		assert.Equal(t, RolesConfig{
+			"1": {Arn: "arn"},
+			"2": {Arn: "arn2", SourceProfile: "base"},
+			"3": {Arn: "arn3", Aliases: []string{"three"}},
+			"4": {Arn: "arn4", SourceIdentity: "demo"},
+			"5": {Arn: "arn5", Faults: &FaultConfig{Kind: "timeout", Count: 2}},
+			"6": {Arn: "arn6", ProfileName: "six"},
+			"7": {Arn: "arn7", SAML: &SAMLConfig{PrincipalArn: "provider", AssertionFile: "assertion"}},
+			"8": {Arn: "arn8", AllowClients: []string{"127.0.0.1"}, DenyClients: []string{"10.0.0.0/8"}},
+			"9": {Arn: "arn9", Duration: &Duration{2 * time.Hour}},
+			"a": {Arn: "arna", Sources: SourceChain{{Profile: "sso"}, {Env: true}}},
+			"b": {Type: "passthrough"},
+		}, roles)
+	}
+
+	out, err := json.Marshal(roles)
+	if assert.NoError(t, err) {
+		assert.Equal(t, string(b), string(out))
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Environment variables that configure finto on top of, or in place of, its
+// config file, for container platforms. They override the file's settings.
+const (
+	defaultRoleEnv = "FINTO_DEFAULT_ROLE" // overrides default_role
+	listenAddrEnv  = "FINTO_LISTEN_ADDR"  // overrides listen.addr
+	stsEndpointEnv = "FINTO_STS_ENDPOINT" // overrides sts_endpoint
+	roleAliasEnv   = "FINTO_ROLE_ALIAS"   // alias of a role added, or replaced, by FINTO_ROLE_ARN
+	roleArnEnv     = "FINTO_ROLE_ARN"     // ARN of the role FINTO_ROLE_ALIAS names
+)
+
+// Loads the config file and merges the environment's settings over it. The
+// file may be missing if the environment configures a role, in which case the
+// environment alone configures finto.
+func loadConfig(file string) (*Config, error) {
+	c, err := LoadConfig(file)
+	if err != nil {
+		if _, serr := os.Stat(file); !os.IsNotExist(serr) || os.Getenv(roleArnEnv) == "" {
+			return nil, err
+		}
+
+		c = &Config{}
+	}
+
+	if err := c.mergeEnv(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Overrides c's settings with those set in the environment. A role given by
+// FINTO_ROLE_ALIAS and FINTO_ROLE_ARN replaces any of the same alias, and is
+// the default role if c names none.
+func (c *Config) mergeEnv() error {
+	if role := os.Getenv(defaultRoleEnv); role != "" {
+		c.DefaultRole = role
+	}
+
+	if addr := os.Getenv(listenAddrEnv); addr != "" {
+		if c.Listen == nil {
+			c.Listen = &ListenConfig{}
+		}
+
+		c.Listen.Addr = addr
+	}
+
+	if endpoint := os.Getenv(stsEndpointEnv); endpoint != "" {
+		c.STSEndpoint = endpoint
+	}
+
+	alias, arn := os.Getenv(roleAliasEnv), os.Getenv(roleArnEnv)
+	if alias == "" && arn == "" {
+		return nil
+	}
+
+	if alias == "" || arn == "" {
+		return fmt.Errorf("%s and %s must be set together", roleAliasEnv, roleArnEnv)
+	}
+
+	if c.Roles == nil {
+		c.Roles = make(RolesConfig)
+	}
+
+	c.Roles[alias] = RoleConfig{Arn: arn}
+
+	if c.DefaultRole == "" {
+		c.DefaultRole = alias
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Sets environment variables for the duration of a test, returning a func
+// that unsets them.
+func setEnv(vars map[string]string) func() {
+	for k, v := range vars {
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestLoadConfigEnvOnly(t *testing.T) {
+	defer setEnv(map[string]string{
+		listenAddrEnv:  "0.0.0.0:16925",
+		stsEndpointEnv: "https://sts.example.com",
+		roleAliasEnv:   "app",
+		roleArnEnv:     "arn:aws:iam::123456789012:role/app",
+	})()
+
+	c, err := loadConfig("/nonexistent/.fintorc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, &Config{
+			DefaultRole: "app",
+			Listen:      &ListenConfig{Addr: "0.0.0.0:16925"},
+			Roles:       RolesConfig{"app": {Arn: "arn:aws:iam::123456789012:role/app"}},
+			STSEndpoint: "https://sts.example.com",
+		}, c)
+	}
+
+	// The default role may be another than the environment's role.
+	os.Setenv(defaultRoleEnv, "other")
+	defer os.Unsetenv(defaultRoleEnv)
+
+	c, err = loadConfig("/nonexistent/.fintorc")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "other", c.DefaultRole)
+	}
+}
+
+func TestLoadConfigEnvOnlyNeedsRole(t *testing.T) {
+	defer setEnv(map[string]string{listenAddrEnv: "0.0.0.0:16925"})()
+
+	_, err := loadConfig("/nonexistent/.fintorc")
+	assert.Error(t, err)
+}
+
+func TestLoadConfigEnvOverridesFile(t *testing.T) {
+	file := setupConfigTests(t)
+	defer teardownConfigTests(file)
+
+	defer setEnv(map[string]string{
+		defaultRoleEnv: "2",
+		roleAliasEnv:   "1",
+		roleArnEnv:     "arn-from-env",
+	})()
+
+	c, err := loadConfig(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "2", c.DefaultRole)
+		assert.Equal(t, RolesConfig{
+			"1": {Arn: "arn-from-env"},
+			"2": {Arn: "arn"},
+		}, c.Roles)
+		assert.Equal(t, CredentialsConfig{File: "a", Profile: "a"}, c.Credentials)
+	}
+}
+
+func TestMergeEnvIncompleteRole(t *testing.T) {
+	defer setEnv(map[string]string{roleAliasEnv: "app"})()
+
+	assert.Error(t, (&Config{}).mergeEnv())
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const initUsage = "usage: finto init [-force] [-aws-config file] [-credentials file] [config]"
+
+// Runs the init subcommand, which writes a starter config serving the role
+// profiles of the AWS config file. The config defaults to the -config flag's,
+// and isn't overwritten without -force. Returns the process exit code.
+func runInit(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	force := fs.Bool("force", false, "overwrite an existing config")
+	awsConfig := fs.String("aws-config", awsConfigFile(""), "AWS config file to read role profiles from")
+	credentials := fs.String("credentials", awsCredentialsFile(), "AWS credentials file roles are assumed with")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	file := *fintorc
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		file = fs.Arg(0)
+	default:
+		fmt.Fprintln(stderr, initUsage)
+		return 2
+	}
+
+	if _, err := os.Stat(file); err == nil && !*force {
+		fmt.Fprintf(stderr, "finto: %s already exists; use -force to overwrite it\n", file)
+		return 1
+	}
+
+	config, err := starterConfig(*awsConfig, *credentials)
+	if err != nil {
+		fmt.Fprintln(stderr, "finto:", err)
+		return 1
+	}
+
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		fmt.Fprintln(stderr, "finto:", err)
+		return 1
+	}
+
+	if err := ioutil.WriteFile(file, append(b, '\n'), 0600); err != nil {
+		fmt.Fprintln(stderr, "finto:", err)
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: wrote %d roles\n", file, len(config.Roles))
+	return 0
+}
+
+// Returns a config serving each profile of the AWS config file that assumes a
+// role, aliased by profile name, assumed with the credentials file's default
+// profile, or else its first.
+func starterConfig(awsConfig, credentials string) (*Config, error) {
+	roles, defaultRole, err := loadAWSProfiles(awsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("no profiles in %s have a role_arn", awsConfig)
+	}
+
+	profiles, err := loadCredentialsProfiles(credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &Config{
+		DefaultRole: defaultRole,
+		Credentials: CredentialsConfig{File: credentials},
+		Roles:       roles,
+	}
+
+	if config.DefaultRole == "" {
+		config.DefaultRole = sortedKeys(roles)[0]
+	}
+
+	for i, p := range profiles {
+		if i == 0 || p == "default" {
+			config.Credentials.Profile = p
+		}
+	}
+
+	return config, nil
+}
+
+// Returns the location of the AWS credentials file: $AWS_SHARED_CREDENTIALS_FILE,
+// else ~/.aws/credentials.
+func awsCredentialsFile() string {
+	if env := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); env != "" {
+		return env
+	}
+
+	dir, err := homeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, ".aws", "credentials")
+}
+
+// Returns the names of an AWS credentials file's profiles, sorted.
+func loadCredentialsProfiles(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read AWS credentials: %s", err)
+	}
+	defer f.Close()
+
+	var profiles []string
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 1 && line[0] == '[' && line[len(line)-1] == ']' {
+			profiles = append(profiles, strings.TrimSpace(line[1:len(line)-1]))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read AWS credentials: %s", err)
+	}
+
+	sort.Strings(profiles)
+	return profiles, nil
+}
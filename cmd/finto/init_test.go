@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInit(t *testing.T) {
+	awsConfig := writeAWSConfig(t, awsConfigExample)
+	defer os.Remove(awsConfig)
+
+	credentials := writeAWSConfig(t, "[base]\naws_access_key_id = AKIAEXAMPLE\n\n[default]\naws_access_key_id = AKIAEXAMPLE\n")
+	defer os.Remove(credentials)
+
+	dir, err := ioutil.TempDir("", "finto-init")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "fintorc")
+	args := []string{"-aws-config", awsConfig, "-credentials", credentials, file}
+
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 0, runInit(args, &stdout, &stderr))
+	assert.Equal(t, file+": wrote 2 roles\n", stdout.String())
+
+	config, err := LoadConfig(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "default", config.DefaultRole)
+		assert.Equal(t, CredentialsConfig{File: credentials, Profile: "default"}, config.Credentials)
+		assert.Equal(t, RolesConfig{
+			"default": {Arn: "arn:aws:iam::123456789012:role/default", Region: "us-east-1"},
+			"admin":   {Arn: "arn:aws:iam::123456789012:role/admin", SourceProfile: "base", Region: "us-west-2"},
+		}, config.Roles)
+		assert.Empty(t, validateConfig(config))
+	}
+
+	// An existing config is kept unless forced.
+	stderr.Reset()
+	assert.Equal(t, 1, runInit(args, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "use -force")
+
+	assert.Equal(t, 0, runInit(append([]string{"-force"}, args...), &stdout, &stderr))
+}
+
+func TestInitWithoutRoles(t *testing.T) {
+	awsConfig := writeAWSConfig(t, "[profile base]\nregion = us-west-2\n")
+	defer os.Remove(awsConfig)
+
+	var stdout, stderr bytes.Buffer
+
+	file := filepath.Join(os.TempDir(), "finto-init-unwritten")
+	assert.Equal(t, 1, runInit([]string{"-aws-config", awsConfig, file}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "have a role_arn")
+
+	_, err := os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/threadwaste/finto"
+)
+
+// Returns the further instances config mocks, sorted by name, each with a role
+// set of its own assumed through clients, bounded by limit with the others.
+func newInstances(config *Config, clients *stsClients, inFlight finto.RefreshingPolicy, limit finto.CallLimit) ([]*finto.Instance, error) {
+	names := make([]string, 0, len(config.Instances))
+	for name := range config.Instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	instances := make([]*finto.Instance, 0, len(names))
+	for _, name := range names {
+		ic := config.Instances[name]
+
+		rs, err := newRoleSet(config, ic.Roles, clients, inFlight, limit)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %s", name, err)
+		}
+
+		fc, err := finto.InitFintoContext(rs, ic.DefaultRole)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %s", name, err)
+		}
+
+		instance, err := finto.NewInstance(name, fc)
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/threadwaste/finto"
+)
+
+func TestNewInstances(t *testing.T) {
+	config := &Config{
+		Instances: InstancesConfig{
+			"staging": {DefaultRole: "app", Roles: RolesConfig{"app": {Arn: "arn:aws:iam::123456789012:role/app"}}},
+			"prod":    {DefaultRole: "app", Roles: RolesConfig{"app": {Arn: "arn:aws:iam::210987654321:role/app"}}},
+		},
+	}
+
+	instances, err := newInstances(config, newSTSClients("", ""), finto.RefreshingBlock, nil)
+	if assert.NoError(t, err) && assert.Len(t, instances, 2) {
+		assert.Equal(t, "prod", instances[0].Name())
+		assert.Equal(t, "staging", instances[1].Name())
+	}
+
+	// An instance's default role must be one of its own.
+	config.Instances["staging"] = InstanceConfig{DefaultRole: "missing", Roles: config.Instances["staging"].Roles}
+	_, err = newInstances(config, newSTSClients("", ""), finto.RefreshingBlock, nil)
+	assert.EqualError(t, err, `instance staging: unknown default role "missing": valid roles are app`)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// Returns an error with setup hints if addr is a link-local address, such as
+// the EC2 meta-data address, that is not assigned to a local interface.
+func checkListenAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLinkLocalUnicast() {
+		return nil
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return err
+	}
+
+	if hasAddr(addrs, ip) {
+		return nil
+	}
+
+	return fmt.Errorf("%s is not assigned to a local interface; %s", host, aliasHint(host))
+}
+
+func hasAddr(addrs []net.Addr, ip net.IP) bool {
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns a hint for aliasing host to the loopback interface.
+func aliasHint(host string) string {
+	switch runtime.GOOS {
+	case "darwin", "freebsd", "openbsd":
+		return fmt.Sprintf("try: sudo ifconfig lo0 alias %s", host)
+	case "linux":
+		return fmt.Sprintf("try: sudo ip addr add %s/32 dev lo", host)
+	default:
+		return fmt.Sprintf("alias %s to a loopback interface", host)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckListenAddr(t *testing.T) {
+	assert.NoError(t, checkListenAddr("127.0.0.1:16925"))
+	assert.NoError(t, checkListenAddr(":16925"))
+	assert.Error(t, checkListenAddr("missing-port"))
+}
+
+func TestHasAddr(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.1/8")
+	_, alias, _ := net.ParseCIDR("169.254.169.254/32")
+
+	ip := net.ParseIP("169.254.169.254")
+
+	assert.False(t, hasAddr([]net.Addr{loopback}, ip))
+	assert.True(t, hasAddr([]net.Addr{loopback, alias}, ip))
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/gorilla/handlers"
 	"github.com/threadwaste/finto"
 )
@@ -19,9 +20,24 @@ import (
 var (
 	fintorc = flag.String("config", defaultRC(), "location of config file")
 
-	addr    = flag.String("addr", "169.254.169.254", "bind to addr")
-	logfile = flag.String("log", "", "log http to file")
-	port    = flag.Uint("port", 16925, "listen on port")
+	addr        = flag.String("addr", "169.254.169.254", "bind to addr")
+	controlAddr = flag.String("control-addr", "", "serve the control API on a separate host:port")
+	logfile     = flag.String("log", "", "log http to file")
+	port        = flag.Uint("port", 16925, "listen on port")
+
+	cycle = flag.Bool("cycle-on-usr1", false, "cycle the active role on SIGUSR1")
+
+	stsTimeout   = flag.Duration("sts-timeout", 0, "bound on minting credentials per request")
+	refreshAhead = flag.String("refresh-ahead", "5m", "refresh the active role this long before expiry, or at a percentage of its lifetime; 0 to disable")
+	webUI        = flag.Bool("ui", false, "serve the web UI at /")
+
+	debugEndpoints = flag.Bool("debug-endpoints", false, "serve debugging endpoints, such as /roles/{alias}/assume-details")
+	faultInjection = flag.Bool("fault-injection", false, "inject the failures configured for roles")
+	latency        = flag.String("latency", "0", "delay metadata credentials by a duration, or a random one in a range like 100ms-2s")
+	expiredPolicy  = flag.String("expired-policy", "error", "serve an error or stale credentials when a refresh fails")
+	refreshing     = flag.String("refreshing-policy", "block", "block, serve stale credentials, or respond unavailable while expired credentials are refreshed")
+	readOnly       = flag.Bool("read-only", false, "refuse control API requests that switch roles or change settings")
+	verbose        = flag.Bool("verbose", false, "log each credential served, and whether it came from the cache or STS")
 
 	printver = flag.Bool("version", false, "print version")
 )
@@ -30,45 +46,618 @@ func main() {
 	flag.Parse()
 
 	if *printver {
-		fmt.Println("finto", finto.Version)
+		fmt.Println(finto.VersionString())
 		os.Exit(0)
 	}
 
+	if flag.Arg(0) == "use" {
+		os.Exit(runUse(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
+	if flag.Arg(0) == "init" {
+		os.Exit(runInit(flag.Args()[1:], os.Stdout, os.Stderr))
+	}
+
 	logdest, err := prepareLog(*logfile)
 	if err != nil {
 		panic(err)
 	}
 	defer logdest.Close()
 
-	config, err := LoadConfig(*fintorc)
+	// Credentials' secrets are kept out of the log, whatever logs them.
+	log.SetOutput(finto.RedactingWriter(os.Stderr))
+
+	log.Println("starting", finto.VersionString())
+
+	config, err := loadConfig(*fintorc)
 	if err != nil {
 		panic(err)
 	}
 
-	// SharedCredentialsProvider defaults to file=~/.aws/credentials and
-	// profile=default when provided zero-value strings
-	rs := finto.NewRoleSet(sts.New(session.New(), &aws.Config{
-		Credentials: credentials.NewSharedCredentials(
-			config.Credentials.File,
-			config.Credentials.Profile,
-		),
-	}))
+	clients := newSTSClients(config.Credentials.File, config.Credentials.Profile)
+	clients.endpoint = config.STSEndpoint
 
-	for alias, arn := range config.Roles {
-		rs.SetRole(alias, arn)
+	if config.STSHTTP != nil {
+		if clients.http, err = newSTSHTTPClient(config.STSHTTP); err != nil {
+			fmt.Fprintln(os.Stderr, "finto:", err)
+			os.Exit(2)
+		}
 	}
 
-	context, err := finto.InitFintoContext(rs, config.DefaultRole)
+	inFlight, err := finto.ParseRefreshingPolicy(*refreshing)
 	if err != nil {
-		fmt.Println("warning: default role not set:", err)
+		fmt.Fprintln(os.Stderr, "finto:", err)
+		os.Exit(2)
 	}
 
-	router := finto.FintoRouter(&context)
-	handler := handlers.LoggingHandler(logdest, router)
-	err = http.ListenAndServe(fmt.Sprint(*addr, ":", *port), handler)
+	// max_sts_calls bounds STS calls across every instance's roles, so their
+	// role sets share one limit.
+	limit := finto.NewCallLimit(config.MaxSTSCalls)
+
+	rs, err := newRoleSet(config, config.Roles, clients, inFlight, limit)
 	if err != nil {
 		panic(err)
 	}
+
+	cached := false
+	if config.Cache != nil {
+		if err := restoreCache(config.Cache, rs); err != nil {
+			fmt.Println("warning: credentials not cached:", err)
+		} else {
+			cached = true
+		}
+	}
+
+	role, fromEnv := config.InitialRole()
+
+	fc, err := finto.InitFintoContext(rs, role)
+	if err != nil {
+		if fromEnv {
+			fmt.Fprintf(os.Stderr, "finto: %s: %s\n", activeRoleEnv, err)
+			os.Exit(1)
+		}
+
+		fmt.Println("warning:", err)
+	}
+
+	fc.SetCredentialsTimeout(*stsTimeout)
+	fc.SetWebUI(*webUI)
+	fc.SetDebugEndpoints(*debugEndpoints)
+	fc.SetReadOnly(*readOnly)
+	fc.SetVerbose(*verbose)
+
+	if config.Readiness != nil && config.Readiness.CheckSTS {
+		cache := finto.DefaultReadinessCache
+		if config.Readiness.Cache != nil {
+			cache = config.Readiness.Cache.Duration
+		}
+
+		fc.SetReadinessCheck(clients.base(""), cache)
+	}
+
+	expired, err := finto.ParseExpiredPolicy(*expiredPolicy)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "finto:", err)
+		os.Exit(2)
+	}
+	fc.SetExpiredPolicy(expired)
+
+	if err := fc.SetFallbackRole(config.FallbackRole); err != nil {
+		fmt.Println("warning: fallback role not set:", err)
+	}
+
+	if len(config.Groups) > 0 {
+		groups := make(map[string]finto.RoleGroup)
+		for name, g := range config.Groups {
+			groups[name] = finto.RoleGroup{Primary: g.Primary, Members: g.Members}
+		}
+
+		if err := fc.SetRoleGroups(groups); err != nil {
+			panic(err)
+		}
+	}
+
+	// The persisted state outlives default_role, but not FINTO_ACTIVE_ROLE.
+	// Read-only, the startup role is fixed, so there's nothing to persist.
+	if config.StateFile != "" && *readOnly {
+		fmt.Println("warning: ignoring state_file with -read-only")
+	} else if config.StateFile != "" {
+		if s, err := finto.LoadState(config.StateFile); err != nil && !os.IsNotExist(err) {
+			fmt.Println("warning: state not restored:", err)
+		} else if err == nil && !fromEnv {
+			if err := fc.Restore(s); err != nil {
+				fmt.Println("warning: state not restored:", err)
+			}
+		}
+
+		fc.SetStateFile(config.StateFile)
+	}
+
+	if config.CredentialsFile != nil {
+		if err := checkCredentialsFile(config); err != nil {
+			fmt.Fprintln(os.Stderr, "finto: credentials_file:", err)
+			os.Exit(2)
+		}
+
+		profile := config.CredentialsFile.Profile
+		if profile == "" {
+			profile = defaultCredentialsFileProfile
+		}
+
+		fc.SetCredentialsFile(finto.NewCredentialsFile(config.CredentialsFile.File, profile))
+	}
+
+	latencyMin, latencyMax, err := finto.ParseLatency(*latency)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "finto:", err)
+		os.Exit(2)
+	}
+	fc.SetLatency(latencyMin, latencyMax)
+
+	if config.Chaos != nil {
+		fc.SetExpirationOverride(
+			config.Chaos.ExpirationMin.Duration,
+			config.Chaos.ExpirationMax.Duration,
+		)
+
+		for pattern, l := range config.Chaos.Latency {
+			min, max, err := finto.ParseLatency(l)
+			if err == nil {
+				err = fc.SetRouteLatency(pattern, min, max)
+			}
+
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "finto: chaos:", err)
+				os.Exit(2)
+			}
+		}
+	}
+
+	if err := fc.SetCredentialFields(config.FieldNames); err != nil {
+		fmt.Fprintln(os.Stderr, "finto:", err)
+		os.Exit(2)
+	}
+
+	if config.CORS != nil {
+		fc.SetCORS(finto.CORSConfig{
+			AllowedOrigins: config.CORS.AllowedOrigins,
+			AllowedMethods: config.CORS.AllowedMethods,
+			AllowedHeaders: config.CORS.AllowedHeaders,
+		})
+	}
+
+	if config.Metadata != nil {
+		fc.SetMetadataDisabled(config.Metadata.Disabled)
+		fc.SetTokenRequired(config.Metadata.RequireToken)
+		fc.SetInstanceMetadata(finto.InstanceMetadata{
+			AmiId:        config.Metadata.AmiId,
+			InstanceId:   config.Metadata.InstanceId,
+			InstanceType: config.Metadata.InstanceType,
+		})
+
+		if config.Metadata.IdentityKey != "" {
+			if err := setIdentityKey(fc, config.Metadata); err != nil {
+				fmt.Println("warning: instance identity not signed:", err)
+			}
+		}
+	}
+
+	if sh := config.ServerHeader; sh != nil {
+		metadata := sh.Metadata
+		if metadata == "" {
+			metadata = "EC2ws"
+		}
+
+		fc.SetServerHeaders(metadata, sh.Control)
+	}
+
+	instances, err := newInstances(config, clients, inFlight, limit)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, i := range instances {
+		if err := fc.AddInstance(i); err != nil {
+			panic(err)
+		}
+	}
+
+	if *cycle && *readOnly {
+		fmt.Println("warning: ignoring -cycle-on-usr1 with -read-only")
+	} else if *cycle {
+		cycleOnSignal(fc)
+	}
+
+	listen, control := listenAddrs(config)
+
+	addrs := []string{listen}
+	if control != "" {
+		addrs = append(addrs, control)
+	}
+
+	var pinned []PinnedListen
+	if config.Listen != nil {
+		pinned = config.Listen.Pinned
+	}
+
+	for _, p := range pinned {
+		addrs = append(addrs, p.Addr)
+	}
+
+	// Instances may also be served on listeners of their own.
+	var served []*finto.Instance
+	for _, i := range instances {
+		if addr := config.Instances[i.Name()].Addr; addr != "" {
+			addrs = append(addrs, addr)
+			served = append(served, i)
+		}
+	}
+
+	// Sockets passed by systemd are already bound, though perhaps to a
+	// privileged port finto couldn't bind itself.
+	activated, err := activationListeners(listenFdsStart)
+	if err != nil {
+		panic(err)
+	}
+
+	for i, a := range addrs {
+		if i < len(activated) {
+			continue
+		}
+
+		if err := checkListenAddr(a); err != nil {
+			fmt.Println("warning:", err)
+		}
+	}
+
+	listeners, err := bindListeners(addrs, activated)
+	if err != nil {
+		panic(err)
+	}
+
+	// Requests are logged by the address of the client behind any trusted
+	// proxy, as client ACLs see it.
+	var proxies *finto.TrustedProxies
+	if config.Listen != nil && len(config.Listen.TrustedProxies) > 0 {
+		if proxies, err = finto.ParseTrustedProxies(config.Listen.TrustedProxies); err != nil {
+			fmt.Fprintln(os.Stderr, "finto: trusted_proxies:", err)
+			os.Exit(2)
+		}
+	}
+
+	handler := func(h http.Handler) http.Handler {
+		return finto.TrustedProxyHandler(proxies, logHandler(logdest, h))
+	}
+
+	router := finto.FintoRouter(fc)
+	if control != "" {
+		router = finto.MetadataRouter(fc)
+	}
+
+	servers := []*http.Server{{
+		Addr:    listen,
+		Handler: handler(router),
+	}}
+
+	if control != "" {
+		servers = append(servers, &http.Server{
+			Addr:    control,
+			Handler: handler(finto.ControlRouter(fc)),
+		})
+	}
+
+	for _, p := range pinned {
+		router, err := finto.PinnedMetadataRouter(fc, p.Role)
+		if err != nil {
+			panic(fmt.Errorf("listener %s: %s", p.Addr, err))
+		}
+
+		servers = append(servers, &http.Server{
+			Addr:    p.Addr,
+			Handler: handler(router),
+		})
+	}
+
+	for _, i := range served {
+		servers = append(servers, &http.Server{
+			Addr:    config.Instances[i.Name()].Addr,
+			Handler: handler(i),
+		})
+	}
+
+	window, err := refreshWindow(config)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "finto:", err)
+		os.Exit(2)
+	}
+
+	refresher, stopRefresher := context.WithCancel(context.Background())
+	if !window.IsZero() {
+		go fc.RunRefresher(refresher, window)
+
+		for _, i := range instances {
+			go i.RunRefresher(refresher, window)
+		}
+	}
+
+	summary := startupSummary{
+		Roles:      len(rs.Roles()),
+		ActiveRole: fc.Snapshot().ActiveRole,
+		Listen:     listen,
+		Control:    control,
+		TLS:        false, // Listeners only serve plain HTTP
+		Cache:      cached,
+	}
+
+	// STS is checked in the background, so as not to hold up serving.
+	go func() {
+		summary.checkSTS(context.Background(), fc)
+		log.Println("summary", summary)
+	}()
+
+	if err := serve(servers, listeners, stopRefresher); err != nil {
+		panic(err)
+	}
+}
+
+// identityKeySetter is satisfied by finto's context, which signs the instance
+// identity document with a key.
+type identityKeySetter interface {
+	SetIdentityKey(key []byte) ([]byte, error)
+}
+
+// Signs the instance identity document with the metadata's key, writing the
+// certificate verifying tools must trust, if asked to.
+func setIdentityKey(fc identityKeySetter, m *MetadataConfig) error {
+	key, err := ioutil.ReadFile(m.IdentityKey)
+	if err != nil {
+		return err
+	}
+
+	cert, err := fc.SetIdentityKey(key)
+	if err != nil {
+		return err
+	}
+
+	if m.IdentityCert == "" {
+		return nil
+	}
+
+	return ioutil.WriteFile(m.IdentityCert, cert, 0644)
+}
+
+// The profile the active role's credentials are written as, unless the
+// credentials file names another.
+const defaultCredentialsFileProfile = "finto"
+
+// The environment variable holding the cache key, unless the cache names
+// another.
+const defaultCacheKeyEnv = "FINTO_CACHE_KEY"
+
+// Serves the set's roles credentials cached by an earlier run, and caches them
+// as they're refreshed. A cache that can't be read is started over.
+func restoreCache(c *CacheConfig, rs *finto.RoleSet) error {
+	env := c.KeyEnv
+	if env == "" {
+		env = defaultCacheKeyEnv
+	}
+
+	key, err := finto.ParseCacheKey(os.Getenv(env))
+	if err != nil {
+		return fmt.Errorf("%s: %s", env, err)
+	}
+
+	cache, err := finto.NewCredentialCache(c.File, key)
+	if err != nil {
+		return err
+	}
+
+	if err := cache.Load(); err != nil {
+		fmt.Println("warning: discarding credential cache:", err)
+	}
+
+	for _, alias := range cache.Restore(rs) {
+		log.Println("restored cached credentials of role", alias)
+	}
+
+	rs.AddRefreshHook(cache.Hook(rs))
+	return nil
+}
+
+// Returns a role set of roles, assumed through clients, with the settings
+// config gives every role set. Its STS calls are bounded by limit, which the
+// sets share.
+func newRoleSet(config *Config, roles RolesConfig, clients *stsClients, inFlight finto.RefreshingPolicy, limit finto.CallLimit) (*finto.RoleSet, error) {
+	rs := finto.NewRoleSet(clients.base(""))
+	rs.SetRefreshingPolicy(inFlight)
+	rs.SetCallLimit(limit)
+
+	if config.Retry != nil {
+		policy := finto.DefaultRetryPolicy
+		policy.MaxAttempts = config.Retry.MaxAttempts
+		if config.Retry.MaxDelay != nil {
+			policy.MaxDelay = config.Retry.MaxDelay.Duration
+		}
+
+		rs.SetRetryPolicy(policy)
+	}
+
+	if config.ClockSkew != nil {
+		rs.SetClockSkew(config.ClockSkew.Duration)
+	}
+
+	if config.MaxClockSkew != nil {
+		rs.SetMaxClockSkew(config.MaxClockSkew.Duration)
+	}
+
+	if config.MaxCredentialTTL != nil {
+		rs.SetMaxCredentialTTL(config.MaxCredentialTTL.Duration)
+	}
+
+	if config.Webhook != nil {
+		wh := finto.NewWebhook(config.Webhook.URL)
+		wh.IncludeSecrets = config.Webhook.IncludeSecrets
+		if config.Webhook.MaxAttempts > 0 {
+			wh.MaxAttempts = config.Webhook.MaxAttempts
+		}
+
+		rs.SetRefreshHook(wh.Notify)
+	}
+
+	for alias, role := range roles {
+		var opts []finto.RoleOption
+
+		// Looks up the identity of the credentials the role is assumed with.
+		var caller finto.CallerIdentityClient = clients.base(role.Region)
+
+		if role.Type != "" && role.Type != "passthrough" {
+			return nil, fmt.Errorf("role %s: unknown type %q", alias, role.Type)
+		}
+
+		if role.Type == "passthrough" {
+			if role.SAML != nil || len(role.Sources) > 0 {
+				return nil, fmt.Errorf("role %s: passthrough roles can't have saml or sources", alias)
+			}
+
+			client := clients.base(role.Region)
+			if role.SourceProfile != "" {
+				var err error
+				if client, err = clients.sourceProfile(role.SourceProfile, role.Region); err != nil {
+					return nil, fmt.Errorf("role %s: %s", alias, err)
+				}
+			}
+
+			opts = append(opts, finto.WithPassthrough(client.Config.Credentials, client))
+			caller = client
+		} else if role.SAML != nil {
+			assertion, err := samlAssertion(role.SAML)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %s", alias, err)
+			}
+
+			client := clients.base(role.Region)
+			opts = append(opts, finto.WithClient(finto.NewSAMLAssumeRoleClient(role.SAML.PrincipalArn, assertion, client)))
+			caller = nil
+		} else if len(role.Sources) > 0 {
+			if role.SourceProfile != "" {
+				return nil, fmt.Errorf("role %s: sources and source_profile are exclusive", alias)
+			}
+
+			sources, err := clients.chain(role.Sources, role.Region)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %s", alias, err)
+			}
+
+			opts = append(opts, finto.WithClient(finto.NewChainAssumeRoleClient(sources...)))
+			caller = nil
+		} else if role.SourceProfile != "" {
+			client, err := clients.sourceProfile(role.SourceProfile, role.Region)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %s", alias, err)
+			}
+
+			opts = append(opts, finto.WithSourceProfile(role.SourceProfile, client))
+			caller = client
+		} else if role.Region != "" {
+			opts = append(opts, finto.WithClient(clients.base(role.Region)))
+		}
+
+		if role.ExpectCaller != "" {
+			// SAML and chained roles aren't assumed with one set of base
+			// credentials whose identity could be checked.
+			if caller == nil {
+				return nil, fmt.Errorf("role %s: expect_caller can't be used with saml or sources", alias)
+			}
+
+			if err := finto.ValidateCallerPattern(role.ExpectCaller); err != nil {
+				return nil, fmt.Errorf("role %s: %s", alias, err)
+			}
+
+			opts = append(opts, finto.WithCallerCheck(role.ExpectCaller, caller))
+		}
+
+		if role.Duration != nil {
+			opts = append(opts, finto.WithSessionDuration(role.Duration.Duration))
+		}
+
+		if role.SourceIdentity != "" {
+			opts = append(opts, finto.WithSourceIdentity(role.SourceIdentity))
+		}
+
+		if role.Faults != nil {
+			if *faultInjection {
+				opts = append(opts, finto.WithFaults(finto.FaultKind(role.Faults.Kind), role.Faults.Count))
+			} else {
+				fmt.Printf("warning: role %s: ignoring faults without -fault-injection\n", alias)
+			}
+		}
+
+		if role.ProfileName != "" {
+			opts = append(opts, finto.WithProfileName(role.ProfileName))
+		}
+
+		if role.CredentialType != "" {
+			opts = append(opts, finto.WithCredentialType(role.CredentialType))
+		}
+
+		if len(role.AllowClients) > 0 || len(role.DenyClients) > 0 {
+			acl, err := finto.ParseClientACL(role.AllowClients, role.DenyClients)
+			if err != nil {
+				return nil, fmt.Errorf("role %s: %s", alias, err)
+			}
+
+			opts = append(opts, finto.WithClientACL(acl))
+		}
+
+		if len(role.Aliases) > 0 {
+			opts = append(opts, finto.WithAliases(role.Aliases...))
+		}
+
+		if err := rs.SetRole(alias, role.Arn, opts...); err != nil {
+			return nil, err
+		}
+	}
+
+	return rs, nil
+}
+
+// Returns the metadata listen address, and the control API address if it is
+// served separately. Flags given on the command line take precedence over the
+// config's listen section.
+func listenAddrs(c *Config) (string, string) {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	listen, control := fmt.Sprint(*addr, ":", *port), *controlAddr
+
+	if c.Listen != nil {
+		if c.Listen.Addr != "" && !set["addr"] && !set["port"] {
+			listen = c.Listen.Addr
+		}
+
+		if c.Listen.ControlAddr != "" && !set["control-addr"] {
+			control = c.Listen.ControlAddr
+		}
+	}
+
+	return listen, control
+}
+
+// Returns when the refresher renews credentials. The -refresh-ahead flag given
+// on the command line takes precedence over the config's refresh_ahead.
+func refreshWindow(c *Config) (finto.RefreshWindow, error) {
+	set := false
+	flag.Visit(func(f *flag.Flag) { set = set || f.Name == "refresh-ahead" })
+
+	if c.RefreshAhead != "" && !set {
+		return finto.ParseRefreshWindow(c.RefreshAhead)
+	}
+
+	return finto.ParseRefreshWindow(*refreshAhead)
 }
 
 func homeDir() (string, error) {
@@ -96,3 +685,28 @@ func prepareLog(filename string) (*os.File, error) {
 
 	return os.Stdout, nil
 }
+
+// Wraps a handler to log requests in the Common Log Format, each line ending
+// with the request's ID, e.g. request_id=4f1c...
+func logHandler(out io.Writer, h http.Handler) http.Handler {
+	return finto.RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out := requestIDWriter{finto.RedactingWriter(out), finto.RequestID(r.Context())}
+		handlers.LoggingHandler(out, h).ServeHTTP(w, r)
+	}))
+}
+
+// Appends a request ID to the log lines written through it. LoggingHandler
+// writes each line in a single call.
+type requestIDWriter struct {
+	io.Writer
+	id string
+}
+
+func (w requestIDWriter) Write(b []byte) (int, error) {
+	line := append(bytes.TrimRight(b, "\n"), " request_id="+w.id+"\n"...)
+	if _, err := w.Writer.Write(line); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogHandler(t *testing.T) {
+	var log bytes.Buffer
+
+	h := logHandler(&log, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest("GET", "/roles", nil)
+	req.Header.Set("X-Request-Id", "sdk-call-1234")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, "sdk-call-1234", rec.Header().Get("X-Request-Id"))
+
+	line := log.String()
+	assert.Contains(t, line, `"GET /roles HTTP/1.1" 418`)
+	assert.True(t, strings.HasSuffix(line, " request_id=sdk-call-1234\n"), line)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Bound on draining in-flight requests at shutdown.
+const shutdownTimeout = 5 * time.Second
+
+// Serves each of servers on the listener of the same index until one fails or
+// finto is interrupted. On interrupt, stop is called and the servers are shut
+// down gracefully, letting in-flight requests finish. Returns the error of a
+// failed server, if any.
+func serve(servers []*http.Server, listeners []net.Listener, stop func()) error {
+	defer stop()
+
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, l net.Listener) {
+			if err := srv.Serve(l); err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(srv, listeners[i])
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-sigs:
+		log.Println("shutting down on", sig)
+	}
+
+	stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Println("warning: shutdown:", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+// +build !windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// roleCycler is satisfied by finto's context, which switches roles through the
+// same setter used by the HTTP API.
+type roleCycler interface {
+	CycleInstanceRole() (string, error)
+}
+
+// Advances the active role on each SIGUSR1.
+func cycleOnSignal(rc roleCycler) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+
+	go func() {
+		for range sigs {
+			role, err := rc.CycleInstanceRole()
+			if err != nil {
+				log.Println("failed to cycle active role:", err)
+				continue
+			}
+
+			log.Println("active role:", role)
+		}
+	}()
+}
@@ -0,0 +1,12 @@
+package main
+
+import "log"
+
+type roleCycler interface {
+	CycleInstanceRole() (string, error)
+}
+
+// SIGUSR1 does not exist on Windows.
+func cycleOnSignal(rc roleCycler) {
+	log.Println("warning: -cycle-on-usr1 is not supported on windows")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+)
+
+// What finto was started with, logged once on startup to confirm a deployment
+// is configured as intended.
+type startupSummary struct {
+	Roles      int    // Roles loaded
+	ActiveRole string // Role served on startup, if any
+	Listen     string // Address metadata is served on
+	Control    string // Address the control API is served on, if apart
+	TLS        bool   // Whether listeners serve TLS
+	Cache      bool   // Whether credentials are cached across restarts
+	STS        string // "reachable", "unreachable", or "unchecked" without a readiness check
+	STSError   string // Why STS is unreachable
+}
+
+// Returns the summary as a single line of key=value pairs, quoting values
+// that are empty or contain spaces.
+func (s startupSummary) String() string {
+	onOff := func(b bool) string {
+		if b {
+			return "on"
+		}
+		return "off"
+	}
+
+	pairs := [][2]string{
+		{"roles", strconv.Itoa(s.Roles)},
+		{"active_role", s.ActiveRole},
+		{"listen", s.Listen},
+	}
+
+	if s.Control != "" {
+		pairs = append(pairs, [2]string{"control", s.Control})
+	}
+
+	pairs = append(pairs,
+		[2]string{"tls", onOff(s.TLS)},
+		[2]string{"cache", onOff(s.Cache)},
+		[2]string{"sts", s.STS},
+	)
+
+	if s.STSError != "" {
+		pairs = append(pairs, [2]string{"sts_error", s.STSError})
+	}
+
+	fields := make([]string, len(pairs))
+	for i, p := range pairs {
+		v := p[1]
+		if v == "" || strings.ContainsAny(v, " \t\"") {
+			v = strconv.Quote(v)
+		}
+
+		fields[i] = p[0] + "=" + v
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// stsChecker is satisfied by finto's context, which checks STS as readiness
+// probes do.
+type stsChecker interface {
+	CheckSTS(ctx context.Context) (bool, error)
+}
+
+// Fills in whether STS is reachable, through the readiness check if one is
+// configured.
+func (s *startupSummary) checkSTS(ctx context.Context, fc stsChecker) {
+	checked, err := fc.CheckSTS(ctx)
+	switch {
+	case !checked:
+		s.STS = "unchecked"
+	case err != nil:
+		s.STS = "unreachable"
+		s.STSError = err.Error()
+	default:
+		s.STS = "reachable"
+	}
+}
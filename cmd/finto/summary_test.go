@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSTSChecker struct {
+	checked bool
+	err     error
+}
+
+func (c fakeSTSChecker) CheckSTS(ctx context.Context) (bool, error) {
+	return c.checked, c.err
+}
+
+func TestStartupSummary(t *testing.T) {
+	s := startupSummary{
+		Roles:      3,
+		ActiveRole: "app",
+		Listen:     "169.254.169.254:16925",
+		Cache:      true,
+	}
+
+	s.checkSTS(context.Background(), fakeSTSChecker{})
+	assert.Equal(t, "roles=3 active_role=app listen=169.254.169.254:16925 tls=off cache=on sts=unchecked", s.String())
+
+	s.checkSTS(context.Background(), fakeSTSChecker{checked: true})
+	assert.Equal(t, "reachable", s.STS)
+
+	// Values that are empty or have spaces are quoted.
+	s = startupSummary{Listen: "127.0.0.1:80", Control: "127.0.0.1:81"}
+	s.checkSTS(context.Background(), fakeSTSChecker{checked: true, err: errors.New("dial tcp: i/o timeout")})
+	assert.Equal(t, `roles=0 active_role="" listen=127.0.0.1:80 control=127.0.0.1:81 tls=off cache=off sts=unreachable sts_error="dial tcp: i/o timeout"`, s.String())
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/threadwaste/finto"
+)
+
+const useUsage = "usage: finto use [-url url] [-token token] <alias>"
+
+// Runs the use subcommand, which activates a role on a running finto. Returns
+// the process exit code.
+func runUse(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("use", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	url := fs.String("url", envDefault("FINTO_URL", "http://169.254.169.254"), "base URL of finto")
+	token := fs.String("token", os.Getenv("FINTO_TOKEN"), "auth token sent to finto")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, useUsage)
+		return 2
+	}
+
+	client := finto.NewClient(*url)
+	client.Token = *token
+
+	role, err := client.SetActive(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "finto:", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, role)
+	return 0
+}
+
+func envDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+
+	return def
+}
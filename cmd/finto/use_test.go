@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/threadwaste/finto"
+)
+
+type nopAssumeRoleClient struct{}
+
+func (c *nopAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	return &sts.AssumeRoleOutput{}, nil
+}
+
+func setupUseTests(t *testing.T) *httptest.Server {
+	rs := finto.NewRoleSet(&nopAssumeRoleClient{})
+	rs.SetRole("1", "arn")
+	rs.SetRole("2", "arn")
+
+	fc, err := finto.InitFintoContext(rs, "1")
+	if err != nil {
+		t.Fatal("Error creating context", err)
+	}
+
+	return httptest.NewServer(finto.FintoRouter(fc))
+}
+
+func TestUseRole(t *testing.T) {
+	ts := setupUseTests(t)
+	defer ts.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	code := runUse([]string{"-url", ts.URL, "2"}, &stdout, &stderr)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, "2\n", stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
+func TestUseMissingRole(t *testing.T) {
+	ts := setupUseTests(t)
+	defer ts.Close()
+
+	var stdout, stderr bytes.Buffer
+
+	code := runUse([]string{"-url", ts.URL, "3"}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout.String())
+	assert.Equal(t, "finto: unknown role: 3\n", stderr.String())
+}
+
+func TestUseUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	code := runUse([]string{}, &stdout, &stderr)
+
+	assert.Equal(t, 2, code)
+	assert.Equal(t, useUsage+"\n", stderr.String())
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/threadwaste/finto"
+)
+
+const validateUsage = "usage: finto validate [config]"
+
+// Runs the validate subcommand, which checks a config without starting finto,
+// reporting every problem found. The config defaults to the -config flag's.
+// Returns the process exit code.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	file := *fintorc
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		file = fs.Arg(0)
+	default:
+		fmt.Fprintln(stderr, validateUsage)
+		return 2
+	}
+
+	config, err := LoadConfig(file)
+	if err != nil {
+		fmt.Fprintln(stderr, "finto:", err)
+		return 1
+	}
+
+	problems := validateConfig(config)
+	for _, p := range problems {
+		fmt.Fprintf(stderr, "%s: %s\n", file, p)
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+
+	fmt.Fprintf(stdout, "%s: ok\n", file)
+	return 0
+}
+
+// Returns every problem with config that would keep finto from starting, or
+// have it misbehave. Credentials aren't loaded, nor is STS called.
+func validateConfig(c *Config) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	names := validateRoles(c.Roles, "", add)
+
+	if c.DefaultRole == "" {
+		add("default_role is required")
+	} else if !names[c.DefaultRole] {
+		add("default_role: unknown role %q", c.DefaultRole)
+	}
+
+	if c.FallbackRole != "" && !names[c.FallbackRole] {
+		add("fallback_role: unknown role %q", c.FallbackRole)
+	}
+
+	for _, name := range sortedKeys(c.Groups) {
+		g := c.Groups[name]
+		for _, member := range append([]string{g.Primary}, g.Members...) {
+			if !names[member] {
+				add("group %s: unknown role %q", name, member)
+			}
+		}
+	}
+
+	for _, name := range sortedKeys(c.Instances) {
+		ic := c.Instances[name]
+		names := validateRoles(ic.Roles, "instance "+name+": ", add)
+
+		if !names[ic.DefaultRole] {
+			add("instance %s: unknown default role %q", name, ic.DefaultRole)
+		}
+	}
+
+	if c.RefreshAhead != "" {
+		if _, err := finto.ParseRefreshWindow(c.RefreshAhead); err != nil {
+			add("refresh_ahead: %s", err)
+		}
+	}
+
+	if c.Chaos != nil {
+		for _, pattern := range sortedKeys(c.Chaos.Latency) {
+			if _, _, err := finto.ParseLatency(c.Chaos.Latency[pattern]); err != nil {
+				add("chaos: latency of %s: %s", pattern, err)
+			}
+		}
+	}
+
+	if c.Listen != nil && len(c.Listen.TrustedProxies) > 0 {
+		if _, err := finto.ParseTrustedProxies(c.Listen.TrustedProxies); err != nil {
+			add("listen: trusted_proxies: %s", err)
+		}
+	}
+
+	if c.STSHTTP != nil {
+		if _, err := newSTSHTTPClient(c.STSHTTP); err != nil {
+			add("%s", err)
+		}
+	}
+
+	if c.MaxCredentialTTL != nil && c.MaxCredentialTTL.Duration <= 0 {
+		add("max_credential_ttl: must be positive")
+	}
+
+	if c.MaxSTSCalls < 0 {
+		add("max_sts_calls: must not be negative")
+	}
+
+	if c.Cache != nil && c.Cache.File == "" {
+		add("cache: file is required")
+	}
+
+	if c.CredentialsFile != nil {
+		if err := checkCredentialsFile(c); err != nil {
+			add("credentials_file: %s", err)
+		}
+	}
+
+	return problems
+}
+
+// Returns an error if the credentials file config's profile would overwrite
+// one roles are assumed with: the base credentials' profile, or a role's
+// source_profile, in the credentials file as the SDK resolves it by default.
+func checkCredentialsFile(c *Config) error {
+	cf := c.CredentialsFile
+	if cf.File == "" {
+		return errors.New("file is required")
+	}
+
+	profile := cf.Profile
+	if profile == "" {
+		profile = defaultCredentialsFileProfile
+	}
+
+	base := c.Credentials.File
+	if base == "" {
+		base = awsCredentialsFile()
+	}
+
+	if !samePath(cf.File, base) {
+		return nil
+	}
+
+	baseProfile := c.Credentials.Profile
+	if baseProfile == "" {
+		baseProfile = os.Getenv("AWS_PROFILE")
+	}
+	if baseProfile == "" {
+		baseProfile = "default"
+	}
+
+	if profile == baseProfile {
+		return fmt.Errorf("would overwrite the profile %q roles are assumed with", profile)
+	}
+
+	roles := []RolesConfig{c.Roles}
+	for _, name := range sortedKeys(c.Instances) {
+		roles = append(roles, c.Instances[name].Roles)
+	}
+
+	for _, rc := range roles {
+		for _, alias := range sortedKeys(rc) {
+			if rc[alias].SourceProfile == profile {
+				return fmt.Errorf("would overwrite the profile %q role %s is assumed from", profile, alias)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns whether a and b name the same file, once made absolute.
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+
+	return absA == absB
+}
+
+// Checks each of roles, reporting problems through add with prefix. Returns
+// the names roles can be requested by: their aliases, additional aliases, and
+// profile names.
+func validateRoles(roles RolesConfig, prefix string, add func(string, ...interface{})) map[string]bool {
+	names := make(map[string]bool)
+	claimed := make(map[string]string) // Additional names->the alias claiming them
+
+	for _, alias := range sortedKeys(roles) {
+		names[alias] = true
+	}
+
+	for _, alias := range sortedKeys(roles) {
+		role := roles[alias]
+		fail := func(format string, args ...interface{}) {
+			add(prefix+"role "+alias+": "+format, args...)
+		}
+
+		if err := finto.ValidateAlias(alias); err != nil {
+			fail("%s", err)
+		}
+
+		switch role.Type {
+		case "":
+			if err := finto.ValidateRoleArn(role.Arn); err != nil {
+				fail("%s", err)
+			}
+		case "passthrough":
+			if role.SAML != nil || len(role.Sources) > 0 {
+				fail("passthrough roles can't have saml or sources")
+			}
+		default:
+			fail("unknown type %q", role.Type)
+		}
+
+		if len(role.Sources) > 0 {
+			if role.SourceProfile != "" {
+				fail("sources and source_profile are exclusive")
+			}
+
+			if _, err := newSTSClients("", "").chain(role.Sources, role.Region); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if role.SAML != nil {
+			if _, err := samlAssertion(role.SAML); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if role.ExpectCaller != "" {
+			if role.SAML != nil || len(role.Sources) > 0 {
+				fail("expect_caller can't be used with saml or sources")
+			}
+
+			if err := finto.ValidateCallerPattern(role.ExpectCaller); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if role.Duration != nil {
+			if err := finto.ValidateSessionDuration(role.Duration.Duration); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if role.SourceIdentity != "" {
+			if err := finto.ValidateSourceIdentity(role.SourceIdentity); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if role.Faults != nil {
+			if err := finto.ValidateFaultKind(finto.FaultKind(role.Faults.Kind)); err != nil {
+				fail("%s", err)
+			}
+		}
+
+		if _, err := finto.ParseClientACL(role.AllowClients, role.DenyClients); err != nil {
+			fail("%s", err)
+		}
+
+		others := append([]string{}, role.Aliases...)
+		if role.ProfileName != "" && role.ProfileName != alias {
+			others = append(others, role.ProfileName)
+		}
+
+		for _, name := range others {
+			if err := finto.ValidateAlias(name); err != nil {
+				fail("%s", err)
+			}
+
+			if other, ok := claimed[name]; ok && other != alias {
+				fail("%q is also claimed by role %s", name, other)
+			} else if names[name] && !ok {
+				fail("%q is already a role's alias", name)
+			}
+
+			claimed[name] = alias
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// Returns a map's keys in order, so that problems are reported consistently.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeValidateConfig(t *testing.T, config string) string {
+	f, err := ioutil.TempFile("", "validate-test")
+	if err != nil {
+		t.Fatal("Error creating file", err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(config); err != nil {
+		t.Fatal("Error writing file", err)
+	}
+
+	return f.Name()
+}
+
+func TestValidate(t *testing.T) {
+	file := writeValidateConfig(t, `{
+  "default_role": "app",
+  "roles": {
+    "app": {"arn": "arn:aws:iam::123456789012:role/app", "duration": "2h"},
+    "base": {"type": "passthrough"}
+  }
+}`)
+	defer os.Remove(file)
+
+	var stdout, stderr bytes.Buffer
+
+	code := runValidate([]string{file}, &stdout, &stderr)
+
+	assert.Equal(t, 0, code)
+	assert.Equal(t, file+": ok\n", stdout.String())
+	assert.Empty(t, stderr.String())
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	file := writeValidateConfig(t, `{
+  "default_role": "missing",
+  "refresh_ahead": "soon",
+  "cache": {},
+  "credentials": {"file": "/tmp/credentials", "profile": "finto"},
+  "credentials_file": {"file": "/tmp/credentials"},
+  "max_sts_calls": -1,
+  "groups": {"g": {"primary": "app", "members": ["ghost"]}},
+  "roles": {
+    "app": {"arn": "arn:aws:iam::123456789012:role/app", "duration": "24h", "aliases": ["db"], "expect_caller": "deploy"},
+    "db": {"arn": "arn:aws:iam::123456789012:user/db", "source_identity": "x"},
+    "odd": {"arn": "arn:aws:iam::123456789012:role/odd", "type": "magic", "allow_clients": ["nowhere"]},
+    "active": {"arn": "arn:aws:iam::123456789012:role/active", "profile_name": "active"}
+  }
+}`)
+	defer os.Remove(file)
+
+	var stdout, stderr bytes.Buffer
+
+	code := runValidate([]string{file}, &stdout, &stderr)
+
+	assert.Equal(t, 1, code)
+	assert.Empty(t, stdout.String())
+
+	for _, problem := range []string{
+		`role app: invalid session duration: 24h0m0s`,
+		`role app: "db" is already a role's alias`,
+		`role app: invalid caller pattern: "deploy"`,
+		`role db: not a role arn: arn:aws:iam::123456789012:user/db`,
+		`role db: invalid source identity: "x"`,
+		`role odd: unknown type "magic"`,
+		`role odd: invalid client address: "nowhere"`,
+		`role active: alias "active" is reserved`,
+		`default_role: unknown role "missing"`,
+		`group g: unknown role "ghost"`,
+		`refresh_ahead: `,
+		`max_sts_calls: must not be negative`,
+		`cache: file is required`,
+		`credentials_file: would overwrite the profile "finto" roles are assumed with`,
+	} {
+		assert.Contains(t, stderr.String(), file+": "+problem)
+	}
+}
+
+func TestCheckCredentialsFile(t *testing.T) {
+	defer os.Setenv("AWS_SHARED_CREDENTIALS_FILE", os.Getenv("AWS_SHARED_CREDENTIALS_FILE"))
+	defer os.Setenv("AWS_PROFILE", os.Getenv("AWS_PROFILE"))
+
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", "/tmp/finto-test/credentials")
+	os.Unsetenv("AWS_PROFILE")
+
+	// Unset, the base credentials are the SDK's defaults: the default
+	// profile of the shared credentials file.
+	config := &Config{CredentialsFile: &CredentialsFileConfig{File: "/tmp/finto-test/../finto-test/credentials", Profile: "default"}}
+	assert.EqualError(t, checkCredentialsFile(config), `would overwrite the profile "default" roles are assumed with`)
+
+	os.Setenv("AWS_PROFILE", "work")
+	assert.NoError(t, checkCredentialsFile(config))
+
+	config.CredentialsFile.Profile = "work"
+	assert.Error(t, checkCredentialsFile(config))
+
+	// Nor may it overwrite a role's source profile.
+	config.CredentialsFile.Profile = ""
+	config.Roles = RolesConfig{"app": {Arn: "arn:aws:iam::123456789012:role/app", SourceProfile: "finto"}}
+	assert.EqualError(t, checkCredentialsFile(config), `would overwrite the profile "finto" role app is assumed from`)
+
+	// Another file is never a conflict.
+	config.CredentialsFile.File = "/tmp/finto-test/other"
+	assert.NoError(t, checkCredentialsFile(config))
+
+	config.CredentialsFile.File = ""
+	assert.EqualError(t, checkCredentialsFile(config), "file is required")
+}
+
+func TestValidateUnreadable(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+
+	assert.Equal(t, 1, runValidate([]string{"/nonexistent/fintorc"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "failed to read config")
+
+	assert.Equal(t, 2, runValidate([]string{"a", "b"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), validateUsage)
+}
@@ -0,0 +1,211 @@
+package finto
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CredentialsFile writes the active role's credentials to a profile of an AWS
+// credentials file, for tools that read only the file rather than the
+// instance metadata. The file's other profiles, and any comments, are kept.
+type CredentialsFile struct {
+	file    string
+	profile string
+
+	alias      string     // Role of the credentials last written
+	expiration time.Time  // Expiration of the credentials last written
+	m          sync.Mutex // Serializes writes of the file
+}
+
+// Returns a writer of the profile of the AWS credentials file. Nothing is
+// written until it's set on a context with SetCredentialsFile.
+func NewCredentialsFile(file, profile string) *CredentialsFile {
+	return &CredentialsFile{file: file, profile: profile}
+}
+
+// Replaces the profile's block in the file with the credentials of the role
+// alias, or appends one if the file has none. The file is created if missing,
+// and replaced whole, so that a reader never sees it half-written.
+func (f *CredentialsFile) write(alias string, creds Credentials) error {
+	b, err := ioutil.ReadFile(f.file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	block := []string{
+		fmt.Sprintf("[%s]", f.profile),
+		fmt.Sprintf("# written by finto for role %s, expires %s", alias, formatTime(creds.Expiration)),
+		"aws_access_key_id = " + creds.AccessKeyId,
+		"aws_secret_access_key = " + creds.SecretAccessKey,
+		"aws_session_token = " + creds.SessionToken,
+		"x_security_token_expires = " + formatTime(creds.Expiration),
+	}
+
+	return writeFileAtomic(f.file, replaceProfile(b, f.profile, block), 0600)
+}
+
+// Removes the profile's block from the file, if it has one.
+func (f *CredentialsFile) remove() error {
+	b, err := ioutil.ReadFile(f.file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.file, replaceProfile(b, f.profile, nil), 0600)
+}
+
+// Returns the credentials file b with profile's block, from its header to the
+// next profile's, replaced by block, or removed if block is empty. Blank lines
+// separating it from the next profile are kept. Without one, block is
+// appended.
+func replaceProfile(b []byte, profile string, block []string) []byte {
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	}
+
+	var out []string
+	replaced, skipping := false, false
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		if len(trimmed) > 1 && trimmed[0] == '[' && trimmed[len(trimmed)-1] == ']' {
+			skipping = strings.TrimSpace(trimmed[1:len(trimmed)-1]) == profile
+			if skipping && !replaced && len(block) > 0 {
+				out = append(out, block...)
+				out = append(out, "")
+			}
+			replaced = replaced || skipping
+
+			if skipping {
+				continue
+			}
+		}
+
+		if !skipping {
+			out = append(out, line)
+		}
+	}
+
+	if !replaced && len(block) > 0 {
+		if len(out) > 0 && strings.TrimSpace(out[len(out)-1]) != "" {
+			out = append(out, "")
+		}
+		out = append(out, block...)
+	}
+
+	// The block's separating blank line is redundant at the end of the file.
+	for len(out) > 0 && strings.TrimSpace(out[len(out)-1]) == "" {
+		out = out[:len(out)-1]
+	}
+
+	var buf bytes.Buffer
+	for _, line := range out {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// Writes the active role's credentials to f as they're refreshed and as the
+// active role changes. Writes happen in the background, so neither refreshes
+// nor switches wait on the file.
+func (fc *fintoContext) SetCredentialsFile(f *CredentialsFile) {
+	fc.m.Lock()
+	fc.credsFile = f
+	fc.m.Unlock()
+
+	fc.set.AddRefreshHook(func(alias string, creds Credentials) {
+		go fc.writeCredentialsFile(f, alias, creds)
+	})
+
+	fc.exportActiveCredentials()
+}
+
+func (fc *fintoContext) getCredentialsFile() *CredentialsFile {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.credsFile
+}
+
+// Writes the active role's credentials to the credentials file, if there is
+// one, fetching them in the background should they need minting.
+func (fc *fintoContext) exportActiveCredentials() {
+	f := fc.getCredentialsFile()
+	if f == nil {
+		return
+	}
+
+	alias := fc.getInstanceRole()
+
+	go func() {
+		role, err := fc.set.Role(alias)
+		if err == nil {
+			var creds Credentials
+			if creds, err = role.Credentials(context.Background()); err == nil {
+				fc.writeCredentialsFile(f, alias, creds)
+				return
+			}
+		}
+
+		// Tools reading the file mustn't go on using the role switched away
+		// from, so its credentials are removed rather than left in place.
+		log.Printf("warning: credentials of role %s not written to %s: %s", alias, f.file, err)
+		fc.clearCredentialsFile(f, alias)
+	}()
+}
+
+// Removes the profile from f, unless the role alias is no longer the active
+// role, whose credentials are then f's to keep.
+func (fc *fintoContext) clearCredentialsFile(f *CredentialsFile, alias string) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if fc.set.canonical(fc.getInstanceRole()) != fc.set.canonical(alias) {
+		return
+	}
+
+	if err := f.remove(); err != nil {
+		log.Printf("warning: failed to remove profile %s from %s: %s", f.profile, f.file, err)
+		return
+	}
+
+	f.alias, f.expiration = "", time.Time{}
+}
+
+// Writes the credentials of the role alias to f, unless it's no longer the
+// active role or f already has its later ones. Checked while writes are
+// serialized, so a role switched away from never overwrites the one switched
+// to.
+func (fc *fintoContext) writeCredentialsFile(f *CredentialsFile, alias string, creds Credentials) {
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	alias = fc.set.canonical(alias)
+	if fc.set.canonical(fc.getInstanceRole()) != alias {
+		return
+	}
+
+	if f.alias == alias && !creds.Expiration.After(f.expiration) {
+		return
+	}
+
+	if err := f.write(alias, creds); err != nil {
+		log.Printf("warning: failed to write credentials of role %s to %s: %s", alias, f.file, err)
+		return
+	}
+
+	f.alias, f.expiration = alias, creds.Expiration
+}
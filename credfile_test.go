@@ -0,0 +1,127 @@
+package finto
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceProfile(t *testing.T) {
+	block := []string{"[finto]", "aws_access_key_id = new"}
+
+	cases := []struct {
+		in, out string
+	}{
+		{"", "[finto]\naws_access_key_id = new\n"},
+		{
+			"[default]\naws_access_key_id = mine\n",
+			"[default]\naws_access_key_id = mine\n\n[finto]\naws_access_key_id = new\n",
+		},
+		{
+			"# my keys\n[finto]\naws_access_key_id = old\naws_session_token = old\n\n[default]\naws_access_key_id = mine\n",
+			"# my keys\n[finto]\naws_access_key_id = new\n\n[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"[default]\naws_access_key_id = mine\n[ finto ]\naws_access_key_id = old\n",
+			"[default]\naws_access_key_id = mine\n[finto]\naws_access_key_id = new\n",
+		},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.out, string(replaceProfile([]byte(c.in), "finto", block)), c.in)
+	}
+
+	// Without a block, the profile is removed.
+	removals := []struct {
+		in, out string
+	}{
+		{"", ""},
+		{
+			"[default]\naws_access_key_id = mine\n\n[finto]\naws_access_key_id = old\n",
+			"[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"[finto]\naws_access_key_id = old\n\n[default]\naws_access_key_id = mine\n",
+			"[default]\naws_access_key_id = mine\n",
+		},
+		{
+			"[default]\naws_access_key_id = mine\n\n[finto]\naws_access_key_id = old\n\n[other]\naws_access_key_id = x\n",
+			"[default]\naws_access_key_id = mine\n\n[other]\naws_access_key_id = x\n",
+		},
+	}
+
+	for _, c := range removals {
+		assert.Equal(t, c.out, string(replaceProfile([]byte(c.in), "finto", nil)), c.in)
+	}
+}
+
+// Waits up to a second for file to contain s, or not to, as contains says.
+func waitForFile(t *testing.T, file string, contains bool, s string) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if b, err := ioutil.ReadFile(file); err == nil && strings.Contains(string(b), s) == contains {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return assert.Fail(t, "credentials file was not written", s)
+}
+
+func TestCredentialsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "finto-credentials")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "credentials")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("[default]\naws_access_key_id = mine\n"), 0600))
+
+	fc := setupTestFintoContext()
+	fc.SetCredentialsFile(NewCredentialsFile(file, "finto"))
+
+	// The active role's credentials are written once set, alongside the
+	// file's other profiles.
+	if waitForFile(t, file, true, "aws_access_key_id = "+testArn) {
+		b, _ := ioutil.ReadFile(file)
+		assert.Contains(t, string(b), "[default]\naws_access_key_id = mine\n")
+		assert.Contains(t, string(b), "x_security_token_expires = ")
+		assert.Contains(t, string(b), "# written by finto for role test-alias")
+	}
+
+	info, err := os.Stat(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	}
+
+	// Switching roles writes the new role's credentials in place of the old.
+	assert.NoError(t, fc.setInstanceRole("another-alias"))
+	if waitForFile(t, file, true, "aws_access_key_id = "+anotherArn) {
+		b, _ := ioutil.ReadFile(file)
+		assert.NotContains(t, string(b), testArn)
+		assert.Equal(t, 1, strings.Count(string(b), "[finto]"))
+	}
+
+	// Refreshes of roles that aren't active aren't written.
+	fc.writeCredentialsFile(fc.credsFile, "test-alias", Credentials{AccessKeyId: "inactive"})
+	b, _ := ioutil.ReadFile(file)
+	assert.NotContains(t, string(b), "inactive")
+
+	// Should the new role's credentials fail, the old role's are removed
+	// rather than left to be used in its place.
+	fc.set.SetRole("failing", testArn,
+		WithClient(&FailingAssumeRoleClient{errs: []error{awserr.New("AccessDenied", "not authorized", nil)}}))
+	assert.NoError(t, fc.setInstanceRole("failing"))
+
+	if waitForFile(t, file, false, "[finto]") {
+		b, _ := ioutil.ReadFile(file)
+		assert.Equal(t, "[default]\naws_access_key_id = mine\n", string(b))
+	}
+}
@@ -0,0 +1,109 @@
+package finto
+
+import (
+	"log"
+	"net/http"
+)
+
+// Sets the role the instance role returns to should it no longer exist, e.g.
+// once removed from the set. It starts as the role finto was initialized with.
+func (fc *fintoContext) SetDefaultRole(role string) error {
+	if _, err := fc.set.Role(role); err != nil {
+		return err
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.defaultRole = fc.set.canonical(role)
+	return nil
+}
+
+// Returns the role the instance role returns to should it no longer exist.
+func (fc *fintoContext) DefaultRole() string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.defaultRole
+}
+
+// Removes a role from the set. Should it be the active role, the default role
+// is served in its place, or with no default left, no role is active. Should
+// it be the default role, there's no longer a default.
+func (fc *fintoContext) RemoveRole(alias string) error {
+	removed := fc.set.canonical(alias)
+	active := fc.set.canonical(fc.getInstanceRole())
+
+	if err := fc.set.RemoveRole(alias); err != nil {
+		return err
+	}
+
+	fc.m.Lock()
+	if fc.defaultRole == removed {
+		fc.defaultRole = ""
+	}
+	def := fc.defaultRole
+	fc.m.Unlock()
+
+	if active != removed {
+		return nil
+	}
+
+	if def == "" {
+		log.Printf("warning: active role %s was removed, and there's no default role to serve", alias)
+		fc.clearInstanceRole()
+		return nil
+	}
+
+	log.Printf("warning: active role %s was removed, serving default role %s", alias, def)
+	return fc.setInstanceRole(def)
+}
+
+// Leaves no role active, e.g. once the active role is removed with no default
+// to take its place.
+func (fc *fintoContext) clearInstanceRole() {
+	// Persisted once unlocked.
+	defer fc.persistState()
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.instanceRole = ""
+	fc.activeGroup = ""
+	fc.metrics.activeRole.Reset()
+
+	fc.switches++
+	if fc.revert != nil {
+		fc.revert.Stop()
+		fc.revert = nil
+	}
+}
+
+// Show the role the instance role returns to should it no longer exist.
+func defaultRoleShow(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, map[string]string{"default_role": fc.DefaultRole()})
+	})
+}
+
+// Set the role the instance role returns to should it no longer exist. The
+// active role is left as it is.
+func defaultRoleSet(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Alias string `json:"alias"`
+		}
+
+		if err := decodeBody(w, r, &req); err != nil {
+			bodyErrorResponse(w, err)
+			return
+		}
+
+		if err := fc.SetDefaultRole(req.Alias); err != nil {
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		jsonResponse(w, map[string]string{"default_role": fc.DefaultRole()})
+	})
+}
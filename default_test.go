@@ -0,0 +1,54 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRole(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	defaultRole := func() string {
+		req, rec := setupTestRequest("GET", "/default-role", nil, t)
+		router.ServeHTTP(rec, req)
+
+		var resp map[string]string
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+		return resp["default_role"]
+	}
+
+	assert.Equal(t, "test-alias", defaultRole())
+
+	req, rec := setupTestRequest("PUT", "/default-role", bytes.NewBufferString(`{"alias":"another-alias"}`), t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "another-alias", defaultRole())
+
+	// Only the default changes, not the active role.
+	assert.Equal(t, "test-alias", fc.getInstanceRole())
+
+	req, rec = setupTestRequest("PUT", "/default-role", bytes.NewBufferString(`{"alias":"missing"}`), t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, "another-alias", defaultRole())
+
+	// Once the active role is removed, the default is served instead.
+	assert.NoError(t, fc.RemoveRole("test-alias"))
+	assert.Equal(t, "another-alias", fc.getInstanceRole())
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "another-alias", rec.Body.String())
+
+	// Removing the default leaves no default.
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn))
+	assert.NoError(t, fc.setInstanceRole("test-alias"))
+	assert.NoError(t, fc.RemoveRole("another-alias"))
+	assert.Equal(t, "", defaultRole())
+	assert.Equal(t, "test-alias", fc.getInstanceRole())
+}
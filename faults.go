@@ -0,0 +1,70 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// FaultKind is a kind of AssumeRole failure that can be injected into a role,
+// to exercise how applications cope with failing credential fetches.
+type FaultKind string
+
+const (
+	FaultThrottling   FaultKind = "throttling"    // STS rate limiting
+	FaultAccessDenied FaultKind = "access_denied" // A trust or permissions policy refusal
+	FaultTimeout      FaultKind = "timeout"       // STS failing to respond in time
+)
+
+// Returns the error STS would fail with for the fault, or nil if the kind is
+// unknown.
+func (k FaultKind) err() error {
+	switch k {
+	case FaultThrottling:
+		return awserr.NewRequestFailure(
+			awserr.New("Throttling", "Rate exceeded", nil), 400, "finto-fault")
+	case FaultAccessDenied:
+		return awserr.NewRequestFailure(
+			awserr.New("AccessDenied", "not authorized to perform sts:AssumeRole", nil), 403, "finto-fault")
+	case FaultTimeout:
+		return awserr.New("RequestError", "send request failed", context.DeadlineExceeded)
+	}
+
+	return nil
+}
+
+// Returns an error if k isn't a known kind of fault.
+func ValidateFaultKind(k FaultKind) error {
+	if k.err() == nil {
+		return fmt.Errorf("unknown fault kind: %s", k)
+	}
+
+	return nil
+}
+
+// Injected failures remaining for a role.
+type faults struct {
+	kind      FaultKind
+	remaining int
+}
+
+// Fails the role's next count credential refreshes with the given kind of
+// error before letting them succeed. A failure is injected in place of an
+// entire refresh, retries included, so STS isn't called. For testing only.
+func WithFaults(kind FaultKind, count int) RoleOption {
+	return func(r *Role) {
+		r.faults = &faults{kind: kind, remaining: count}
+	}
+}
+
+// Returns the error to inject in place of the next refresh, if any remain. The
+// role must be locked.
+func (r *Role) nextFault() error {
+	if r.faults == nil || r.faults.remaining <= 0 {
+		return nil
+	}
+
+	r.faults.remaining -= 1
+	return r.faults.kind.err()
+}
@@ -0,0 +1,66 @@
+package finto
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaults(t *testing.T) {
+	cases := []struct {
+		kind      FaultKind
+		code      string
+		retryable bool
+	}{
+		{FaultThrottling, "Throttling", true},
+		{FaultAccessDenied, "AccessDenied", false},
+		{FaultTimeout, "RequestError", true},
+	}
+
+	for _, c := range cases {
+		client := &FailingAssumeRoleClient{}
+
+		rs := NewRoleSet(client)
+		assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithFaults(c.kind, 2)))
+		role, _ := rs.Role("test-alias")
+
+		for i := 0; i < 2; i++ {
+			_, err := role.Credentials(context.Background())
+
+			if aerr, ok := err.(awserr.Error); assert.True(t, ok, c.kind) {
+				assert.Equal(t, c.code, aerr.Code())
+				assert.Equal(t, c.retryable, isRetryable(err), c.kind)
+			}
+		}
+
+		// Faults stand in for STS, and run out.
+		assert.Equal(t, 0, client.calls)
+
+		_, err := role.Credentials(context.Background())
+		assert.NoError(t, err, c.kind)
+		assert.Equal(t, 1, client.calls)
+	}
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.Error(t, rs.SetRole("test-alias", "test-arn", WithFaults("meltdown", 1)))
+}
+
+func TestFaultsFallback(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("test-alias", testArn, WithFaults(FaultAccessDenied, 1))
+	fc.SetFallbackRole("another-alias")
+
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	req, rec := setupTestRequest("GET", path, nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "another-alias", rec.Header().Get("X-Finto-Role"))
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"))
+}
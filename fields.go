@@ -0,0 +1,85 @@
+package finto
+
+import (
+	"fmt"
+	"sort"
+)
+
+// The fields of credential responses, as EC2 names them.
+var credentialFields = map[string]bool{
+	"Code":            true,
+	"LastUpdated":     true,
+	"Type":            true,
+	"AccessKeyId":     true,
+	"SecretAccessKey": true,
+	"Token":           true,
+	"Expiration":      true,
+	"RoleArn":         true,
+	"AccountId":       true,
+}
+
+// Renames fields of the metadata mock's credential responses, keyed by their
+// EC2 names, e.g. {"Token": "SessionToken"}, for tools that expect another
+// metadata-like service's format. Fields left out keep their EC2 names, which
+// a nil map restores for all of them. The control API serves credentials
+// under their EC2 names regardless.
+func (fc *fintoContext) SetCredentialFields(names map[string]string) error {
+	taken := make(map[string]string)
+	for field := range credentialFields {
+		if _, ok := names[field]; !ok {
+			taken[field] = field
+		}
+	}
+
+	// Iterate in order, so that a conflict is reported consistently.
+	fields := make([]string, 0, len(names))
+	for field := range names {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	for _, field := range fields {
+		name := names[field]
+
+		if !credentialFields[field] {
+			return fmt.Errorf("unknown credential field: %s", field)
+		}
+
+		if name == "" {
+			return fmt.Errorf("credential field %s: empty name", field)
+		}
+
+		if other, ok := taken[name]; ok {
+			return fmt.Errorf("credential fields %s and %s are both named %s", other, field, name)
+		}
+		taken[name] = field
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.fieldNames = names
+	return nil
+}
+
+// Returns a credential response's fields, keyed by their EC2 names, under the
+// names they're configured to be served as.
+func (fc *fintoContext) renameCredentialFields(fields map[string]string) map[string]string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if len(fc.fieldNames) == 0 {
+		return fields
+	}
+
+	renamed := make(map[string]string, len(fields))
+	for field, v := range fields {
+		if name, ok := fc.fieldNames[field]; ok {
+			field = name
+		}
+
+		renamed[field] = v
+	}
+
+	return renamed
+}
@@ -0,0 +1,73 @@
+package finto
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCredentialFields(t *testing.T) {
+	fc := setupTestFintoContext()
+	assert.NoError(t, fc.SetCredentialFields(map[string]string{
+		"Token":       "SessionToken",
+		"AccessKeyId": "access_key_id",
+	}))
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var body map[string]string
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, "mock-token", body["SessionToken"])
+		assert.Equal(t, testArn+"-finto-test-alias", body["access_key_id"])
+		assert.Equal(t, "mock-key", body["SecretAccessKey"])
+
+		for _, field := range []string{"Token", "AccessKeyId"} {
+			_, ok := body[field]
+			assert.False(t, ok, field)
+		}
+	}
+
+	// The control API keeps the EC2 names.
+	req, rec = setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	body = nil
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, "mock-token", body["Token"])
+		_, ok := body["SessionToken"]
+		assert.False(t, ok)
+	}
+
+	// The EC2 names are restored by default.
+	assert.NoError(t, fc.SetCredentialFields(nil))
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	body = nil
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, "mock-token", body["Token"])
+	}
+}
+
+func TestSetCredentialFieldsInvalid(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	for _, names := range []map[string]string{
+		{"SessionToken": "Token"},
+		{"Token": ""},
+		{"Token": "AccessKeyId"},
+		{"Token": "Key", "SecretAccessKey": "Key"},
+	} {
+		assert.Error(t, fc.SetCredentialFields(names), "%v", names)
+	}
+
+	// Fields may swap names.
+	assert.NoError(t, fc.SetCredentialFields(map[string]string{
+		"Token":       "AccessKeyId",
+		"AccessKeyId": "Token",
+	}))
+}
@@ -0,0 +1,126 @@
+package finto
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+)
+
+// RoleGroup is a set of related roles activated together. Its primary role is
+// served as the instance role, while its members are served alongside it from
+// /roles/group/{name}/{member}, e.g. for cross-service calls.
+type RoleGroup struct {
+	Primary string   // The alias served as the instance role
+	Members []string // Aliases of the companion roles
+}
+
+// Returns whether alias names the group's primary role or one of its members.
+func (g RoleGroup) has(alias string) bool {
+	if alias == g.Primary {
+		return true
+	}
+
+	for _, m := range g.Members {
+		if m == alias {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sets the role groups that may be activated. Each group's primary and members
+// must name roles in the set.
+func (fc *fintoContext) SetRoleGroups(groups map[string]RoleGroup) error {
+	for name, g := range groups {
+		for _, alias := range append([]string{g.Primary}, g.Members...) {
+			if _, err := fc.set.Role(alias); err != nil {
+				return fmt.Errorf("group %s: %s", name, err)
+			}
+		}
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.groups = groups
+	return nil
+}
+
+// Returns the names of the role groups, in sorted order.
+func (fc *fintoContext) RoleGroups() []string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	var names []string
+	for name := range fc.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Activates the named group, serving its primary role as the instance role.
+// The group stays active until another role or group is activated.
+func (fc *fintoContext) setActiveGroup(name string) error {
+	fc.m.Lock()
+	g, ok := fc.groups[name]
+	fc.m.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown group: %s", name)
+	}
+
+	if err := fc.setInstanceRole(g.Primary); err != nil {
+		return err
+	}
+
+	fc.m.Lock()
+	fc.activeGroup = name
+	fc.m.Unlock()
+
+	fc.persistState()
+	return nil
+}
+
+// Returns the active group's name, or an empty string if none is active.
+func (fc *fintoContext) getActiveGroup() string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.activeGroup
+}
+
+// Serve the credentials of a member of the active group through the control
+// API.
+func groupCredentials(fc *fintoContext) http.Handler {
+	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+		name, member := vars["name"], vars["member"]
+
+		fc.m.Lock()
+		g, ok := fc.groups[name]
+		active := fc.activeGroup == name
+		fc.m.Unlock()
+
+		if !ok {
+			errorResponse(w, ErrCodeGroupNotFound, fmt.Sprint("unknown group: ", name),
+				http.StatusNotFound)
+			return
+		}
+
+		if !active {
+			errorResponse(w, ErrCodeGroupNotActive, fmt.Sprintf("group %s is not active", name),
+				http.StatusConflict)
+			return
+		}
+
+		if !g.has(member) {
+			errorResponse(w, ErrCodeRoleNotFound, fmt.Sprintf("group %s has no member %s", name, member),
+				http.StatusNotFound)
+			return
+		}
+
+		serveCredentials(fc, w, r, member, errorResponse, false)
+	})
+}
@@ -0,0 +1,86 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetRoleGroups(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	assert.Error(t, fc.SetRoleGroups(map[string]RoleGroup{
+		"dev": {Primary: "test-alias", Members: []string{"missing-alias"}},
+	}))
+	assert.Empty(t, fc.RoleGroups())
+
+	assert.NoError(t, fc.SetRoleGroups(map[string]RoleGroup{
+		"dev": {Primary: "test-alias", Members: []string{"another-alias"}},
+		"ops": {Primary: "another-alias"},
+	}))
+	assert.Equal(t, []string{"dev", "ops"}, fc.RoleGroups())
+}
+
+func TestRoleGroups(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	assert.NoError(t, fc.SetRoleGroups(map[string]RoleGroup{
+		"dev": {Primary: "another-alias", Members: []string{"test-alias"}},
+	}))
+
+	member := func(path string) (*http.Response, map[string]string) {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		var body map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &body)
+
+		return rec.Result(), body
+	}
+
+	// Members are only served while their group is active.
+	resp, body := member("/roles/group/dev/test-alias")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	assert.Equal(t, ErrCodeGroupNotActive, body["code"])
+
+	req, rec := setupTestRequest("PUT", "/roles", bytes.NewBufferString(`{"group":"dev"}`), t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"active_role":"another-alias","active_group":"dev"}`, rec.Body.String())
+	assert.Equal(t, "another-alias", fc.getInstanceRole())
+
+	// The primary is the instance role; the other members are sub-endpoints.
+	for _, alias := range []string{"test-alias", "another-alias"} {
+		resp, _ := member("/roles/group/dev/" + alias)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, alias)
+		assert.Equal(t, alias, resp.Header.Get("X-Finto-Role"))
+	}
+
+	req, rec = setupTestRequest("GET", "/roles/active", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), `"group":"dev"`)
+
+	resp, body = member("/roles/group/missing/test-alias")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, ErrCodeGroupNotFound, body["code"])
+
+	assert.NoError(t, fc.set.SetRole("other-alias", testArn))
+	resp, body = member("/roles/group/dev/other-alias")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, ErrCodeRoleNotFound, body["code"])
+
+	req, rec = setupTestRequest("PUT", "/roles", bytes.NewBufferString(`{"group":"missing"}`), t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// Activating a role deactivates the group.
+	assert.NoError(t, fc.setInstanceRole("test-alias"))
+	assert.Empty(t, fc.getActiveGroup())
+
+	resp, _ = member("/roles/group/dev/test-alias")
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+}
@@ -1,35 +1,513 @@
 package finto
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
 	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Contains application context.
 type fintoContext struct {
-	set          *RoleSet
-	instanceRole string
+	set              *RoleSet
+	instanceRole     string
+	metadataDisabled bool                 // Whether metadata endpoints behave as if IMDS is off
+	instance         InstanceMetadata     // Identifiers served for the mocked instance
+	identity         *identitySigner      // Signs the instance identity document, if set
+	launched         time.Time            // Served as the instance's pendingTime
+	credsTimeout     time.Duration        // Bound on minting credentials per request
+	cors             *CORSConfig          // Cross-origin access to the control API
+	fallbackRole     string               // Served when the instance role fails
+	defaultRole      string               // Restored should the instance role no longer exist
+	groups           map[string]RoleGroup // Role groups that may be activated
+	activeGroup      string               // The active group, whose primary is the instance role
+	webUIDisabled    bool                 // Whether the web UI is hidden
+	debugEndpoints   bool                 // Whether debugging endpoints are served
+	readOnly         bool                 // Whether the control API refuses changes
+	verbose          bool                 // Whether each credential served is logged
+	stsCheck         *stsCheck            // Checks STS's reachability for /readyz, if enabled
+	expiryMin        time.Duration        // Lower bound of overridden expirations
+	expiryMax        time.Duration        // Upper bound of overridden expirations
+	latencyMin       time.Duration        // Lower bound of injected credential latency
+	latencyMax       time.Duration        // Upper bound of injected credential latency
+	routeLatency     routeLatencies       // Latency injected into responses, by route pattern
+	expiredPolicy    ExpiredPolicy        // What to serve when a refresh fails
+	roleChanged      chan struct{}        // Signalled when the instance role changes
+	switches         uint64               // Counts instance role changes, so a pending revert can tell it's stale
+	revert           *time.Timer          // Reverts a temporary activation, if one is pending
+	instances        map[string]*Instance // Instances hosted under /instances/{name}/
+	fieldNames       map[string]string    // Names credential responses' fields are served as, by EC2 name
+	stateFile        string               // Where the state is persisted on each change, if anywhere
+	credsFile        *CredentialsFile     // Where the active role's credentials are written, if anywhere
+	tokenRequired    bool                 // Whether metadata reads need an IMDSv2 token
+	tokens           tokenStore           // Issued IMDSv2 session tokens
+	metrics          *metrics             // Served from /metrics
+	metadataServer   string               // Server header of metadata responses
+	controlServer    string               // Server header of control API responses
+
+	tracer     trace.Tracer                  // Traces requests and AssumeRole calls
+	propagator propagation.TextMapPropagator // Extracts incoming trace context
+
+	m      sync.Mutex
+	stateM sync.Mutex // Serializes writes of the state file
 }
 
-func InitFintoContext(rs *RoleSet, defrole string) (fintoContext, error) {
-	var fc = fintoContext{set: rs}
-	err := fc.setInstanceRole(defrole)
+func InitFintoContext(rs *RoleSet, defrole string) (*fintoContext, error) {
+	var fc = &fintoContext{
+		set:         rs,
+		instance:    NewInstanceMetadata(),
+		launched:    time.Now().UTC().Truncate(time.Second),
+		roleChanged: make(chan struct{}, 1),
+		metrics:     newMetrics(),
+
+		metadataServer: defaultServerHeader,
+	}
+	if err := fc.setInstanceRole(defrole); err != nil {
+		return fc, defaultRoleError(rs, defrole)
+	}
+	fc.defaultRole = rs.canonical(defrole)
 
-	return fc, err
+	return fc, nil
+}
+
+// Returns an error for an invalid default role that names the valid aliases,
+// so that a misconfigured startup explains itself.
+func defaultRoleError(rs *RoleSet, defrole string) error {
+	roles := rs.Roles()
+	if len(roles) == 0 {
+		return fmt.Errorf("unknown default role %q: no roles are configured", defrole)
+	}
+
+	return fmt.Errorf("unknown default role %q: valid roles are %s", defrole,
+		strings.Join(roles, ", "))
 }
 
 func (fc *fintoContext) setInstanceRole(role string) error {
+	_, err := fc.switchInstanceRole(role)
+	return err
+}
+
+// Sets the instance role, returning the number of switches made so far,
+// including this one.
+func (fc *fintoContext) switchInstanceRole(role string) (uint64, error) {
 	if _, err := fc.set.Role(role); err != nil {
-		return err
+		return 0, err
 	}
 
+	// Persisted, and the new role's credentials written out, once unlocked.
+	defer fc.exportActiveCredentials()
+	defer fc.persistState()
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
 	fc.instanceRole = role
+	fc.activeGroup = ""
+	fc.metrics.setActiveRole(role)
+
+	// Any switch supersedes a temporary activation.
+	fc.switches++
+	if fc.revert != nil {
+		fc.revert.Stop()
+		fc.revert = nil
+	}
+
+	// Wake the background refresher, unless a wake-up is already pending.
+	select {
+	case fc.roleChanged <- struct{}{}:
+	default:
+	}
+
+	return fc.switches, nil
+}
+
+func (fc *fintoContext) getInstanceRole() string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.instanceRole
+}
+
+// The Server header sent by EC2's metadata service.
+const defaultServerHeader = "EC2ws"
+
+// Sets the Server header of metadata and control API responses. Metadata
+// responses default to EC2ws, as sent by EC2, while the control API, which EC2
+// has no counterpart of, sends none by default; an empty value omits the
+// header. Must be called before building a router.
+func (fc *fintoContext) SetServerHeaders(metadata, control string) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.metadataServer, fc.controlServer = metadata, control
+}
+
+func (fc *fintoContext) getServerHeaders() (string, string) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.metadataServer, fc.controlServer
+}
+
+// Wraps a handler so that its responses carry the given Server header, unless
+// it is empty.
+func serverHandler(server string, h http.Handler) http.Handler {
+	if server == "" {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", server)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Requires an IMDSv2 session token on metadata reads, as on an instance
+// launched with HttpTokens=required. Tokens are accepted, and validated, either
+// way.
+func (fc *fintoContext) SetTokenRequired(required bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.tokenRequired = required
+}
+
+func (fc *fintoContext) TokenRequired() bool {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.tokenRequired
+}
+
+// Sets a role to serve when the instance role's credentials can't be
+// retrieved. An empty role disables the fallback.
+func (fc *fintoContext) SetFallbackRole(role string) error {
+	if role != "" {
+		if _, err := fc.set.Role(role); err != nil {
+			return err
+		}
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.fallbackRole = role
 	return nil
 }
 
+// Returns the role to fall back to should the given role fail, or an empty
+// string if there is none. Only the instance role falls back.
+func (fc *fintoContext) fallbackFor(role string) string {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if role != fc.instanceRole || role == fc.fallbackRole {
+		return ""
+	}
+
+	return fc.fallbackRole
+}
+
+// Advances the instance role to the next alias in sorted order, wrapping
+// around to the first. Returns the new instance role.
+func (fc *fintoContext) CycleInstanceRole() (string, error) {
+	roles := fc.set.Roles()
+	if len(roles) == 0 {
+		return "", errors.New("no roles to cycle through")
+	}
+
+	current, next := fc.getInstanceRole(), roles[0]
+	for i, alias := range roles {
+		if alias == current {
+			next = roles[(i+1)%len(roles)]
+			break
+		}
+	}
+
+	return next, fc.setInstanceRole(next)
+}
+
+// Enables or disables the metadata endpoints. While disabled, they respond as
+// an instance with IMDS turned off would, which lets SDKs fall back to other
+// credential providers.
+func (fc *fintoContext) SetMetadataDisabled(disabled bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.metadataDisabled = disabled
+}
+
+func (fc *fintoContext) MetadataDisabled() bool {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.metadataDisabled
+}
+
+// CORSConfig configures cross-origin access to the control API, e.g. for a
+// browser-based dashboard. Empty methods and headers fall back to those the
+// control API uses.
+type CORSConfig struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+}
+
+var (
+	defaultCORSMethods = []string{"GET", "PUT", "POST"}
+	defaultCORSHeaders = []string{"Content-Type"}
+)
+
+// Enables CORS on the control API. The metadata routes are never subject to
+// CORS. Must be called before building a router with FintoRouter.
+func (fc *fintoContext) SetCORS(c CORSConfig) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.cors = &c
+}
+
+// Returns the CORS middleware for the control API, or nil if CORS is disabled.
+func (fc *fintoContext) corsHandler() func(http.Handler) http.Handler {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if fc.cors == nil {
+		return nil
+	}
+
+	methods, headers := fc.cors.AllowedMethods, fc.cors.AllowedHeaders
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+
+	return handlers.CORS(
+		handlers.AllowedOrigins(fc.cors.AllowedOrigins),
+		handlers.AllowedMethods(methods),
+		handlers.AllowedHeaders(headers),
+	)
+}
+
+// Bounds the time spent minting credentials for a single request. Zero means no
+// bound beyond the client disconnecting.
+func (fc *fintoContext) SetCredentialsTimeout(d time.Duration) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.credsTimeout = d
+}
+
+// Returns a context for minting credentials on behalf of r. It is cancelled
+// when the client goes away or the credentials timeout passes.
+func (fc *fintoContext) credentialsContext(r *http.Request) (context.Context, context.CancelFunc) {
+	fc.m.Lock()
+	timeout := fc.credsTimeout
+	fc.m.Unlock()
+
+	if timeout > 0 {
+		return context.WithTimeout(r.Context(), timeout)
+	}
+
+	return context.WithCancel(r.Context())
+}
+
+// ExpiredPolicy determines what is served when a role's credentials have
+// expired and can't be refreshed, after any fallback role has also failed.
+type ExpiredPolicy int
+
+const (
+	ExpiredError      ExpiredPolicy = iota // Respond with an error, so SDKs retry
+	ExpiredServeStale                      // Serve the last-known credentials with a Warning header
+)
+
+// Parses an ExpiredPolicy from its name: "error" or "stale".
+func ParseExpiredPolicy(s string) (ExpiredPolicy, error) {
+	switch s {
+	case "error":
+		return ExpiredError, nil
+	case "stale":
+		return ExpiredServeStale, nil
+	}
+
+	return ExpiredError, fmt.Errorf("unknown expired policy: %s", s)
+}
+
+// Sets what is served when credentials can't be refreshed. ExpiredError is the
+// default.
+func (fc *fintoContext) SetExpiredPolicy(p ExpiredPolicy) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.expiredPolicy = p
+}
+
+func (fc *fintoContext) getExpiredPolicy() ExpiredPolicy {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.expiredPolicy
+}
+
+// Overrides the reported expiration of served credentials with a random time
+// between min and max from now, to exercise SDK refresh logic quickly. The
+// credentials themselves are unchanged, and the reported expiration is never
+// later than the real one. A zero max disables the override.
+func (fc *fintoContext) SetExpirationOverride(min, max time.Duration) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.expiryMin, fc.expiryMax = min, max
+}
+
+// Returns the expiration to report for credentials expiring at t.
+func (fc *fintoContext) reportedExpiration(t time.Time) time.Time {
+	fc.m.Lock()
+	min, max := fc.expiryMin, fc.expiryMax
+	fc.m.Unlock()
+
+	if max <= 0 {
+		return t
+	}
+
+	d := min
+	if max > min {
+		d += time.Duration(rand.Int63n(int64(max - min)))
+	}
+
+	if override := time.Now().Add(d); override.Before(t) {
+		return override
+	}
+
+	return t
+}
+
+// Enables or disables the web UI served at /. It is enabled by default.
+func (fc *fintoContext) SetWebUI(enabled bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.webUIDisabled = !enabled
+}
+
+func (fc *fintoContext) WebUIEnabled() bool {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return !fc.webUIDisabled
+}
+
+// Logs each credential served: the role, whether the credentials came from
+// the cache or were fetched from STS, and how long they have left.
+func (fc *fintoContext) SetVerbose(verbose bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.verbose = verbose
+}
+
+// Records credentials of a role being served, fetched from STS or from the
+// cache, in metrics and, if verbose, the log.
+func (fc *fintoContext) credentialsServed(alias string, creds Credentials, fetched bool) {
+	result := "cache"
+	if fetched {
+		result = "sts"
+	}
+
+	ttl := creds.Expiration.Sub(time.Now())
+	fc.metrics.credentialsServed(result, ttl)
+
+	fc.m.Lock()
+	verbose := fc.verbose
+	fc.m.Unlock()
+
+	if verbose {
+		log.Printf("served role %s from %s, expiring in %s", alias, result, ttl.Truncate(time.Second))
+	}
+}
+
+// Enables or disables debugging endpoints, which reveal more of STS's responses
+// than credentials alone. They are disabled by default.
+func (fc *fintoContext) SetDebugEndpoints(enabled bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.debugEndpoints = enabled
+}
+
+func (fc *fintoContext) DebugEndpointsEnabled() bool {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.debugEndpoints
+}
+
+// Makes the control API refuse every request that would change what finto
+// serves, e.g. switching the active role, with a 403. Credentials, metadata,
+// and the control API's reads are served as usual.
+func (fc *fintoContext) SetReadOnly(readOnly bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.readOnly = readOnly
+}
+
+func (fc *fintoContext) ReadOnly() bool {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.readOnly
+}
+
+// Wraps a handler of a control API change so that it is refused in read-only
+// mode.
+func readOnlyHandler(fc *fintoContext, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fc.ReadOnly() {
+			errorResponse(w, ErrCodeReadOnly, "finto is read-only", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Sets the identifiers served for the mocked instance. Empty fields keep the
+// values generated at startup.
+func (fc *fintoContext) SetInstanceMetadata(im InstanceMetadata) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.instance = im.Merge(fc.instance)
+}
+
+func (fc *fintoContext) getInstanceMetadata() InstanceMetadata {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.instance
+}
+
 // VarsHandlerFunc accepts mux route variables as an argument.
 type VarsHandlerFunc func(http.ResponseWriter, *http.Request, map[string]string)
 
@@ -38,18 +516,210 @@ func (f VarsHandlerFunc) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	f(w, r, vars)
 }
 
-// List available roles.
+// List available roles. With detail=1, each role is listed along with the
+// outcome of its recent credential refreshes. Roles may be filtered by alias
+// prefix=, and paged through with limit= and offset=; a page followed by more
+// roles gives the offset of the next in next_offset. With group_by=account,
+// the page's roles are keyed by the account of their ARN.
 func rolesList(fc *fintoContext) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		groupBy := r.FormValue("group_by")
+		if groupBy != "" && groupBy != "account" {
+			errorResponse(w, ErrCodeInvalidRequest, fmt.Sprintf("invalid group_by: %q; use account", groupBy),
+				http.StatusBadRequest)
+			return
+		}
+
 		var roles []string
 
 		if r.FormValue("status") == "active" {
-			roles = []string{fc.instanceRole}
+			roles = []string{fc.getInstanceRole()}
 		} else {
 			roles = fc.set.Roles()
 		}
 
-		jsonResponse(w, map[string][]string{"roles": roles})
+		if prefix := r.FormValue("prefix"); prefix != "" {
+			matched := []string{}
+			for _, alias := range roles {
+				if strings.HasPrefix(alias, prefix) {
+					matched = append(matched, alias)
+				}
+			}
+			roles = matched
+		}
+
+		roles, next, err := paginate(roles, r.FormValue("offset"), r.FormValue("limit"))
+		if err != nil {
+			errorResponse(w, ErrCodeInvalidRequest, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		resp := map[string]interface{}{"roles": roles}
+		if next > 0 {
+			resp["next_offset"] = next
+		}
+
+		if r.FormValue("detail") != "1" {
+			if groupBy == "account" {
+				grouped := make(map[string][]string)
+				for _, alias := range roles {
+					account := fc.roleAccount(alias)
+					grouped[account] = append(grouped[account], alias)
+				}
+
+				resp["roles"] = grouped
+			}
+
+			jsonResponse(w, resp)
+			return
+		}
+
+		type roleDetail struct {
+			Alias       string `json:"alias"`
+			LastError   string `json:"last_error,omitempty"`
+			LastErrorAt string `json:"last_error_at,omitempty"`
+			LastRefresh string `json:"last_refresh,omitempty"`
+		}
+
+		details := make([]roleDetail, 0, len(roles))
+		for _, alias := range roles {
+			role, err := fc.set.Role(alias)
+			if err != nil {
+				continue
+			}
+
+			status := role.Status()
+			detail := roleDetail{Alias: alias}
+
+			if status.LastError != nil {
+				detail.LastError = status.LastError.Error()
+				detail.LastErrorAt = formatTime(status.LastErrorAt)
+			}
+
+			if !status.LastRefresh.IsZero() {
+				detail.LastRefresh = formatTime(status.LastRefresh)
+			}
+
+			details = append(details, detail)
+		}
+
+		resp["roles"] = details
+
+		if groupBy == "account" {
+			grouped := make(map[string][]roleDetail)
+			for _, detail := range details {
+				account := fc.roleAccount(detail.Alias)
+				grouped[account] = append(grouped[account], detail)
+			}
+
+			resp["roles"] = grouped
+		}
+
+		jsonResponse(w, resp)
+	})
+}
+
+// The account roles are grouped under when their ARN has none.
+const unknownAccount = "unknown"
+
+// Returns the account ID of the role with the given alias, or unknownAccount
+// if its ARN can't be parsed for one.
+func (fc *fintoContext) roleAccount(alias string) string {
+	role, err := fc.set.Role(alias)
+	if err != nil {
+		return unknownAccount
+	}
+
+	if account := accountFromArn(role.Arn()); account != "" {
+		return account
+	}
+
+	return unknownAccount
+}
+
+// Returns the page of roles from offset, of up to limit roles, and the offset
+// of the next page, or zero if there are no more. Either may be empty, for the
+// first page, or all the remaining roles.
+func paginate(roles []string, offset, limit string) ([]string, int, error) {
+	start, n := 0, len(roles)
+
+	if offset != "" {
+		var err error
+		if start, err = strconv.Atoi(offset); err != nil || start < 0 {
+			return nil, 0, fmt.Errorf("invalid offset: %q", offset)
+		}
+	}
+
+	if limit != "" {
+		var err error
+		if n, err = strconv.Atoi(limit); err != nil || n < 1 {
+			return nil, 0, fmt.Errorf("invalid limit: %q", limit)
+		}
+	}
+
+	if start > len(roles) {
+		start = len(roles)
+	}
+
+	end, next := len(roles), 0
+	if n < end-start {
+		end = start + n
+		next = end
+	}
+
+	return roles[start:end], next, nil
+}
+
+// Show the role served as the instance profile role, and when its cached
+// credentials expire. Credentials aren't retrieved to answer, so expiration is
+// omitted until they first are.
+func rolesActive(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alias := fc.getInstanceRole()
+
+		role, err := fc.set.Role(alias)
+		if err != nil {
+			errorResponse(w, ErrCodeNoActiveRole, "no active role", http.StatusNotFound)
+			return
+		}
+
+		type activeRole struct {
+			Alias       string `json:"alias"`
+			Arn         string `json:"arn"`
+			SessionName string `json:"session_name"`
+			Expiration  string `json:"expiration,omitempty"`
+			TTLSeconds  int64  `json:"ttl_seconds"`
+			Group       string `json:"group,omitempty"`
+		}
+
+		active := activeRole{
+			Alias:       alias,
+			Arn:         role.Arn(),
+			SessionName: role.SessionName(),
+			Group:       fc.getActiveGroup(),
+		}
+
+		if expiration := role.Expiration(); !expiration.IsZero() {
+			active.Expiration = formatTime(expiration)
+
+			if ttl := time.Until(expiration); ttl > 0 {
+				active.TTLSeconds = int64(ttl / time.Second)
+			}
+		}
+
+		jsonResponse(w, active)
+	})
+}
+
+// Show the build of finto that is running, and the Go it was built with.
+func versionShow(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jsonResponse(w, map[string]string{
+			"version":    Version,
+			"commit":     Commit,
+			"build_date": BuildDate,
+			"go_version": runtime.Version(),
+		})
 	})
 }
 
@@ -58,95 +728,672 @@ func rolesShow(fc *fintoContext) http.Handler {
 	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
 		role, err := fc.set.Role(vars["alias"])
 		if err != nil {
-			errorResponse(w, err.Error(), http.StatusNotFound)
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusNotFound)
 			return
 		}
 
-		jsonResponse(w, map[string]string{
+		show := map[string]interface{}{
 			"arn":          role.Arn(),
 			"session_name": role.SessionName(),
+		}
+
+		// Spelled out for confirming which account the role is in, whatever
+		// its partition.
+		if account := accountFromArn(role.Arn()); account != "" {
+			show["account_id"] = account
+		}
+
+		if profile := role.SourceProfile(); profile != "" {
+			show["source_profile"] = profile
+		}
+
+		if aliases := role.Aliases(); len(aliases) > 0 {
+			show["aliases"] = aliases
+		}
+
+		if name := role.ProfileName(); name != "" {
+			show["profile_name"] = name
+		}
+
+		if id := role.SourceIdentity(); id != "" {
+			show["source_identity"] = id
+		}
+
+		// A failed refresh is reported until a later one succeeds.
+		if status := role.Status(); status.LastError != nil {
+			show["last_error"] = status.LastError.Error()
+			show["last_error_at"] = formatTime(status.LastErrorAt)
+		}
+
+		jsonResponse(w, show)
+	})
+}
+
+// Show the details of assuming a role that its credentials don't carry, such as
+// the assumed-role user, for diagnosing trust policies. Credentials are
+// retrieved if they have expired, and their secrets are redacted unless
+// requested with reveal=1. Served only while debugging endpoints are enabled.
+func rolesAssumeDetails(fc *fintoContext) http.Handler {
+	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+		if !fc.DebugEndpointsEnabled() {
+			notFound(w, r)
+			return
+		}
+
+		role, err := fc.set.Role(vars["alias"])
+		if err != nil {
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		// The details carry the role's credentials, so are only served to
+		// clients the role is.
+		if ip := clientIP(r); !role.Permits(ip) {
+			log.Printf("warning: refused role %s to client %s", vars["alias"], ip)
+			errorResponse(w, ErrCodeClientForbidden, fmt.Sprintf("role %s is not served to this client", vars["alias"]),
+				http.StatusForbidden)
+			return
+		}
+
+		ctx, cancel := fc.credentialsContext(r)
+		defer cancel()
+
+		creds, err := role.Credentials(ctx)
+		if err != nil {
+			errorResponse(w, ErrCodeAssumeFailed, fmt.Sprint("failed to assume role: ", err),
+				http.StatusInternalServerError)
+			return
+		}
+
+		secret, token := redact(creds.SecretAccessKey), redact(creds.SessionToken)
+		if r.URL.Query().Get("reveal") == "1" {
+			secret, token = creds.SecretAccessKey, creds.SessionToken
+		}
+
+		details := role.AssumeDetails()
+
+		jsonResponse(w, map[string]interface{}{
+			"arn":                role.Arn(),
+			"assumed_role_arn":   details.AssumedRoleArn,
+			"assumed_role_id":    details.AssumedRoleId,
+			"packed_policy_size": details.PackedPolicySize,
+			"source_identity":    details.SourceIdentity,
+			"credentials": map[string]string{
+				"access_key_id":     creds.AccessKeyId,
+				"secret_access_key": secret,
+				"session_token":     token,
+				"expiration":        formatTime(creds.Expiration),
+				"last_updated":      formatTime(creds.LastUpdated),
+			},
 		})
 	})
 }
 
-// Set role to be served as the instance profile role.
+// Set role to be served as the instance profile role, or activate a group to
+// serve its primary role.
 func rolesSetActive(fc *fintoContext) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		type activateRequest struct {
 			Alias string `json:"alias"`
+			Group string `json:"group,omitempty"`
 		}
 
 		var req activateRequest
 
-		decoder := json.NewDecoder(r.Body)
-		if err := decoder.Decode(&req); err != nil {
-			errorResponse(w, fmt.Sprint("failed to parse body: ", err),
-				http.StatusBadRequest)
+		if err := decodeBody(w, r, &req); err != nil {
+			fc.metrics.roleSwitched(err)
+			bodyErrorResponse(w, err)
 			return
 		}
 
-		if err := fc.setInstanceRole(req.Alias); err != nil {
-			errorResponse(w, err.Error(), http.StatusBadRequest)
+		if req.Group != "" {
+			err := fc.setActiveGroup(req.Group)
+			fc.metrics.roleSwitched(err)
+
+			if err != nil {
+				errorResponse(w, ErrCodeGroupNotFound, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			jsonResponse(w, map[string]string{
+				"active_role":  fc.getInstanceRole(),
+				"active_group": fc.getActiveGroup(),
+			})
 			return
 		}
 
-		jsonResponse(w, map[string]string{"active_role": fc.instanceRole})
+		err := fc.setInstanceRole(req.Alias)
+		fc.metrics.roleSwitched(err)
+
+		if err != nil {
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		jsonResponse(w, map[string]string{"active_role": fc.getInstanceRole()})
 	})
 }
 
-// Mock the EC2 security-credentials meta-data endpoint.
-func mockProfile(fc *fintoContext) http.Handler {
+// Show whether the metadata endpoints are enabled.
+func metadataShow(fc *fintoContext) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(fc.instanceRole))
+		jsonResponse(w, map[string]bool{"enabled": !fc.MetadataDisabled()})
 	})
 }
 
-// Mock the EC2 instance profile role meta-data endpoint.
-func mockProfileCreds(fc *fintoContext) http.Handler {
-	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
-		role, err := fc.set.Role(vars["alias"])
+// Enable or disable the metadata endpoints.
+func metadataSet(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type metadataRequest struct {
+			Enabled *bool `json:"enabled"`
+		}
+
+		var req metadataRequest
+
+		if err := decodeBody(w, r, &req); err != nil {
+			bodyErrorResponse(w, err)
+			return
+		}
+
+		if req.Enabled == nil {
+			errorResponse(w, ErrCodeInvalidRequest, "missing field: enabled", http.StatusBadRequest)
+			return
+		}
+
+		fc.SetMetadataDisabled(!*req.Enabled)
+		jsonResponse(w, map[string]bool{"enabled": *req.Enabled})
+	})
+}
+
+// Wraps a metadata mock handler so that it refuses requests while the metadata
+// service is disabled, mirroring an instance launched with its metadata
+// endpoint turned off.
+func metadataHandler(fc *fintoContext, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fc.MetadataDisabled() {
+			metadataErrorResponse(w, "instance metadata service disabled",
+				http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Mock the IMDSv2 session token endpoint. The token's lifetime is given in
+// seconds by the X-aws-ec2-metadata-token-ttl-seconds header.
+func mockToken(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ttl, err := strconv.Atoi(r.Header.Get(tokenTTLHeader))
+		if err != nil || ttl < minTokenTTL || ttl > maxTokenTTL {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		token := fc.tokens.issue(time.Duration(ttl) * time.Second)
+
+		w.Header().Set(tokenTTLHeader, strconv.Itoa(ttl))
+		textResponse(w, token)
+	})
+}
+
+// Headers of the IMDSv2 session token protocol.
+const (
+	tokenHeader    = "X-aws-ec2-metadata-token"
+	tokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+)
+
+// Wraps a metadata mock handler so that it enforces IMDSv2 session tokens.
+// Requests with an invalid token, or without one while tokens are required,
+// get a bare 401 as from EC2, which is what prompts SDKs to fetch a new token.
+// They are rejected before h runs, so credentials are never minted for them.
+func tokenHandler(fc *fintoContext, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(tokenHeader)
+
+		if (token == "" && fc.TokenRequired()) || (token != "" && !fc.tokens.valid(token)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// Mock the EC2 meta-data directory listing.
+func mockMetadataIndex(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textResponse(w, "ami-id\ninstance-id\ninstance-type\niam/")
+	})
+}
+
+// Mock the EC2 iam meta-data directory listing.
+func mockIamIndex(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textResponse(w, "info\nsecurity-credentials/")
+	})
+}
+
+// Mock the EC2 iam/info meta-data endpoint, which describes the instance
+// profile associated with the instance role.
+func mockIamInfo(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, err := fc.set.Role(fc.instanceRoleFor(r))
 		if err != nil {
-			errorResponse(w, err.Error(), http.StatusNotFound)
+			metadataErrorResponse(w, err.Error(), http.StatusNotFound)
 			return
 		}
 
-		creds, err := role.Credentials()
+		arn, id, err := instanceProfileFromArn(role.Arn(), role.ProfileName())
 		if err != nil {
-			errorResponse(w, fmt.Sprint("failed to assume role: ", err),
-				http.StatusInternalServerError)
+			metadataErrorResponse(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
-		// There's technically no reason to pretty print here, but do so to
-		// maintain parity in the mock service. Uses MarshalIndent as
-		// Encoder.Encode does not offer a means to do so.
 		b, err := json.MarshalIndent(map[string]string{
-			"Code":            "Success",
-			"LastUpdated":     "2015-07-07T23:06:33Z",
-			"Type":            "AWS-HMAC",
-			"AccessKeyId":     creds.AccessKeyId,
-			"SecretAccessKey": creds.SecretAccessKey,
-			"Token":           creds.SessionToken,
-			"Expiration":      creds.Expiration.Format("2006-01-02T15:04:05Z"),
+			"Code":               imdsSuccess,
+			"LastUpdated":        "2015-07-07T23:06:33Z",
+			"InstanceProfileArn": arn,
+			"InstanceProfileId":  id,
 		}, "", "  ")
 
 		if err != nil {
-			errorResponse(w, fmt.Sprint("failed to render: ", err),
+			metadataErrorResponse(w, fmt.Sprint("failed to render: ", err),
 				http.StatusInternalServerError)
 			return
 		}
 
+		w.Header().Set("Content-Type", "application/json")
 		w.Write(b)
 	})
 }
 
+// Mock the EC2 ami-id meta-data endpoint.
+func mockAmiId(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textResponse(w, fc.getInstanceMetadata().AmiId)
+	})
+}
+
+// Mock the EC2 instance-id meta-data endpoint.
+func mockInstanceId(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textResponse(w, fc.getInstanceMetadata().InstanceId)
+	})
+}
+
+// Mock the EC2 instance-type meta-data endpoint.
+func mockInstanceType(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		textResponse(w, fc.getInstanceMetadata().InstanceType)
+	})
+}
+
+// Mock the EC2 security-credentials meta-data endpoint. The instance role is
+// listed under its profile name, if it has one. With no active role, it's not
+// found, as on an instance without an instance profile.
+func mockProfile(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alias := fc.instanceRoleFor(r)
+
+		role, err := fc.set.Role(alias)
+		if err != nil {
+			metadataErrorResponse(w, "no active role", http.StatusNotFound)
+			return
+		}
+
+		if role.ProfileName() != "" {
+			alias = role.ProfileName()
+		}
+
+		textResponse(w, alias)
+	})
+}
+
+// Mock the EC2 instance profile role meta-data endpoint. If the instance role
+// fails and a fallback role is set, the fallback's credentials are served. If
+// that fails too, the expired policy decides between an error and the role's
+// last-known credentials. Should credentials be mid-refresh, the refreshing
+// policy may instead have a 503 sent. The X-Finto-Role header names the role
+// that was served. Responses carry an ETag of the credentials, and conditional
+// requests for unchanged credentials get a 304. Responses are delayed by any
+// injected latency, and their fields may be renamed with SetCredentialFields.
+// Credentials that can't be retrieved are reported in IMDS's error shape,
+// other errors as a bare status. With no active role, no role's credentials
+// are found.
+func mockProfileCreds(fc *fintoContext) http.Handler {
+	creds := latencyHandler(fc.latency, profileCreds(fc, func(w http.ResponseWriter, code, message string, status int) {
+		if code == ErrCodeAssumeFailed {
+			metadataCredentialsError(w, message, status)
+			return
+		}
+
+		metadataErrorResponse(w, message, status)
+	}, true))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := fc.set.Role(fc.instanceRoleFor(r)); err != nil {
+			metadataErrorResponse(w, "no active role", http.StatusNotFound)
+			return
+		}
+
+		creds.ServeHTTP(w, r)
+	})
+}
+
+// Serve a role's credentials through the control API, as the metadata mock
+// does but with JSON errors and fields under their EC2 names.
+func rolesCredentials(fc *fintoContext) http.Handler {
+	return profileCreds(fc, errorResponse, false)
+}
+
+// Serve credentials through the control API for the role with the ARN given by
+// the arn query parameter, for callers that don't know its alias.
+func arnCredentials(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arn := r.URL.Query().Get("arn")
+		if arn == "" {
+			errorResponse(w, ErrCodeInvalidRequest, "missing parameter: arn", http.StatusBadRequest)
+			return
+		}
+
+		alias, err := fc.set.AliasByArn(arn)
+		if _, ok := err.(*AmbiguousArnError); ok {
+			errorResponse(w, ErrCodeAmbiguousArn, err.Error(), http.StatusConflict)
+			return
+		} else if err != nil {
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		serveCredentials(fc, w, r, alias, errorResponse, false)
+	})
+}
+
+// Writes an error response with a machine-readable code, a message, and a
+// status code.
+type errorFunc func(w http.ResponseWriter, code, message string, status int)
+
+func profileCreds(fc *fintoContext, fail errorFunc, rename bool) http.Handler {
+	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+		serveCredentials(fc, w, r, vars["alias"], fail, rename)
+	})
+}
+
+// Serves the credentials of the role with the given alias, or those of the
+// fallback role should the instance role fail. Fields are renamed as set with
+// SetCredentialFields only if rename is set, as it is for the metadata mock.
+func serveCredentials(fc *fintoContext, w http.ResponseWriter, r *http.Request, alias string, fail errorFunc, rename bool) {
+	role, err := fc.set.Role(alias)
+	if err != nil {
+		fail(w, ErrCodeRoleNotFound, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	// The role may be requested by any of its names.
+	alias = fc.set.canonical(alias)
+	requested, requestedAlias := role, alias
+
+	// A pinned listener's instance has no other role to serve.
+	pinned, isPinned := pinnedRole(r)
+	if isPinned && alias != pinned {
+		fail(w, ErrCodeRoleNotFound, fmt.Sprintf("unknown role: %s", alias), http.StatusNotFound)
+		return
+	}
+
+	ip := clientIP(r)
+	if !role.Permits(ip) {
+		log.Printf("warning: refused role %s to client %s", alias, ip)
+		fail(w, ErrCodeClientForbidden, fmt.Sprintf("role %s is not served to this client", alias),
+			http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := fc.credentialsContext(r)
+	defer cancel()
+
+	creds, fetched, err := role.credentials(ctx)
+	if err == ErrRefreshing {
+		// The role is fine, only busy, so neither the fallback nor stale
+		// credentials are in order.
+		w.Header().Set("Retry-After", "1")
+		fail(w, ErrCodeRefreshing, fmt.Sprintf("credentials of role %s are being refreshed", alias),
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	if fallback := fc.fallbackFor(alias); err != nil && fallback != "" && !isPinned {
+		log.Printf("warning: failed to assume role %s, serving fallback role %s: %s",
+			alias, fallback, err)
+
+		if role, err = fc.set.Role(fallback); err == nil {
+			// The fallback is only served to clients it permits itself.
+			if role.Permits(ip) {
+				alias = fallback
+				creds, fetched, err = role.credentials(ctx)
+			} else {
+				err = fmt.Errorf("fallback role %s is not served to this client", fallback)
+			}
+		}
+	}
+
+	if err != nil && fc.getExpiredPolicy() == ExpiredServeStale {
+		if stale, ok := requested.LastCredentials(); ok {
+			log.Printf("warning: failed to refresh role %s, serving expired credentials: %s",
+				requestedAlias, err)
+
+			alias, role, creds, fetched, err = requestedAlias, requested, stale, false, nil
+			w.Header().Set("Warning", `110 finto "Response is Stale"`)
+		}
+	}
+
+	if err != nil {
+		// AWS's ID for the failed request is needed to open a support case.
+		if id := awsRequestID(err); id != "" {
+			log.Printf("warning: failed to assume role %s: %s (aws_request_id=%s)", alias, err, id)
+			w.Header().Set(AWSRequestIDHeader, id)
+		}
+
+		fail(w, ErrCodeAssumeFailed, fmt.Sprint("failed to assume role: ", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	fc.credentialsServed(alias, creds, fetched)
+
+	fields := map[string]string{
+		"Code":            imdsSuccess,
+		"LastUpdated":     formatTime(creds.LastUpdated),
+		"Type":            role.CredentialType(),
+		"AccessKeyId":     creds.AccessKeyId,
+		"SecretAccessKey": creds.SecretAccessKey,
+		"Token":           creds.SessionToken,
+		"Expiration":      formatTime(fc.reportedExpiration(creds.Expiration)),
+		"RoleArn":         role.Arn(),
+		"AccountId":       accountFromArn(role.Arn()),
+	}
+
+	if rename {
+		fields = fc.renameCredentialFields(fields)
+	}
+
+	// There's technically no reason to pretty print here, but do so to
+	// maintain parity in the mock service. Uses MarshalIndent as
+	// Encoder.Encode does not offer a means to do so.
+	b, err := json.MarshalIndent(fields, "", "  ")
+	if err != nil {
+		fail(w, ErrCodeInternal, fmt.Sprint("failed to render: ", err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	etag := payloadETag(b)
+
+	w.Header().Set("X-Finto-Role", alias)
+	w.Header().Set("ETag", etag)
+
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Returns a strong entity tag for a response body.
+func payloadETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Returns whether an If-None-Match header matches etag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Formats t the way EC2 meta-data does.
+func formatTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// The largest request body the control API reads. Its bodies are small JSON
+// objects, so anything larger is refused rather than read into memory.
+const maxBodySize = 64 << 10
+
+var errBodyTooLarge = fmt.Errorf("body exceeds %d bytes", maxBodySize)
+
+// Decodes r's JSON body into v, returning errBodyTooLarge without reading
+// further should it exceed maxBodySize.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		if len(b) >= maxBodySize {
+			return errBodyTooLarge
+		}
+
+		return err
+	}
+
+	return json.NewDecoder(bytes.NewReader(b)).Decode(v)
+}
+
+// Writes the error response to a body decodeBody failed to decode.
+func bodyErrorResponse(w http.ResponseWriter, err error) {
+	if err == errBodyTooLarge {
+		errorResponse(w, ErrCodeBodyTooLarge, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	errorResponse(w, ErrCodeInvalidRequest, fmt.Sprint("failed to parse body: ", err),
+		http.StatusBadRequest)
+}
+
 func jsonResponse(w http.ResponseWriter, body interface{}) {
+	jsonStatusResponse(w, body, http.StatusOK)
+}
+
+// Writes a JSON response with the given status. The body is encoded before
+// anything is written, so that a body that can't be is reported with a 500
+// rather than sent truncated with the intended status.
+func jsonStatusResponse(w http.ResponseWriter, body interface{}, status int) {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(body); err != nil {
+		log.Printf("failed to encode response: %s", err)
+
+		// An errorBody is only strings, so it always encodes.
+		errorResponse(w, ErrCodeInternal, "failed to render response", http.StatusInternalServerError)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.Header().Set("Server", "EC2ws")
-	json.NewEncoder(w).Encode(body)
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// Writes a plaintext metadata response, as EC2 does for everything but JSON
+// documents.
+func textResponse(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(body))
 }
 
-func errorResponse(w http.ResponseWriter, message string, code int) {
+// Writes a JSON error, including the request's ID if RequestIDHandler gave it
+// one, and that of a failed AWS request behind it.
+func errorResponse(w http.ResponseWriter, code, message string, status int) {
+	id, awsID := w.Header().Get(RequestIDHeader), w.Header().Get(AWSRequestIDHeader)
+
+	jsonStatusResponse(w, errorBody{Error: RedactSecrets(message), Code: code, RequestID: id, AWSRequestID: awsID}, status)
+}
+
+// Writes a metadata error the way EC2 does, as a bare plaintext status, e.g.
+// "404 - Not Found". The message isn't sent, so server errors log it instead.
+func metadataErrorResponse(w http.ResponseWriter, message string, code int) {
+	if code >= http.StatusInternalServerError {
+		log.Println("metadata error:", RedactSecrets(message))
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(code)
-	jsonResponse(w, map[string]string{"error": message})
+	fmt.Fprintf(w, "%d - %s", code, http.StatusText(code))
+}
+
+// The codes IMDS reports with an instance's credentials, and when its role
+// can't be assumed. Clients check for imdsSuccess before using credentials.
+const (
+	imdsSuccess          = "Success"
+	imdsAssumeRoleFailed = "AssumeRoleUnauthorizedAccess"
+)
+
+// Writes a failure to retrieve credentials the way IMDS does, as a JSON body
+// with a Code other than Success, so that SDKs parsing it report the message.
+func metadataCredentialsError(w http.ResponseWriter, message string, status int) {
+	message = RedactSecrets(message)
+	log.Println("metadata error:", message)
+
+	b, err := json.MarshalIndent(map[string]string{
+		"Code":        imdsAssumeRoleFailed,
+		"Message":     message,
+		"LastUpdated": formatTime(time.Now()),
+	}, "", "  ")
+
+	if err != nil {
+		metadataErrorResponse(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// Responds to requests with a method that none of their path's routes accept,
+// listing those that are in the Allow header.
+func methodNotAllowed(methods []string) http.Handler {
+	allow := strings.Join(methods, ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		errorResponse(w, ErrCodeMethodNotAllowed, fmt.Sprintf("method %s not allowed; use %s", r.Method, allow),
+			http.StatusMethodNotAllowed)
+	})
+}
+
+// Responds to paths no route matches, with a metadata error under /latest/
+// and a JSON error elsewhere. Metadata paths requested with another method are
+// also not found, as on EC2, rather than the router's 405.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/latest/") {
+		metadataErrorResponse(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	errorResponse(w, ErrCodeNotFound, "not found", http.StatusNotFound)
 }
@@ -2,12 +2,17 @@ package finto
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,10 +27,15 @@ func setupTestRequest(m, p string, b io.Reader, t *testing.T) (*http.Request, *h
 	return req, rec
 }
 
-func setupTestFintoContext() (fc fintoContext) {
+const (
+	testArn    = "arn:aws:iam::123456789012:role/test"
+	anotherArn = "arn:aws:iam::210987654321:role/another"
+)
+
+func setupTestFintoContext() (fc *fintoContext) {
 	ts := NewRoleSet(&MockAssumeRoleClient{})
-	ts.SetRole("test-alias", "test-arn")
-	ts.SetRole("another-alias", "another-arn")
+	ts.SetRole("test-alias", testArn)
+	ts.SetRole("another-alias", anotherArn)
 
 	fc, _ = InitFintoContext(ts, "test-alias")
 
@@ -64,6 +74,18 @@ func TestFintoHandlers(t *testing.T) {
 				},
 			},
 		},
+		{
+			"GET",
+			"/roles?detail=1",
+			nil,
+			http.StatusOK,
+			map[string]interface{}{
+				"roles": []interface{}{
+					map[string]interface{}{"alias": "another-alias"},
+					map[string]interface{}{"alias": "test-alias"},
+				},
+			},
+		},
 		{
 			"PUT",
 			"/roles",
@@ -80,6 +102,7 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusBadRequest,
 			map[string]interface{}{
 				"error": "unknown role: missing-alias",
+				"code":  "role_not_found",
 			},
 		},
 		{
@@ -89,6 +112,35 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusBadRequest,
 			map[string]interface{}{
 				"error": "failed to parse body: json: cannot unmarshal string into Go value of type finto.activateRequest",
+				"code":  "invalid_request",
+			},
+		},
+		{
+			"GET",
+			"/metadata",
+			nil,
+			http.StatusOK,
+			map[string]interface{}{
+				"enabled": true,
+			},
+		},
+		{
+			"PUT",
+			"/metadata",
+			bytes.NewBuffer([]byte(`{"enabled":false}`)),
+			http.StatusOK,
+			map[string]interface{}{
+				"enabled": false,
+			},
+		},
+		{
+			"PUT",
+			"/metadata",
+			bytes.NewBuffer([]byte(`{}`)),
+			http.StatusBadRequest,
+			map[string]interface{}{
+				"error": "missing field: enabled",
+				"code":  "invalid_request",
 			},
 		},
 		{
@@ -97,7 +149,8 @@ func TestFintoHandlers(t *testing.T) {
 			nil,
 			http.StatusOK,
 			map[string]interface{}{
-				"arn":          "test-arn",
+				"account_id":   "123456789012",
+				"arn":          testArn,
 				"session_name": "finto-test-alias",
 			},
 		},
@@ -108,6 +161,7 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusNotFound,
 			map[string]interface{}{
 				"error": "unknown role: missing-alias",
+				"code":  "role_not_found",
 			},
 		},
 		{
@@ -117,12 +171,13 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusOK,
 			map[string]interface{}{
 				"Code":            "Success",
-				"LastUpdated":     "2015-07-07T23:06:33Z",
 				"Type":            "AWS-HMAC",
-				"AccessKeyId":     "test-arn-finto-test-alias",
+				"AccessKeyId":     testArn + "-finto-test-alias",
 				"SecretAccessKey": "mock-key",
 				"Token":           "mock-token",
-				"Expiration":      me.Format("2006-01-02T15:04:05Z"),
+				"Expiration":      formatTime(me),
+				"RoleArn":         testArn,
+				"AccountId":       "123456789012",
 			},
 		},
 		{
@@ -132,6 +187,7 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusNotFound,
 			map[string]interface{}{
 				"error": "unknown role: missing-alias",
+				"code":  "role_not_found",
 			},
 		},
 		{
@@ -141,28 +197,30 @@ func TestFintoHandlers(t *testing.T) {
 			http.StatusOK,
 			map[string]interface{}{
 				"Code":            "Success",
-				"LastUpdated":     "2015-07-07T23:06:33Z",
 				"Type":            "AWS-HMAC",
-				"AccessKeyId":     "test-arn-finto-test-alias",
+				"AccessKeyId":     testArn + "-finto-test-alias",
 				"SecretAccessKey": "mock-key",
 				"Token":           "mock-token",
-				"Expiration":      me.Format("2006-01-02T15:04:05Z"),
+				"Expiration":      formatTime(me),
+				"RoleArn":         testArn,
+				"AccountId":       "123456789012",
 			},
 		},
 		{
 			"GET",
-			"/latest/meta-data/iam/security-credentials/missing-alias",
+			"/missing",
 			nil,
 			http.StatusNotFound,
 			map[string]interface{}{
-				"error": "unknown role: missing-alias",
+				"error": "not found",
+				"code":  "not_found",
 			},
 		},
 	}
 
 	for _, test := range cases {
 		fc := setupTestFintoContext()
-		router := FintoRouter(&fc)
+		router := FintoRouter(fc)
 
 		req, rec := setupTestRequest(test.method, test.path, test.body, t)
 		router.ServeHTTP(rec, req)
@@ -170,12 +228,58 @@ func TestFintoHandlers(t *testing.T) {
 		var resp interface{}
 		err := json.Unmarshal(rec.Body.Bytes(), &resp)
 
+		// Credentials were last updated when this request minted them.
+		if body, ok := resp.(map[string]interface{}); ok && body["AccessKeyId"] != nil {
+			lastUpdated, err := time.Parse(time.RFC3339, body["LastUpdated"].(string))
+			if assert.NoError(t, err, test.path) {
+				assert.WithinDuration(t, time.Now(), lastUpdated, time.Minute, test.path)
+			}
+
+			delete(body, "LastUpdated")
+		}
+
 		if assert.NoError(t, err, rec.Body.String()) {
 			assert.Equal(t, test.responseCode, rec.Code, test.path)
 			assert.Equal(t, test.responseBody, resp, test.path)
 		}
 	}
 }
+func TestMetadataErrors(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	for _, path := range []string{
+		"/latest/meta-data/missing",
+		"/latest/meta-data/iam/security-credentials/missing-alias",
+	} {
+		for _, router := range []http.Handler{FintoRouter(fc), MetadataRouter(fc)} {
+			req, rec := setupTestRequest("GET", path, nil, t)
+			router.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusNotFound, rec.Code, path)
+			assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"), path)
+			assert.Equal(t, "404 - Not Found", rec.Body.String(), path)
+		}
+	}
+
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{awserr.New("AccessDenied", "not authorized", nil)}})
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	MetadataRouter(fc).ServeHTTP(rec, req)
+
+	// Credentials that can't be retrieved are reported in IMDS's shape, for
+	// SDKs that parse it.
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var failure map[string]string
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &failure)) {
+		assert.Equal(t, "AssumeRoleUnauthorizedAccess", failure["Code"])
+		assert.Contains(t, failure["Message"], "AccessDenied: not authorized")
+		assert.NotEmpty(t, failure["LastUpdated"])
+	}
+}
+
 func TestMockInstanceRole(t *testing.T) {
 	req, rec := setupTestRequest(
 		"GET",
@@ -185,7 +289,1167 @@ func TestMockInstanceRole(t *testing.T) {
 	)
 	fc := setupTestFintoContext()
 
-	FintoRouter(&fc).ServeHTTP(rec, req)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	assert.Equal(t, "test-alias", rec.Body.String())
+}
+
+func TestInitFintoContextDefaultRole(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+
+	_, err := InitFintoContext(rs, "missing-alias")
+	assert.EqualError(t, err, `unknown default role "missing-alias": no roles are configured`)
+
+	rs.SetRole("test-alias", testArn)
+	rs.SetRole("another-alias", anotherArn)
+
+	fc, err := InitFintoContext(rs, "missing-alias")
+	assert.EqualError(t, err, `unknown default role "missing-alias": valid roles are another-alias, test-alias`)
+	assert.NotNil(t, fc)
+}
+
+func TestRolesListDetail(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	fc.set.roles["broken-alias"] = NewRole("broken-arn", "finto-broken-alias",
+		&FailingAssumeRoleClient{errs: []error{denied}})
+
+	for _, path := range []string{
+		"/roles/test-alias/credentials",
+		"/roles/broken-alias/credentials",
+	} {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+	}
+
+	req, rec := setupTestRequest("GET", "/roles?detail=1", nil, t)
+	router.ServeHTTP(rec, req)
+
+	var resp struct {
+		Roles []map[string]string `json:"roles"`
+	}
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) && assert.Len(t, resp.Roles, 3) {
+		another, broken, test := resp.Roles[0], resp.Roles[1], resp.Roles[2]
+
+		assert.Equal(t, map[string]string{"alias": "another-alias"}, another)
+
+		assert.Equal(t, "broken-alias", broken["alias"])
+		assert.Equal(t, denied.Error(), broken["last_error"])
+		assert.NotEmpty(t, broken["last_error_at"])
+		assert.Empty(t, broken["last_refresh"])
+
+		assert.Equal(t, "test-alias", test["alias"])
+		assert.Empty(t, test["last_error"])
+		assert.NotEmpty(t, test["last_refresh"])
+	}
+}
+
+func TestRolesListByAccount(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("third-alias", "arn:aws:iam::123456789012:role/third")
+	fc.set.SetRole("broken-alias", "broken-arn")
+	router := FintoRouter(fc)
+
+	req, rec := setupTestRequest("GET", "/roles?group_by=account", nil, t)
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"roles":{
+		"123456789012":["test-alias","third-alias"],
+		"210987654321":["another-alias"],
+		"unknown":["broken-alias"]
+	}}`, rec.Body.String())
+
+	// Filters, pages, and details apply as without grouping.
+	req, rec = setupTestRequest("GET", "/roles?group_by=account&detail=1&limit=2", nil, t)
+	router.ServeHTTP(rec, req)
+
+	assert.JSONEq(t, `{"roles":{
+		"210987654321":[{"alias":"another-alias"}],
+		"unknown":[{"alias":"broken-alias"}]
+	},"next_offset":2}`, rec.Body.String())
+
+	req, rec = setupTestRequest("GET", "/roles?group_by=region", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRolesListPagination(t *testing.T) {
+	fc := setupTestFintoContext()
+	for _, alias := range []string{"app-a", "app-b", "app-c"} {
+		assert.NoError(t, fc.set.SetRole(alias, testArn))
+	}
+	router := FintoRouter(fc)
+
+	cases := []struct {
+		query string
+		roles []string
+		next  int
+	}{
+		{"", []string{"another-alias", "app-a", "app-b", "app-c", "test-alias"}, 0},
+		{"?prefix=app-", []string{"app-a", "app-b", "app-c"}, 0},
+		{"?prefix=none", []string{}, 0},
+		{"?limit=2", []string{"another-alias", "app-a"}, 2},
+		{"?limit=2&offset=2", []string{"app-b", "app-c"}, 4},
+		{"?limit=2&offset=4", []string{"test-alias"}, 0},
+		{"?offset=9", []string{}, 0},
+		{"?prefix=app-&limit=2&offset=1", []string{"app-b", "app-c"}, 0},
+		{"?prefix=app-&limit=1&offset=1", []string{"app-b"}, 2},
+	}
+
+	for _, c := range cases {
+		req, rec := setupTestRequest("GET", "/roles"+c.query, nil, t)
+		router.ServeHTTP(rec, req)
+
+		var resp struct {
+			Roles      []string `json:"roles"`
+			NextOffset int      `json:"next_offset"`
+		}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp), c.query) {
+			assert.Equal(t, c.roles, resp.Roles, c.query)
+			assert.Equal(t, c.next, resp.NextOffset, c.query)
+		}
+	}
+
+	// Pages are listed in detail too.
+	req, rec := setupTestRequest("GET", "/roles?detail=1&limit=1&offset=1", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.JSONEq(t, `{"roles":[{"alias":"app-a"}],"next_offset":2}`, rec.Body.String())
+
+	for _, query := range []string{"?limit=0", "?limit=all", "?offset=-1"} {
+		req, rec := setupTestRequest("GET", "/roles"+query, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+		assert.Contains(t, rec.Body.String(), ErrCodeInvalidRequest, query)
+	}
+}
+
+func TestVersionShow(t *testing.T) {
+	defer func(commit, date string) { Commit, BuildDate = commit, date }(Commit, BuildDate)
+	Commit, BuildDate = "abc123", "2016-01-03T18:40:30Z"
+
+	req, rec := setupTestRequest("GET", "/version", nil, t)
+	ControlRouter(setupTestFintoContext()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"version":"`+Version+`","commit":"abc123","build_date":"2016-01-03T18:40:30Z","go_version":"`+runtime.Version()+`"}`, rec.Body.String())
+
+	// The version is part of the control API only.
+	req, rec = setupTestRequest("GET", "/version", nil, t)
+	MetadataRouter(setupTestFintoContext()).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestVersionString(t *testing.T) {
+	defer func(commit, date string) { Commit, BuildDate = commit, date }(Commit, BuildDate)
+
+	Commit, BuildDate = "", ""
+	assert.Equal(t, "finto "+Version+" ("+runtime.Version()+")", VersionString())
+
+	Commit, BuildDate = "abc123", "2016-01-03T18:40:30Z"
+	assert.Equal(t, "finto "+Version+" (commit abc123, built 2016-01-03T18:40:30Z, "+runtime.Version()+")", VersionString())
+}
+
+func TestRolesActive(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	var resp map[string]interface{}
+
+	req, rec := setupTestRequest("GET", "/roles/active", nil, t)
+	router.ServeHTTP(rec, req)
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, map[string]interface{}{
+			"alias":        "test-alias",
+			"arn":          testArn,
+			"session_name": "finto-test-alias",
+			"ttl_seconds":  float64(0),
+		}, resp)
+	}
+
+	role, _ := fc.set.Role("test-alias")
+	role.creds.SetExpiration(time.Now().Add(time.Hour), 0)
+
+	req, rec = setupTestRequest("GET", "/roles/active", nil, t)
+	router.ServeHTTP(rec, req)
+
+	resp = nil
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, formatTime(role.Expiration()), resp["expiration"])
+		assert.InDelta(t, 3600, resp["ttl_seconds"], 2)
+	}
+
+	// The status filter still reports the active role.
+	req, rec = setupTestRequest("GET", "/roles?status=active", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.JSONEq(t, `{"roles":["test-alias"]}`, rec.Body.String())
+
+	fc.instanceRole = ""
+
+	req, rec = setupTestRequest("GET", "/roles/active", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNoActiveRole(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	// The active role is also the default, so no role takes its place.
+	assert.NoError(t, fc.RemoveRole("test-alias"))
+
+	// As on an instance without an instance profile.
+	for _, path := range []string{
+		"/latest/meta-data/iam/info",
+		"/latest/meta-data/iam/security-credentials/",
+		"/latest/meta-data/iam/security-credentials/another-alias",
+	} {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+		assert.Equal(t, "404 - Not Found", rec.Body.String(), path)
+	}
+
+	// Roles remain available through the control API.
+	req, rec := setupTestRequest("GET", "/roles/another-alias/credentials", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// Once a role is activated, it's served again.
+	assert.NoError(t, fc.setInstanceRole("another-alias"))
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "another-alias", rec.Body.String())
+}
+
+func TestRolesShowSourceProfile(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("sourced-alias", testArn, WithSourceProfile("sourced-profile", &MockAssumeRoleClient{}))
+
+	req, rec := setupTestRequest("GET", "/roles/sourced-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var resp map[string]string
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, map[string]string{
+			"account_id":     "123456789012",
+			"arn":            testArn,
+			"session_name":   "finto-sourced-alias",
+			"source_profile": "sourced-profile",
+		}, resp)
+	}
+}
+
+func TestRolesShowAliases(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("aliased-alias", testArn, WithAliases("aliased"))
+
+	for _, alias := range []string{"aliased-alias", "aliased"} {
+		req, rec := setupTestRequest("GET", "/roles/"+alias, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+
+		var resp map[string]interface{}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+			assert.Equal(t, map[string]interface{}{
+				"account_id":   "123456789012",
+				"arn":          testArn,
+				"session_name": "finto-aliased-alias",
+				"aliases":      []interface{}{"aliased"},
+			}, resp)
+		}
+	}
+}
+
+func TestRolesShowSourceIdentity(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("identified-alias", testArn, WithSourceIdentity("demo@example.com"))
+
+	req, rec := setupTestRequest("GET", "/roles/identified-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var resp map[string]string
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, map[string]string{
+			"account_id":      "123456789012",
+			"arn":             testArn,
+			"session_name":    "finto-identified-alias",
+			"source_identity": "demo@example.com",
+		}, resp)
+	}
+}
+
+func TestRolesShowAccountId(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRole("china-alias", "arn:aws-cn:iam::123456789012:role/china")
+	fc.set.SetRole("gov-alias", "arn:aws-us-gov:iam::210987654321:role/gov")
+
+	for alias, account := range map[string]string{
+		"another-alias": "210987654321",
+		"china-alias":   "123456789012",
+		"gov-alias":     "210987654321",
+	} {
+		req, rec := setupTestRequest("GET", "/roles/"+alias, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+
+		var resp map[string]interface{}
+
+		if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+			assert.Equal(t, account, resp["account_id"], alias)
+		}
+	}
+}
+
+func TestCycleInstanceRole(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	// Roles cycle in sorted order: another-alias, test-alias.
+	for _, expected := range []string{"another-alias", "test-alias", "another-alias"} {
+		role, err := fc.CycleInstanceRole()
+
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, role)
+			assert.Equal(t, expected, fc.getInstanceRole())
+		}
+	}
+
+	fc = &fintoContext{set: NewRoleSet(&MockAssumeRoleClient{})}
+	_, err := fc.CycleInstanceRole()
+	assert.Error(t, err)
+}
+
+func TestMockInstanceMetadata(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetInstanceMetadata(InstanceMetadata{InstanceType: "m4.large"})
+	im := fc.getInstanceMetadata()
+
+	cases := []struct {
+		path, body string
+	}{
+		{"/latest/meta-data/", "ami-id\ninstance-id\ninstance-type\niam/"},
+		{"/latest/meta-data/iam/", "info\nsecurity-credentials/"},
+		{"/latest/meta-data/ami-id", im.AmiId},
+		{"/latest/meta-data/instance-id", im.InstanceId},
+		{"/latest/meta-data/instance-type", "m4.large"},
+	}
+
+	for _, c := range cases {
+		req, rec := setupTestRequest("GET", c.path, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, c.path)
+		assert.Equal(t, c.body, rec.Body.String(), c.path)
+	}
+
+	// Identifiers are stable for the life of the context.
+	assert.Equal(t, im, fc.getInstanceMetadata())
+}
+
+func TestMetadataContentType(t *testing.T) {
+	router := FintoRouter(setupTestFintoContext())
+
+	cases := map[string]string{
+		"/latest/meta-data/":                                    "text/plain; charset=utf-8",
+		"/latest/meta-data/ami-id":                              "text/plain; charset=utf-8",
+		"/latest/meta-data/instance-id":                         "text/plain; charset=utf-8",
+		"/latest/meta-data/instance-type":                       "text/plain; charset=utf-8",
+		"/latest/meta-data/iam/":                                "text/plain; charset=utf-8",
+		"/latest/meta-data/iam/info":                            "application/json",
+		"/latest/meta-data/iam/security-credentials/":           "text/plain; charset=utf-8",
+		"/latest/meta-data/iam/security-credentials/test-alias": "application/json",
+	}
+
+	for path, contentType := range cases {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+		assert.Equal(t, contentType, rec.Header().Get("Content-Type"), path)
+	}
+}
+
+func TestMockProfileCredsDirectory(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	// Without a role name, the profile listing is served.
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "test-alias", rec.Body.String())
+
+	// While a bogus name is a credential fetch that fails.
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/bogus", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "404 - Not Found", rec.Body.String())
+}
+
+func TestProfileName(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	fc.set.SetRole("test-alias", testArn, WithProfileName("web-server"))
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "web-server", rec.Body.String())
+
+	// Credentials are served under the advertised name, and the alias.
+	for _, name := range []string{"web-server", "test-alias"} {
+		req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/"+name, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, name)
+		assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"), name)
+	}
+
+	var info map[string]string
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/info", nil, t)
+	router.ServeHTTP(rec, req)
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &info)) {
+		assert.Equal(t, "arn:aws:iam::123456789012:instance-profile/web-server", info["InstanceProfileArn"])
+	}
+
+	// Profile names can't collide with other roles' names.
+	assert.Error(t, fc.set.SetRole("other-alias", testArn, WithProfileName("web-server")))
+	assert.Error(t, fc.set.SetRole("other-alias", testArn, WithProfileName("another-alias")))
+}
+
+func TestMetadataToken(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	fetch := func(token string) *httptest.ResponseRecorder {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		if token != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Fetch a token.
+	req, rec := setupTestRequest("PUT", "/latest/api/token", nil, t)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get("X-aws-ec2-metadata-token-ttl-seconds"))
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	token := rec.Body.String()
+	assert.NotEmpty(t, token)
+
+	for _, ttl := range []string{"", "0", "21601", "soon"} {
+		req, rec := setupTestRequest("PUT", "/latest/api/token", nil, t)
+		req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", ttl)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, ttl)
+	}
+
+	// Tokens are optional until required, but are validated when given.
+	assert.Equal(t, http.StatusOK, fetch("").Code)
+	assert.Equal(t, http.StatusOK, fetch(token).Code)
+	assert.Equal(t, http.StatusUnauthorized, fetch("bogus").Code)
+
+	fc.SetTokenRequired(true)
+
+	assert.Equal(t, http.StatusOK, fetch(token).Code)
+
+	// SDKs fetch a new token on a bare 401.
+	for _, token := range []string{"", "bogus"} {
+		rec := fetch(token)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Type"))
+		assert.Empty(t, rec.Body.Bytes())
+	}
+}
+
+func TestMetadataTokenCredentials(t *testing.T) {
+	client := &RecordingAssumeRoleClient{}
+
+	fc := setupTestFintoContext()
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithClient(client), WithProfileName("test-profile")))
+	fc.SetTokenRequired(true)
+	router := FintoRouter(fc)
+
+	fetch := func(path, token string) *httptest.ResponseRecorder {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		if token != "" {
+			req.Header.Set("X-aws-ec2-metadata-token", token)
+		}
+
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	listing := "/latest/meta-data/iam/security-credentials/"
+	creds := listing + "test-profile"
+
+	// Without a valid token, neither the listing nor credentials are served,
+	// and STS isn't called.
+	for _, token := range []string{"", "bogus"} {
+		assert.Equal(t, http.StatusUnauthorized, fetch(listing, token).Code, token)
+		assert.Equal(t, http.StatusUnauthorized, fetch(creds, token).Code, token)
+	}
+	assert.Empty(t, client.inputs)
+
+	req, rec := setupTestRequest("PUT", "/latest/api/token", nil, t)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	router.ServeHTTP(rec, req)
+	token := rec.Body.String()
+
+	// With one, the listing advertises the profile name, which serves the
+	// role's credentials.
+	rec = fetch(listing, token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "test-profile", rec.Body.String())
+
+	rec = fetch(creds, token)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"))
+	assert.Len(t, client.inputs, 1)
+}
+
+func TestTokenStore(t *testing.T) {
+	var ts tokenStore
+
+	token := ts.issue(time.Minute)
+	expired := ts.issue(-time.Minute)
+
+	assert.True(t, ts.valid(token))
+	assert.False(t, ts.valid(expired))
+	assert.False(t, ts.valid("bogus"))
+
+	// Expired tokens are forgotten as new ones are issued.
+	ts.issue(time.Minute)
+	assert.Len(t, ts.tokens, 2)
+}
+
+func TestProfileCredsETag(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	fetch := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := fetch("")
+	etag := rec.Header().Get("ETag")
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	for _, match := range []string{etag, "W/" + etag, `"other", ` + etag, "*"} {
+		rec := fetch(match)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code, match)
+		assert.Equal(t, etag, rec.Header().Get("ETag"))
+		assert.Empty(t, rec.Body.Bytes())
+	}
+
+	assert.Equal(t, http.StatusOK, fetch(`"other"`).Code)
+
+	// Refreshed credentials get a new tag.
+	role, _ := fc.set.Role("test-alias")
+	role.creds.SetCredentials("refreshed-id", "refreshed-key", "refreshed-token")
+
+	rec = fetch(etag)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, etag, rec.Header().Get("ETag"))
+}
+
+func TestFallbackRole(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{denied, denied}})
+
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	req, rec := setupTestRequest("GET", path, nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	assert.Error(t, fc.SetFallbackRole("missing-alias"))
+	assert.NoError(t, fc.SetFallbackRole("another-alias"))
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	router.ServeHTTP(rec, req)
+
+	var resp map[string]string
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "another-alias", rec.Header().Get("X-Finto-Role"))
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, anotherArn, resp["RoleArn"])
+	}
+
+	// Only the instance role falls back.
+	fc.setInstanceRole("another-alias")
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"))
+}
+
+func TestRoleClientACL(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	acl, _ := ParseClientACL([]string{"127.0.0.1"}, nil)
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithClientACL(acl)))
+
+	paths := []string{
+		"/latest/meta-data/iam/security-credentials/test-alias",
+		"/roles/test-alias/credentials",
+	}
+
+	for _, path := range paths {
+		for addr, code := range map[string]int{
+			"127.0.0.1:54321": http.StatusOK,
+			"127.0.0.2:54321": http.StatusForbidden,
+		} {
+			req, rec := setupTestRequest("GET", path, nil, t)
+			req.RemoteAddr = addr
+			router.ServeHTTP(rec, req)
+			assert.Equal(t, code, rec.Code, path+" "+addr)
+		}
+	}
+
+	// A restricted fallback isn't served to clients it doesn't permit.
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	assert.NoError(t, fc.set.SetRole("another-alias", anotherArn,
+		WithClient(&FailingAssumeRoleClient{errs: []error{denied, denied}})))
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithClientACL(acl),
+		WithClient(&MockAssumeRoleClient{})))
+	assert.NoError(t, fc.SetFallbackRole("test-alias"))
+	assert.NoError(t, fc.setInstanceRole("another-alias"))
+
+	path := "/latest/meta-data/iam/security-credentials/another-alias"
+
+	req, rec := setupTestRequest("GET", path, nil, t)
+	req.RemoteAddr = "127.0.0.2:54321"
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	req.RemoteAddr = "127.0.0.1:54321"
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"))
+}
+
+func TestRolesAssumeDetails(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	fetch := func(path string) (int, map[string]interface{}) {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		var body map[string]interface{}
+		json.Unmarshal(rec.Body.Bytes(), &body)
+
+		return rec.Code, body
+	}
+
+	// Debugging endpoints are opt-in.
+	code, _ := fetch("/roles/test-alias/assume-details")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	fc.SetDebugEndpoints(true)
+
+	code, body := fetch("/roles/test-alias/assume-details")
+	if assert.Equal(t, http.StatusOK, code) {
+		assert.Equal(t, testArn+"/finto-test-alias", body["assumed_role_arn"])
+		assert.Equal(t, "AROAMOCK:finto-test-alias", body["assumed_role_id"])
+		assert.Equal(t, float64(6), body["packed_policy_size"])
+
+		creds := body["credentials"].(map[string]interface{})
+		assert.Equal(t, testArn+"-finto-test-alias", creds["access_key_id"])
+		assert.Equal(t, redact("mock-key"), creds["secret_access_key"])
+		assert.Equal(t, redact("mock-token"), creds["session_token"])
+	}
+
+	_, body = fetch("/roles/test-alias/assume-details?reveal=1")
+	creds := body["credentials"].(map[string]interface{})
+	assert.Equal(t, "mock-key", creds["secret_access_key"])
+	assert.Equal(t, "mock-token", creds["session_token"])
+
+	code, body = fetch("/roles/missing-alias/assume-details")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, ErrCodeRoleNotFound, body["code"])
+
+	// Roles restricted to other clients aren't detailed to this one either.
+	acl, _ := ParseClientACL([]string{"10.0.0.0/8"}, nil)
+	fc.set.SetRole("restricted", testArn, WithClientACL(acl))
+
+	req, rec := setupTestRequest("GET", "/roles/restricted/assume-details?reveal=1", nil, t)
+	req.RemoteAddr = "127.0.0.1:54321"
+	router.ServeHTTP(rec, req)
+
+	var denied map[string]interface{}
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &denied))
+	assert.Equal(t, ErrCodeClientForbidden, denied["code"])
+	assert.Nil(t, denied["credentials"])
+}
+
+func TestArnCredentials(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	fetch := func(query string) (int, map[string]string) {
+		req, rec := setupTestRequest("GET", "/credentials"+query, nil, t)
+		router.ServeHTTP(rec, req)
+
+		var body map[string]string
+		json.Unmarshal(rec.Body.Bytes(), &body)
+
+		return rec.Code, body
+	}
+
+	code, body := fetch("?arn=" + anotherArn)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, anotherArn, body["RoleArn"])
+
+	code, body = fetch("")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, ErrCodeInvalidRequest, body["code"])
+
+	code, body = fetch("?arn=arn:aws:iam::123456789012:role/missing")
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, ErrCodeRoleNotFound, body["code"])
+
+	assert.NoError(t, fc.set.SetRole("duplicate-alias", anotherArn))
+	code, body = fetch("?arn=" + anotherArn)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, ErrCodeAmbiguousArn, body["code"])
+}
+
+func TestRolesShowLastError(t *testing.T) {
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+
+	fc := setupTestFintoContext()
+	role := NewRole(testArn, "finto-test-alias", &FailingAssumeRoleClient{errs: []error{denied}})
+	fc.set.roles["test-alias"] = role
+
+	show := func() map[string]interface{} {
+		var body map[string]interface{}
+
+		req, rec := setupTestRequest("GET", "/roles/test-alias", nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+		return body
+	}
+
+	_, ok := show()["last_error"]
+	assert.False(t, ok)
+
+	assert.Error(t, role.Refresh(context.Background()))
+	body := show()
+	assert.Equal(t, denied.Error(), body["last_error"])
+	assert.Equal(t, formatTime(role.Status().LastErrorAt), body["last_error_at"])
+
+	// A successful refresh clears the error.
+	assert.NoError(t, role.Refresh(context.Background()))
+	body = show()
+	_, ok = body["last_error"]
+	assert.False(t, ok)
+	_, ok = body["last_error_at"]
+	assert.False(t, ok)
+}
+
+func TestExpiredPolicy(t *testing.T) {
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	cases := []struct {
+		policy  ExpiredPolicy
+		code    int
+		warning bool
+	}{
+		{ExpiredError, http.StatusInternalServerError, false},
+		{ExpiredServeStale, http.StatusOK, true},
+	}
+
+	for _, c := range cases {
+		fc := setupTestFintoContext()
+		fc.SetExpiredPolicy(c.policy)
+
+		// An expired cached entry whose refresh fails.
+		role := NewRole(testArn, "finto-test-alias",
+			&FailingAssumeRoleClient{errs: []error{denied}})
+		role.creds.SetCredentials("stale-id", "stale-key", "stale-token")
+		role.creds.SetExpiration(time.Now().Add(-time.Minute), 0)
+		fc.set.roles["test-alias"] = role
+
+		req, rec := setupTestRequest("GET", path, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+
+		assert.Equal(t, c.code, rec.Code)
+		assert.Equal(t, c.warning, rec.Header().Get("Warning") != "")
+
+		if c.warning {
+			var resp map[string]string
+
+			assert.Equal(t, "test-alias", rec.Header().Get("X-Finto-Role"))
+			if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+				assert.Equal(t, "stale-id", resp["AccessKeyId"])
+			}
+		}
+	}
+
+	// A role that has never been refreshed has nothing stale to serve.
+	fc := setupTestFintoContext()
+	fc.SetExpiredPolicy(ExpiredServeStale)
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{denied}})
+
+	req, rec := setupTestRequest("GET", path, nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestParseExpiredPolicy(t *testing.T) {
+	p, err := ParseExpiredPolicy("stale")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ExpiredServeStale, p)
+	}
+
+	p, err = ParseExpiredPolicy("error")
+	if assert.NoError(t, err) {
+		assert.Equal(t, ExpiredError, p)
+	}
+
+	_, err = ParseExpiredPolicy("ignore")
+	assert.Error(t, err)
+}
+
+func TestAssumeFailureAWSRequestID(t *testing.T) {
+	denied := awserr.NewRequestFailure(
+		awserr.New("AccessDenied", "not authorized", nil), 403, "req-id")
+
+	fc := setupTestFintoContext()
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{denied}})
+
+	req, rec := setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var body map[string]string
+	if assert.Equal(t, http.StatusInternalServerError, rec.Code) &&
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, ErrCodeAssumeFailed, body["code"])
+		assert.Equal(t, "req-id", body["aws_request_id"])
+	}
+	assert.Equal(t, "req-id", rec.Header().Get(AWSRequestIDHeader))
+
+	// Errors that didn't come from AWS have no ID to report.
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{errors.New("no credentials")}})
+
+	req, rec = setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	body = nil
+	if assert.Equal(t, http.StatusInternalServerError, rec.Code) &&
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		_, ok := body["aws_request_id"]
+		assert.False(t, ok)
+	}
+}
+
+func TestRefreshingUnavailable(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.set.SetRefreshingPolicy(RefreshingUnavailable)
+
+	provider := newGatedProvider(Credentials{AccessKeyId: "fresh-id", Expiration: time.Now().Add(time.Hour)})
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+	role, _ := fc.set.Role("test-alias")
+
+	refreshed := make(chan error)
+	go func() { refreshed <- role.Refresh(context.Background()) }()
+	<-provider.started
+
+	// Metadata clients get EC2's bare status, the control API a JSON error.
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+	assert.Equal(t, "503 - Service Unavailable", rec.Body.String())
+
+	req, rec = setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	var body map[string]string
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, ErrCodeRefreshing, body["code"])
+	}
+
+	provider.release <- struct{}{}
+	assert.NoError(t, <-refreshed)
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestExpirationOverride(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetExpirationOverride(time.Minute, 5*time.Minute)
+
+	before := time.Now().Truncate(time.Second)
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var resp map[string]string
+
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		expiration, err := time.Parse("2006-01-02T15:04:05Z", resp["Expiration"])
+
+		if assert.NoError(t, err) {
+			assert.False(t, expiration.Before(before.Add(time.Minute)), resp["Expiration"])
+			assert.False(t, expiration.After(time.Now().Add(5*time.Minute)), resp["Expiration"])
+		}
+
+		assert.Equal(t, "mock-token", resp["Token"])
+	}
+
+	// The override never extends the real expiration.
+	expiry := time.Now().Add(30 * time.Second)
+	assert.Equal(t, expiry, fc.reportedExpiration(expiry))
+}
+
+func TestCORS(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetCORS(CORSConfig{AllowedOrigins: []string{"http://dashboard.test"}})
+	router := FintoRouter(fc)
+
+	req, rec := setupTestRequest("OPTIONS", "/roles", nil, t)
+	req.Header.Set("Origin", "http://dashboard.test")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://dashboard.test", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "PUT", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type", rec.Header().Get("Access-Control-Allow-Headers"))
+
+	// Every /roles route accepts preflights, not only the collection.
+	req, rec = setupTestRequest("OPTIONS", "/roles/test-alias/activate-temporary", nil, t)
+	req.Header.Set("Origin", "http://dashboard.test")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://dashboard.test", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	req, rec = setupTestRequest("GET", "/roles", nil, t)
+	req.Header.Set("Origin", "http://dashboard.test")
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "http://dashboard.test", rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// Disallowed origins and metadata routes get no CORS headers.
+	for _, c := range []struct{ origin, path string }{
+		{"http://elsewhere.test", "/roles"},
+		{"http://dashboard.test", "/latest/meta-data/iam/security-credentials/"},
+	} {
+		req, rec = setupTestRequest("GET", c.path, nil, t)
+		req.Header.Set("Origin", c.origin)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code, c.path)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"), c.path)
+	}
+}
+
+func TestMockIamInfo(t *testing.T) {
+	fc := setupTestFintoContext()
+	_, id, _ := instanceProfileFromArn(testArn, "")
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/info", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var resp map[string]string
 
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+		assert.Equal(t, map[string]string{
+			"Code":               "Success",
+			"LastUpdated":        "2015-07-07T23:06:33Z",
+			"InstanceProfileArn": "arn:aws:iam::123456789012:instance-profile/test",
+			"InstanceProfileId":  id,
+		}, resp)
+	}
+}
+
+func TestMetadataDisabled(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	req, rec := setupTestRequest(
+		"PUT",
+		"/metadata",
+		bytes.NewBuffer([]byte(`{"enabled":false}`)),
+		t,
+	)
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, fc.MetadataDisabled())
+
+	for _, path := range []string{
+		"/latest/meta-data/iam/security-credentials/",
+		"/latest/meta-data/iam/security-credentials/test-alias",
+	} {
+		req, rec = setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code, path)
+	}
+
+	// Control routes remain available while metadata is disabled.
+	req, rec = setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	fc.SetMetadataDisabled(false)
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
 	assert.Equal(t, "test-alias", rec.Body.String())
 }
+
+func TestJSONResponseEncodingError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set(RequestIDHeader, "test-request")
+
+	// Channels can't be encoded as JSON.
+	jsonResponse(rec, map[string]interface{}{"ok": true, "bad": make(chan int)})
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json; charset=UTF-8", rec.Header().Get("Content-Type"))
+
+	var body errorBody
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body)) {
+		assert.Equal(t, errorBody{
+			Error:     "failed to render response",
+			Code:      ErrCodeInternal,
+			RequestID: "test-request",
+		}, body)
+	}
+
+	// Encodable bodies are sent whole, with the status given.
+	rec = httptest.NewRecorder()
+	jsonStatusResponse(rec, map[string]bool{"ok": true}, http.StatusAccepted)
+
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "{\"ok\":true}\n", rec.Body.String())
+}
+
+func TestBodyTooLarge(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	// Padding keeps the body valid JSON, so only its size is at fault.
+	padding := bytes.Repeat([]byte(" "), maxBodySize)
+
+	for path, method := range map[string]string{
+		"/roles":        "PUT",
+		"/metadata":     "PUT",
+		"/default-role": "PUT",
+		"/roles/another-alias/activate-temporary": "POST",
+	} {
+		body := append(append([]byte{}, padding...), `{"alias":"another-alias","enabled":true,"seconds":1}`...)
+
+		req, rec := setupTestRequest(method, path, bytes.NewBuffer(body), t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code, path)
+
+		var resp errorBody
+		if assert.NoError(t, json.NewDecoder(rec.Body).Decode(&resp), path) {
+			assert.Equal(t, ErrCodeBodyTooLarge, resp.Code, path)
+		}
+	}
+
+	assert.Equal(t, "test-alias", fc.getInstanceRole())
+
+	// Bodies up to the limit are read.
+	body := append(padding[:maxBodySize-len(`{"alias":"another-alias"}`)], `{"alias":"another-alias"}`...)
+
+	req, rec := setupTestRequest("PUT", "/roles", bytes.NewBuffer(body), t)
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "another-alias", fc.getInstanceRole())
+}
+
+func TestReadOnly(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetReadOnly(true)
+	router := FintoRouter(fc)
+
+	for _, c := range []struct{ method, path, body string }{
+		{"PUT", "/roles", `{"alias":"another-alias"}`},
+		{"POST", "/roles/another-alias/activate-temporary", `{"seconds":60}`},
+		{"PUT", "/metadata", `{"enabled":false}`},
+	} {
+		req, rec := setupTestRequest(c.method, c.path, bytes.NewBufferString(c.body), t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusForbidden, rec.Code, c.path)
+		assert.Contains(t, rec.Body.String(), ErrCodeReadOnly, c.path)
+	}
+
+	assert.Equal(t, "test-alias", fc.getInstanceRole())
+	assert.False(t, fc.MetadataDisabled())
+
+	// Reads, metadata included, are served as usual.
+	for _, path := range []string{"/roles", "/roles/test-alias", "/latest/meta-data/iam/security-credentials/test-alias"} {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+	}
+
+	// The metadata mock's own PUT, for session tokens, isn't a change.
+	req, rec := setupTestRequest("PUT", "/latest/api/token", nil, t)
+	req.Header.Set(tokenTTLHeader, "60")
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
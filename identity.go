@@ -0,0 +1,354 @@
+package finto
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// The region and availability zone the mocked instance claims to run in.
+const (
+	identityRegion           = "us-east-1"
+	identityAvailabilityZone = "us-east-1a"
+)
+
+// The instance identity document, as EC2 serves it. Fields are in EC2's order,
+// so that the document, and so its signature, is the same for the same
+// instance.
+type identityDocument struct {
+	AccountId        string `json:"accountId"`
+	Architecture     string `json:"architecture"`
+	AvailabilityZone string `json:"availabilityZone"`
+	ImageId          string `json:"imageId"`
+	InstanceId       string `json:"instanceId"`
+	InstanceType     string `json:"instanceType"`
+	PendingTime      string `json:"pendingTime"`
+	Region           string `json:"region"`
+	Version          string `json:"version"`
+}
+
+// Returns the instance identity document as served to r: its identifiers,
+// and the account of the role it's served.
+func (fc *fintoContext) identityDocument(r *http.Request) ([]byte, error) {
+	im := fc.getInstanceMetadata()
+
+	fc.m.Lock()
+	launched := fc.launched
+	fc.m.Unlock()
+
+	doc := identityDocument{
+		Architecture:     "x86_64",
+		AvailabilityZone: identityAvailabilityZone,
+		ImageId:          im.AmiId,
+		InstanceId:       im.InstanceId,
+		InstanceType:     im.InstanceType,
+		PendingTime:      formatTime(launched),
+		Region:           identityRegion,
+		Version:          "2017-09-30",
+	}
+
+	if role, err := fc.set.Role(fc.instanceRoleFor(r)); err == nil {
+		doc.AccountId = accountFromArn(role.Arn())
+	}
+
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// Signs instance identity documents, as EC2 does with its own certificate,
+// with an RSA key and a certificate of it.
+type identitySigner struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// Parses a PEM-encoded RSA private key, in PKCS #1 or PKCS #8 form, and
+// returns a signer of it with a self-signed certificate, for verifying tools
+// to be configured with.
+func newIdentitySigner(keyPEM []byte) (*identitySigner, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM-encoded key found")
+	}
+
+	key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, perr := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if perr != nil {
+			return nil, fmt.Errorf("failed to parse key: %s", err)
+		}
+
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, errors.New("key is not an RSA key")
+		}
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.Unix()),
+		Subject:      pkix.Name{Organization: []string{"finto"}, CommonName: "finto instance identity"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &identitySigner{key: key, cert: cert}, nil
+}
+
+// Returns the PEM-encoded certificate that verifies the signer's signatures.
+func (s *identitySigner) certificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.cert.Raw})
+}
+
+// Returns the RSA-SHA256 signature of doc.
+func (s *identitySigner) sign(doc []byte) ([]byte, error) {
+	digest := sha256.Sum256(doc)
+	return rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+}
+
+// Object identifiers of PKCS #7 and the algorithms it's signed with.
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSigningTime   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 5}
+	oidSHA256        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	asn1Null         = asn1.RawValue{Tag: asn1.TagNull}
+	sha256Algorithm  = algorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1Null}
+	rsaAlgorithm     = algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1Null}
+)
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue // [0] EXPLICIT
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []algorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue // [0] IMPLICIT SET OF Certificate
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type signerInfo struct {
+	Version                   int
+	IssuerAndSerialNumber     issuerAndSerialNumber
+	DigestAlgorithm           algorithmIdentifier
+	AuthenticatedAttributes   asn1.RawValue // [0] IMPLICIT SET OF Attribute
+	DigestEncryptionAlgorithm algorithmIdentifier
+	EncryptedDigest           []byte
+}
+
+type pkcs7Attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue // SET OF the attribute's value
+}
+
+// Returns a context-specific, constructed [0] tag around der.
+func contextTag(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// Returns the DER encoding of an attribute with a single value.
+func marshalAttribute(oid asn1.ObjectIdentifier, value interface{}) ([]byte, error) {
+	v, err := asn1.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(pkcs7Attribute{
+		Type:   oid,
+		Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: v},
+	})
+}
+
+// Returns doc signed as PKCS #7 SignedData carrying doc itself, the
+// signer's certificate, and the content type, digest, and signing time as
+// authenticated attributes, as EC2's pkcs7 is.
+func (s *identitySigner) signPKCS7(doc []byte, at time.Time) ([]byte, error) {
+	digest := sha256.Sum256(doc)
+
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value interface{}
+	}{
+		{oidContentType, oidData},
+		{oidSigningTime, at.UTC()},
+		{oidMessageDigest, digest[:]},
+	} {
+		der, err := marshalAttribute(a.oid, a.value)
+		if err != nil {
+			return nil, err
+		}
+
+		attrs = append(attrs, der)
+	}
+
+	// A SET OF is encoded in sorted order, and is signed with its SET tag
+	// rather than the [0] it's sent with.
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	attrsDER := bytes.Join(attrs, nil)
+
+	signed, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrsDER})
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := s.sign(signed)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := asn1.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []algorithmIdentifier{sha256Algorithm},
+		ContentInfo:      contentInfo{ContentType: oidData, Content: contextTag(content)},
+		Certificates:     contextTag(s.cert.Raw),
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			IssuerAndSerialNumber: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: s.cert.RawIssuer},
+				SerialNumber: s.cert.SerialNumber,
+			},
+			DigestAlgorithm:           sha256Algorithm,
+			AuthenticatedAttributes:   contextTag(attrsDER),
+			DigestEncryptionAlgorithm: rsaAlgorithm,
+			EncryptedDigest:           sig,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(contentInfo{ContentType: oidSignedData, Content: contextTag(sd)})
+}
+
+// Returns b base64 encoded in lines of 64 characters, as EC2 serves
+// signatures.
+func wrappedBase64(b []byte) string {
+	s := base64.StdEncoding.EncodeToString(b)
+
+	var buf bytes.Buffer
+	for len(s) > 64 {
+		buf.WriteString(s[:64])
+		buf.WriteByte('\n')
+		s = s[64:]
+	}
+	buf.WriteString(s)
+
+	return buf.String()
+}
+
+// Signs the instance identity document with an RSA private key, PEM-encoded,
+// so that identity-verifying tools can run against finto. Its self-signed
+// certificate, which they must trust, is returned PEM-encoded. Without a key,
+// signatures aren't served.
+func (fc *fintoContext) SetIdentityKey(keyPEM []byte) ([]byte, error) {
+	s, err := newIdentitySigner(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.identity = s
+	return s.certificatePEM(), nil
+}
+
+func (fc *fintoContext) getIdentitySigner() *identitySigner {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return fc.identity
+}
+
+// Mock the EC2 instance identity document.
+func mockIdentityDocument(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, err := fc.identityDocument(r)
+		if err != nil {
+			metadataErrorResponse(w, fmt.Sprint("failed to render: ", err), http.StatusInternalServerError)
+			return
+		}
+
+		textResponse(w, string(doc))
+	})
+}
+
+// Mock an EC2 instance identity signature of the document: its RSA-SHA256
+// signature, or as PKCS #7, depending on pkcs7. Not found unless a key is set.
+func mockIdentitySignature(pkcs7 bool) fintoHandlerFunc {
+	return func(fc *fintoContext) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := fc.getIdentitySigner()
+			if s == nil {
+				metadataErrorResponse(w, "no identity key", http.StatusNotFound)
+				return
+			}
+
+			doc, err := fc.identityDocument(r)
+			if err != nil {
+				metadataErrorResponse(w, fmt.Sprint("failed to render: ", err), http.StatusInternalServerError)
+				return
+			}
+
+			var sig []byte
+			if pkcs7 {
+				sig, err = s.signPKCS7(doc, time.Now())
+			} else {
+				sig, err = s.sign(doc)
+			}
+
+			if err != nil {
+				metadataErrorResponse(w, fmt.Sprint("failed to sign: ", err), http.StatusInternalServerError)
+				return
+			}
+
+			textResponse(w, wrappedBase64(sig))
+		})
+	}
+}
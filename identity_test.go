@@ -0,0 +1,99 @@
+package finto
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdentityDocument(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetInstanceMetadata(InstanceMetadata{InstanceId: "i-0123456789abcdef0"})
+
+	req, rec := setupTestRequest("GET", "/latest/dynamic/instance-identity/document", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var doc map[string]string
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &doc)) {
+		assert.Equal(t, "i-0123456789abcdef0", doc["instanceId"])
+		assert.Equal(t, accountFromArn(testArn), doc["accountId"])
+		assert.Equal(t, identityRegion, doc["region"])
+	}
+
+	// Without a key, there are no signatures.
+	for _, path := range []string{"signature", "pkcs7"} {
+		req, rec := setupTestRequest("GET", "/latest/dynamic/instance-identity/"+path, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+}
+
+func TestIdentitySignature(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	fc := setupTestFintoContext()
+
+	_, err = fc.SetIdentityKey([]byte("not a key"))
+	assert.Error(t, err)
+
+	certPEM, err := fc.SetIdentityKey(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	block, _ := pem.Decode(certPEM)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	get := func(path string) []byte {
+		req, rec := setupTestRequest("GET", "/latest/dynamic/instance-identity/"+path, nil, t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+
+		return rec.Body.Bytes()
+	}
+
+	doc := get("document")
+	decode := func(path string) []byte {
+		b, err := base64.StdEncoding.DecodeString(strings.Replace(string(get(path)), "\n", "", -1))
+		assert.NoError(t, err, path)
+		return b
+	}
+
+	// The signature verifies the document with the certificate's key.
+	digest := sha256.Sum256(doc)
+	assert.NoError(t, rsa.VerifyPKCS1v15(cert.PublicKey.(*rsa.PublicKey), crypto.SHA256, digest[:], decode("signature")))
+
+	// The PKCS #7 carries the document and the certificate.
+	var outer contentInfo
+	if _, err := asn1.Unmarshal(decode("pkcs7"), &outer); assert.NoError(t, err) {
+		assert.True(t, outer.ContentType.Equal(oidSignedData))
+
+		var sd signedData
+		if _, err := asn1.Unmarshal(outer.Content.Bytes, &sd); assert.NoError(t, err) {
+			var content []byte
+			asn1.Unmarshal(sd.ContentInfo.Content.Bytes, &content)
+			assert.Equal(t, doc, content)
+			assert.Equal(t, cert.Raw, sd.Certificates.Bytes)
+		}
+	}
+}
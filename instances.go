@@ -0,0 +1,170 @@
+package finto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Instance is a named mock of a separate EC2 instance, with a role set and
+// active role of its own, so that one finto process can stand in for several
+// instances, e.g. in different accounts. An instance serves both the metadata
+// mock and the control API, whether on a listener of its own or hosted
+// alongside another's metadata mock under /instances/{name}/.
+type Instance struct {
+	name   string
+	fc     *fintoContext
+	router http.Handler
+}
+
+// Returns an instance served from fc, which must be configured beforehand, as
+// for FintoRouter.
+func NewInstance(name string, fc *fintoContext) (*Instance, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid instance name: %q", name)
+	}
+
+	return &Instance{name: name, fc: fc, router: FintoRouter(fc)}, nil
+}
+
+func (i *Instance) Name() string {
+	return i.name
+}
+
+// Serves the instance's metadata mock and control API.
+func (i *Instance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	i.router.ServeHTTP(w, r)
+}
+
+// Refreshes the instance's active role in the background, as RunRefresher does
+// for its context.
+func (i *Instance) RunRefresher(ctx context.Context, window RefreshWindow) {
+	i.fc.RunRefresher(ctx, window)
+}
+
+// Hosts an instance alongside fc's metadata mock, at /instances/{name}/, and
+// lists it at /instances. The instance takes on those of fc's settings that
+// aren't particular to an instance, e.g. CORS and read-only mode, so they must
+// be made beforehand; its roles, state, and instance metadata are its own.
+func (fc *fintoContext) AddInstance(i *Instance) error {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if i.fc == fc {
+		return errors.New("an instance can't host itself")
+	}
+
+	if _, ok := fc.instances[i.name]; ok {
+		return fmt.Errorf("instance %s already exists", i.name)
+	}
+
+	if fc.instances == nil {
+		fc.instances = make(map[string]*Instance)
+	}
+
+	fc.copySettings(i.fc)
+
+	// Rebuilt, as routes are set up from the settings when built.
+	i.router = FintoRouter(i.fc)
+
+	fc.instances[i.name] = i
+	return nil
+}
+
+// Copies those of fc's settings that aren't particular to an instance to
+// another context. fc must be locked.
+func (fc *fintoContext) copySettings(to *fintoContext) {
+	to.m.Lock()
+	defer to.m.Unlock()
+
+	to.metadataDisabled = fc.metadataDisabled
+	to.tokenRequired = fc.tokenRequired
+	to.credsTimeout = fc.credsTimeout
+	to.cors = fc.cors
+	to.webUIDisabled = fc.webUIDisabled
+	to.debugEndpoints = fc.debugEndpoints
+	to.readOnly = fc.readOnly
+	to.verbose = fc.verbose
+	to.expiredPolicy = fc.expiredPolicy
+	to.expiryMin, to.expiryMax = fc.expiryMin, fc.expiryMax
+	to.latencyMin, to.latencyMax = fc.latencyMin, fc.latencyMax
+	to.metadataServer, to.controlServer = fc.metadataServer, fc.controlServer
+	to.tracer, to.propagator = fc.tracer, fc.propagator
+	to.fieldNames = fc.fieldNames // Replaced rather than changed, so safe to share
+
+	to.routeLatency = make(routeLatencies, len(fc.routeLatency))
+	for pattern, l := range fc.routeLatency {
+		to.routeLatency[pattern] = l
+	}
+
+}
+
+// Returns the hosted instance with the given name.
+func (fc *fintoContext) hostedInstance(name string) (*Instance, bool) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	i, ok := fc.instances[name]
+	return i, ok
+}
+
+// Returns the hosted instances, sorted by name.
+func (fc *fintoContext) Instances() []*Instance {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	instances := make([]*Instance, 0, len(fc.instances))
+	for _, i := range fc.instances {
+		instances = append(instances, i)
+	}
+
+	sort.Slice(instances, func(a, b int) bool { return instances[a].name < instances[b].name })
+	return instances
+}
+
+// List the hosted instances, along with the role each serves.
+func instancesList(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type instanceDetail struct {
+			Name       string `json:"name"`
+			ActiveRole string `json:"active_role"`
+		}
+
+		details := make([]instanceDetail, 0)
+		for _, i := range fc.Instances() {
+			details = append(details, instanceDetail{Name: i.name, ActiveRole: i.fc.getInstanceRole()})
+		}
+
+		jsonResponse(w, map[string][]instanceDetail{"instances": details})
+	})
+}
+
+// Pass requests under /instances/{name}/ to the named instance, with the prefix
+// stripped, e.g. /instances/staging/roles to the staging instance's /roles.
+func instanceHandler(fc *fintoContext) http.Handler {
+	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+		i, ok := fc.hostedInstance(vars["name"])
+		if !ok {
+			errorResponse(w, ErrCodeInstanceNotFound, fmt.Sprint("unknown instance: ", vars["name"]),
+				http.StatusNotFound)
+			return
+		}
+
+		http.StripPrefix("/instances/"+i.name, i).ServeHTTP(w, r)
+	})
+}
+
+// Routes requests under /instances/{name}/ to hosted instances. Being mocks of
+// other instances, they're served alongside the metadata mock, even when the
+// control API listens apart from it.
+func addInstanceRoutes(router *mux.Router, fc *fintoContext) {
+	router.
+		Name("instance").
+		PathPrefix("/instances/{name}/").
+		Handler(instanceHandler(fc))
+}
@@ -0,0 +1,111 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstances(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("staging-alias", anotherArn)
+	staging, _ := InitFintoContext(rs, "staging-alias")
+
+	instance, err := NewInstance("staging", staging)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.NoError(t, fc.AddInstance(instance))
+	assert.Error(t, fc.AddInstance(instance))
+	router := FintoRouter(fc)
+
+	var list map[string][]map[string]string
+
+	req, rec := setupTestRequest("GET", "/instances", nil, t)
+	router.ServeHTTP(rec, req)
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list)) {
+		assert.Equal(t, []map[string]string{{"name": "staging", "active_role": "staging-alias"}},
+			list["instances"])
+	}
+
+	// Each instance serves its own roles, as its own metadata service.
+	req, rec = setupTestRequest("GET", "/instances/staging/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "staging-alias", rec.Body.String())
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "test-alias", rec.Body.String())
+
+	req, rec = setupTestRequest("GET", "/instances/staging/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// Its control API switches only its own active role.
+	rs.SetRole("staging-admin", testArn)
+	req, rec = setupTestRequest("PUT", "/instances/staging/roles", bytes.NewBufferString(`{"alias":"staging-admin"}`), t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "staging-admin", staging.getInstanceRole())
+	assert.Equal(t, "test-alias", fc.getInstanceRole())
+
+	var body map[string]string
+
+	req, rec = setupTestRequest("GET", "/instances/missing/roles", nil, t)
+	router.ServeHTTP(rec, req)
+	if assert.Equal(t, http.StatusNotFound, rec.Code) {
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, ErrCodeInstanceNotFound, body["code"])
+	}
+}
+
+func TestInstanceSettings(t *testing.T) {
+	fc := setupTestFintoContext()
+	fc.SetReadOnly(true)
+	fc.SetServerHeaders(defaultServerHeader, "finto")
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("staging-alias", anotherArn)
+	staging, _ := InitFintoContext(rs, "staging-alias")
+
+	instance, _ := NewInstance("staging", staging)
+	assert.NoError(t, fc.AddInstance(instance))
+
+	// Hosted instances take on the host's settings.
+	req, rec := setupTestRequest("PUT", "/instances/staging/roles", bytes.NewBufferString(`{"alias":"staging-alias"}`), t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req, rec = setupTestRequest("GET", "/instances/staging/roles", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, "finto", rec.Header().Get("Server"))
+
+	// They're served alongside the metadata mock, not the control API.
+	path := "/instances/staging/latest/meta-data/iam/security-credentials/"
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	MetadataRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, "staging-alias", rec.Body.String())
+
+	req, rec = setupTestRequest("GET", path, nil, t)
+	ControlRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewInstanceName(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	for _, name := range []string{"", "a/b"} {
+		_, err := NewInstance(name, fc)
+		assert.Error(t, err, name)
+	}
+
+	self, _ := NewInstance("self", fc)
+	assert.Error(t, fc.AddInstance(self))
+}
@@ -3,6 +3,7 @@
 package finto
 
 import (
+	"context"
 	"os"
 	"testing"
 	"time"
@@ -32,7 +33,7 @@ func TestSTSClientAssumeRole(t *testing.T) {
 	role, err := rc.Role("valid")
 
 	if assert.NoError(t, err) {
-		creds, _ := role.Credentials()
+		creds, _ := role.Credentials(context.Background())
 
 		assert.NotEmpty(t, creds.AccessKeyId)
 		assert.NotEmpty(t, creds.Expiration)
@@ -45,7 +46,7 @@ func TestSTSClientAssumeRole(t *testing.T) {
 func TestSTSClientAssumeRoleFailure(t *testing.T) {
 	rc := setupIntegrationTest()
 	role, err := rc.Role("invalid")
-	creds, err := role.Credentials()
+	creds, err := role.Credentials(context.Background())
 
 	if assert.Error(t, err) {
 		assert.Empty(t, creds.AccessKeyId)
@@ -0,0 +1,148 @@
+package finto
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Delays metadata credential responses by a random duration between min and
+// max, to exercise SDK timeout handling. A fixed delay has min equal to max,
+// and a zero max disables the delay.
+func (fc *fintoContext) SetLatency(min, max time.Duration) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.latencyMin, fc.latencyMax = min, max
+}
+
+// Returns the delay to inject before a credential response.
+func (fc *fintoContext) latency() time.Duration {
+	fc.m.Lock()
+	l := latencyRange{fc.latencyMin, fc.latencyMax}
+	fc.m.Unlock()
+
+	return l.pick()
+}
+
+// The bounds of an injected latency.
+type latencyRange struct {
+	min, max time.Duration
+}
+
+// Injected latencies by route pattern, or AllRoutes.
+type routeLatencies map[string]latencyRange
+
+// Returns a delay between the bounds, or zero if max is.
+func (l latencyRange) pick() time.Duration {
+	if l.max <= 0 {
+		return 0
+	}
+
+	d := l.min
+	if l.max > l.min {
+		d += time.Duration(rand.Int63n(int64(l.max - l.min)))
+	}
+
+	return d
+}
+
+// AllRoutes stands for every route in SetRouteLatency.
+const AllRoutes = "*"
+
+// Delays responses of the route with the given pattern, e.g.
+// /latest/meta-data/instance-id, by a random duration between min and max, to
+// reproduce a slow IMDS or control API. With AllRoutes, every route without a
+// latency of its own is delayed. Latency set for the credentials route adds to
+// that of SetLatency. A zero max removes the route's latency. Returns an error
+// if no route has the pattern.
+func (fc *fintoContext) SetRouteLatency(pattern string, min, max time.Duration) error {
+	if pattern != AllRoutes && !hasRoute(pattern) {
+		return fmt.Errorf("unknown route: %s", pattern)
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if max <= 0 {
+		delete(fc.routeLatency, pattern)
+		return nil
+	}
+
+	if fc.routeLatency == nil {
+		fc.routeLatency = make(routeLatencies)
+	}
+
+	fc.routeLatency[pattern] = latencyRange{min, max}
+	return nil
+}
+
+// Returns whether the control API or the metadata mock has a route with the
+// pattern.
+func hasRoute(pattern string) bool {
+	for _, rs := range []Routes{routes, metadataRoutes} {
+		for _, route := range rs {
+			if route.Pattern == pattern {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Wraps the handler of the route with the given pattern to respond after its
+// injected latency.
+func (fc *fintoContext) routeLatencyHandler(pattern string, h http.Handler) http.Handler {
+	return latencyHandler(func() time.Duration {
+		fc.m.Lock()
+		l, ok := fc.routeLatency[pattern]
+		if !ok {
+			l = fc.routeLatency[AllRoutes]
+		}
+		fc.m.Unlock()
+
+		return l.pick()
+	}, h)
+}
+
+// Returns the bounds of an injected latency, given as a fixed duration, e.g.
+// "500ms", or a range to pick from at random, e.g. "100ms-2s".
+func ParseLatency(s string) (min, max time.Duration, err error) {
+	lo, hi := s, s
+	if i := strings.Index(s, "-"); i > 0 {
+		lo, hi = s[:i], s[i+1:]
+	}
+
+	if min, err = time.ParseDuration(lo); err == nil {
+		max, err = time.ParseDuration(hi)
+	}
+
+	if err != nil || min < 0 || max < min {
+		return 0, 0, fmt.Errorf("invalid latency: %q", s)
+	}
+
+	return min, max, nil
+}
+
+// Wraps a handler so that it responds only after the delay returned by
+// latency. A request cancelled in the meantime, e.g. by a client timing out, is
+// abandoned without a response.
+func latencyHandler(latency func() time.Duration, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if d := latency(); d > 0 {
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+
+			select {
+			case <-r.Context().Done():
+				return
+			case <-timer.C:
+			}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
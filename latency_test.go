@@ -0,0 +1,111 @@
+package finto
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLatency(t *testing.T) {
+	cases := []struct {
+		s        string
+		min, max time.Duration
+		err      bool
+	}{
+		{"500ms", 500 * time.Millisecond, 500 * time.Millisecond, false},
+		{"100ms-2s", 100 * time.Millisecond, 2 * time.Second, false},
+		{"0", 0, 0, false},
+		{"2s-100ms", 0, 0, true},
+		{"-1s", 0, 0, true},
+		{"soon", 0, 0, true},
+		{"1s-", 0, 0, true},
+	}
+
+	for _, c := range cases {
+		min, max, err := ParseLatency(c.s)
+		assert.Equal(t, c.err, err != nil, c.s)
+		assert.Equal(t, c.min, min, c.s)
+		assert.Equal(t, c.max, max, c.s)
+	}
+}
+
+func TestLatency(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	fc.SetLatency(50*time.Millisecond, 50*time.Millisecond)
+
+	start := time.Now()
+	req, rec := setupTestRequest("GET", path, nil, t)
+	router.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// Only credentials are delayed.
+	start = time.Now()
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	// A client timing out cancels the delayed request without a response.
+	fc.SetLatency(time.Minute, time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start = time.Now()
+	req, rec = setupTestRequest("GET", path, nil, t)
+	router.ServeHTTP(rec, req.WithContext(ctx))
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Empty(t, rec.Body.Bytes())
+}
+
+func TestRouteLatency(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	assert.EqualError(t, fc.SetRouteLatency("/nowhere", time.Second, time.Second), "unknown route: /nowhere")
+
+	timed := func(path string) time.Duration {
+		start := time.Now()
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code, path)
+
+		return time.Since(start)
+	}
+
+	// A route's latency delays only it.
+	assert.NoError(t, fc.SetRouteLatency("/latest/meta-data/instance-id", 50*time.Millisecond, 50*time.Millisecond))
+	assert.True(t, timed("/latest/meta-data/instance-id") >= 50*time.Millisecond)
+	assert.True(t, timed("/latest/meta-data/iam/info") < 50*time.Millisecond)
+
+	// Every other route is delayed by the latency of all routes, the control
+	// API's included.
+	assert.NoError(t, fc.SetRouteLatency(AllRoutes, 20*time.Millisecond, 20*time.Millisecond))
+	assert.NoError(t, fc.SetRouteLatency("/latest/meta-data/instance-id", 0, 0))
+	assert.True(t, timed("/latest/meta-data/iam/info") >= 20*time.Millisecond)
+	assert.True(t, timed("/roles") >= 20*time.Millisecond)
+
+	d := timed("/latest/meta-data/instance-id")
+	assert.True(t, d >= 20*time.Millisecond && d < 50*time.Millisecond)
+
+	// A client timing out cancels the delayed request without a response.
+	assert.NoError(t, fc.SetRouteLatency(AllRoutes, time.Minute, time.Minute))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	req, rec := setupTestRequest("GET", "/latest/meta-data/instance-id", nil, t)
+	router.ServeHTTP(rec, req.WithContext(ctx))
+
+	assert.True(t, time.Since(start) < time.Second)
+	assert.Empty(t, rec.Body.Bytes())
+}
@@ -0,0 +1,61 @@
+package finto
+
+import "context"
+
+// CallLimit bounds how many roles' credentials are retrieved at once, so that
+// many sessions expiring together don't fire as many simultaneous STS calls.
+// One limit may be shared by several role sets, bounding their calls
+// together. A nil limit is unbounded.
+type CallLimit chan struct{}
+
+// Returns a limit of n retrievals in flight at once, or none if n isn't
+// positive.
+func NewCallLimit(n int) CallLimit {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(CallLimit, n)
+}
+
+// Waits for a slot, or until ctx is done.
+func (l CallLimit) acquire(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l CallLimit) release() {
+	if l != nil {
+		<-l
+	}
+}
+
+// Limits the set's roles, including those added later, to n retrievals of
+// credentials in flight at once, across all roles; further retrievals wait
+// their turn for as long as their context allows. Concurrent requests for one
+// role's credentials already share a single retrieval. Zero removes the limit.
+func (rs *RoleSet) SetMaxConcurrentCalls(n int) {
+	rs.SetCallLimit(NewCallLimit(n))
+}
+
+// Limits the set's roles, including those added later, by l, which other sets
+// may share. A nil limit removes it.
+func (rs *RoleSet) SetCallLimit(l CallLimit) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.limit = l
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.limit = l
+		role.m.Unlock()
+	}
+}
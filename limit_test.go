@@ -0,0 +1,223 @@
+package finto
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// A mock client that holds each call until released, recording how many
+// calls were made and how many were in flight at most.
+type GatedAssumeRoleClient struct {
+	release chan struct{}
+
+	calls, inFlight, maxInFlight int
+	m                            sync.Mutex
+}
+
+func (c *GatedAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	c.m.Lock()
+	c.calls++
+	c.inFlight++
+	if c.inFlight > c.maxInFlight {
+		c.maxInFlight = c.inFlight
+	}
+	c.m.Unlock()
+
+	<-c.release
+
+	c.m.Lock()
+	c.inFlight--
+	c.m.Unlock()
+
+	return (&MockAssumeRoleClient{}).AssumeRoleWithContext(ctx, input)
+}
+
+func (c *GatedAssumeRoleClient) counts() (int, int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.calls, c.maxInFlight
+}
+
+func TestConcurrentCallsCoalesce(t *testing.T) {
+	client := &GatedAssumeRoleClient{release: make(chan struct{})}
+
+	rs := NewRoleSet(client)
+	rs.SetRole("test-alias", "test-arn")
+	role, _ := rs.Role("test-alias")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			creds, err := role.Credentials(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, "test-arn-finto-test-alias", creds.AccessKeyId)
+		}()
+	}
+
+	// Give the requests time to pile up behind the first.
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	calls, _ := client.counts()
+	assert.Equal(t, 1, calls)
+}
+
+func TestMaxConcurrentCalls(t *testing.T) {
+	client := &GatedAssumeRoleClient{release: make(chan struct{})}
+
+	rs := NewRoleSet(client)
+	rs.SetMaxConcurrentCalls(2)
+
+	aliases := []string{"a", "b", "c", "d", "e"}
+	for _, alias := range aliases {
+		rs.SetRole(alias, alias+"-arn")
+	}
+
+	var wg sync.WaitGroup
+	for _, alias := range aliases {
+		role, _ := rs.Role(alias)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := role.Credentials(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	calls, max := client.counts()
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, max)
+
+	// Waiting calls proceed as slots free up.
+	close(client.release)
+	wg.Wait()
+
+	calls, max = client.counts()
+	assert.Equal(t, len(aliases), calls)
+	assert.Equal(t, 2, max)
+
+	// Waiting respects the caller's context.
+	blocked := &GatedAssumeRoleClient{release: make(chan struct{})}
+	rs = NewRoleSet(blocked)
+	rs.SetMaxConcurrentCalls(1)
+	rs.SetRole("busy", "busy-arn")
+	rs.SetRole("waiting", "waiting-arn")
+
+	busy, _ := rs.Role("busy")
+	go busy.Credentials(context.Background())
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	waiting, _ := rs.Role("waiting")
+	_, err := waiting.Credentials(ctx)
+	assert.Error(t, err)
+
+	close(blocked.release)
+}
+
+func TestSharedCallLimit(t *testing.T) {
+	client := &GatedAssumeRoleClient{release: make(chan struct{})}
+	limit := NewCallLimit(2)
+
+	// Two sets sharing a limit are bounded together, not each by it.
+	var roles []*Role
+	for _, name := range []string{"one", "two"} {
+		rs := NewRoleSet(client)
+		rs.SetCallLimit(limit)
+
+		for _, alias := range []string{"a", "b"} {
+			rs.SetRole(alias, name+"-"+alias+"-arn")
+			role, _ := rs.Role(alias)
+			roles = append(roles, role)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, role := range roles {
+		wg.Add(1)
+		go func(role *Role) {
+			defer wg.Done()
+			_, err := role.Credentials(context.Background())
+			assert.NoError(t, err)
+		}(role)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	calls, max := client.counts()
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, max)
+
+	close(client.release)
+	wg.Wait()
+
+	calls, max = client.counts()
+	assert.Equal(t, len(roles), calls)
+	assert.Equal(t, 2, max)
+	assert.Nil(t, NewCallLimit(0))
+}
+
+func TestExpiredCredentialsCoalesce(t *testing.T) {
+	client := &GatedAssumeRoleClient{release: make(chan struct{})}
+
+	rs := NewRoleSet(client)
+	rs.SetRole("test-alias", testArn)
+
+	role, _ := rs.Role("test-alias")
+	role.creds.SetCredentials("expired-key", "expired-secret", "expired-token")
+	role.creds.SetExpiration(time.Now().Add(-time.Minute), 0)
+
+	fc, _ := InitFintoContext(rs, "test-alias")
+	router := FintoRouter(fc)
+
+	// An expiry storm: every request finds the credentials expired at once.
+	const requests = 50
+
+	keys := make(chan string, requests)
+
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+			router.ServeHTTP(rec, req)
+
+			var resp map[string]interface{}
+			if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+				keys <- fmt.Sprint(resp["AccessKeyId"])
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+	close(keys)
+
+	calls, _ := client.counts()
+	assert.Equal(t, 1, calls)
+
+	// Every request was served the one retrieval's credentials.
+	assert.Len(t, keys, requests)
+	for key := range keys {
+		assert.Equal(t, testArn+"-finto-test-alias", key)
+	}
+}
@@ -0,0 +1,49 @@
+package finto
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// InstanceMetadata holds the identifiers served for the mocked instance.
+type InstanceMetadata struct {
+	AmiId        string
+	InstanceId   string
+	InstanceType string
+}
+
+// Returns instance metadata with randomly generated identifiers. The values
+// are shaped like their EC2 counterparts, e.g. i-0123456789abcdef0.
+func NewInstanceMetadata() InstanceMetadata {
+	return InstanceMetadata{
+		AmiId:        "ami-" + randomHex(17),
+		InstanceId:   "i-" + randomHex(17),
+		InstanceType: "t2.micro",
+	}
+}
+
+// Returns a copy of im with any empty fields filled from defaults.
+func (im InstanceMetadata) Merge(defaults InstanceMetadata) InstanceMetadata {
+	if im.AmiId == "" {
+		im.AmiId = defaults.AmiId
+	}
+
+	if im.InstanceId == "" {
+		im.InstanceId = defaults.InstanceId
+	}
+
+	if im.InstanceType == "" {
+		im.InstanceType = defaults.InstanceType
+	}
+
+	return im
+}
+
+func randomHex(n int) string {
+	b := make([]byte, (n+1)/2)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)[:n]
+}
@@ -0,0 +1,33 @@
+package finto
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewInstanceMetadata(t *testing.T) {
+	im := NewInstanceMetadata()
+
+	assert.Regexp(t, regexp.MustCompile(`^ami-[0-9a-f]{17}$`), im.AmiId)
+	assert.Regexp(t, regexp.MustCompile(`^i-[0-9a-f]{17}$`), im.InstanceId)
+	assert.Equal(t, "t2.micro", im.InstanceType)
+	assert.NotEqual(t, im, NewInstanceMetadata())
+}
+
+func TestInstanceMetadataMerge(t *testing.T) {
+	defaults := InstanceMetadata{
+		AmiId:        "ami-default",
+		InstanceId:   "i-default",
+		InstanceType: "t2.default",
+	}
+
+	im := InstanceMetadata{InstanceType: "m4.large"}.Merge(defaults)
+
+	assert.Equal(t, InstanceMetadata{
+		AmiId:        "ami-default",
+		InstanceId:   "i-default",
+		InstanceType: "m4.large",
+	}, im)
+}
@@ -0,0 +1,83 @@
+package finto
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics describing a finto instance. Each context registers its
+// own, so they're served from /metrics rather than the default registry.
+type metrics struct {
+	registry      *prometheus.Registry
+	roleSwitches  *prometheus.CounterVec   // Requests to change the active role
+	activeRole    *prometheus.GaugeVec     // 1 for the active role's alias
+	credsServed   *prometheus.CounterVec   // Credentials served, by whether they were fetched from STS
+	credsLifetime *prometheus.HistogramVec // Credentials' remaining lifetime when served
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		roleSwitches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "finto",
+			Name:      "role_switches_total",
+			Help:      "Requests to change the active role, by result.",
+		}, []string{"result"}),
+		activeRole: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: "finto",
+			Name:      "active_role",
+			Help:      "The role served as the instance profile role, labeled by alias.",
+		}, []string{"alias"}),
+		credsServed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "finto",
+			Name:      "credentials_served_total",
+			Help:      "Credentials served, by whether they came from the cache or were fetched from STS.",
+		}, []string{"result"}),
+		credsLifetime: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "finto",
+			Name:      "credentials_remaining_seconds",
+			Help:      "Seconds until served credentials expire, by whether they came from the cache or STS.",
+			Buckets:   []float64{60, 300, 600, 900, 1800, 2700, 3600, 7200, 14400, 43200},
+		}, []string{"result"}),
+	}
+
+	m.registry.MustRegister(m.roleSwitches, m.activeRole, m.credsServed, m.credsLifetime)
+
+	// Report both results from the start, so rates are defined.
+	m.roleSwitches.WithLabelValues("success")
+	m.roleSwitches.WithLabelValues("failure")
+	m.credsServed.WithLabelValues("cache")
+	m.credsServed.WithLabelValues("sts")
+
+	return m
+}
+
+// Records the outcome of a request to change the active role.
+func (m *metrics) roleSwitched(err error) {
+	if err != nil {
+		m.roleSwitches.WithLabelValues("failure").Inc()
+		return
+	}
+
+	m.roleSwitches.WithLabelValues("success").Inc()
+}
+
+// Records credentials being served, fetched from STS or from the cache, with
+// ttl left until they expire.
+func (m *metrics) credentialsServed(result string, ttl time.Duration) {
+	m.credsServed.WithLabelValues(result).Inc()
+	m.credsLifetime.WithLabelValues(result).Observe(ttl.Seconds())
+}
+
+func (m *metrics) setActiveRole(alias string) {
+	m.activeRole.Reset()
+	m.activeRole.WithLabelValues(alias).Set(1)
+}
+
+// Serve metrics in the Prometheus exposition format.
+func metricsShow(fc *fintoContext) http.Handler {
+	return promhttp.HandlerFor(fc.metrics.registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,69 @@
+package finto
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleSwitchMetrics(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	for _, body := range []string{`{"alias":"another-alias"}`, `{"alias":"missing-alias"}`, `{`} {
+		req, rec := setupTestRequest("PUT", "/roles", bytes.NewBufferString(body), t)
+		router.ServeHTTP(rec, req)
+	}
+
+	switches := fc.metrics.roleSwitches
+	assert.Equal(t, float64(1), testutil.ToFloat64(switches.WithLabelValues("success")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(switches.WithLabelValues("failure")))
+
+	// Only the active role is reported.
+	expected := `
+# HELP finto_active_role The role served as the instance profile role, labeled by alias.
+# TYPE finto_active_role gauge
+finto_active_role{alias="another-alias"} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(fc.metrics.activeRole, strings.NewReader(expected)))
+
+	// Roles changed by other means are reported too.
+	fc.CycleInstanceRole()
+	assert.Equal(t, float64(1), testutil.ToFloat64(fc.metrics.activeRole.WithLabelValues("test-alias")))
+	assert.Equal(t, 1, testutil.CollectAndCount(fc.metrics.activeRole))
+}
+
+func TestMetricsShow(t *testing.T) {
+	req, rec := setupTestRequest("GET", "/metrics", nil, t)
+	FintoRouter(setupTestFintoContext()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `finto_active_role{alias="test-alias"} 1`)
+	assert.Contains(t, rec.Body.String(), `finto_role_switches_total{result="failure"} 0`)
+	assert.Contains(t, rec.Body.String(), `finto_credentials_served_total{result="sts"} 0`)
+}
+
+func TestCredentialsServedMetrics(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	// The first request fetches from STS, the rest are served from the cache.
+	for i := 0; i < 3; i++ {
+		req, rec := setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	served := fc.metrics.credsServed
+	assert.Equal(t, float64(1), testutil.ToFloat64(served.WithLabelValues("sts")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(served.WithLabelValues("cache")))
+
+	// Failures aren't served credentials.
+	req, rec := setupTestRequest("GET", "/roles/missing-alias/credentials", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, float64(3), testutil.ToFloat64(served.WithLabelValues("sts"))+testutil.ToFloat64(served.WithLabelValues("cache")))
+}
@@ -0,0 +1,88 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// SessionTokenClient is a basic interface that wraps GetSessionToken, which
+// mints temporary credentials for the caller's own identity.
+//
+// https://godoc.org/github.com/aws/aws-sdk-go/service/sts#GetSessionTokenInput
+type SessionTokenClient interface {
+	GetSessionTokenWithContext(ctx aws.Context, input *sts.GetSessionTokenInput, opts ...request.Option) (*sts.GetSessionTokenOutput, error)
+}
+
+// How long temporary base credentials whose provider doesn't report their
+// expiration, e.g. those from the environment, are served before being read
+// anew.
+const passthroughRecheck = 5 * time.Minute
+
+// Serves the base identity's own credentials, read from base, rather than
+// assuming the role; the role is a pseudo-role standing for whoever finto runs
+// as, e.g. to compare its access with that of the roles. Temporary base
+// credentials are served as they are. Long-term ones carry no session token,
+// so a session is minted for them through c with GetSessionToken, lasting the
+// role's session duration if it has one.
+func WithPassthrough(base *credentials.Credentials, c SessionTokenClient) RoleOption {
+	return func(r *Role) {
+		r.provider = passthroughProvider{role: r, base: base, client: c}
+	}
+}
+
+type passthroughProvider struct {
+	role   *Role
+	base   *credentials.Credentials
+	client SessionTokenClient
+}
+
+func (p passthroughProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	v, err := p.base.GetWithContext(ctx)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to retrieve base credentials: %s", err)
+	}
+
+	// GetSessionToken refuses temporary credentials, which need no session
+	// minted for them anyway.
+	if v.SessionToken != "" {
+		var creds Credentials
+		creds.SetCredentials(v.AccessKeyID, v.SecretAccessKey, v.SessionToken)
+
+		creds.Expiration, err = p.base.ExpiresAt()
+		if err != nil {
+			creds.Expiration = p.role.now().Add(passthroughRecheck)
+		}
+
+		return creds, nil
+	}
+
+	input := &sts.GetSessionTokenInput{}
+	if p.role.duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(p.role.duration / time.Second))
+	}
+
+	resp, err := p.client.GetSessionTokenWithContext(ctx, input)
+	if err != nil {
+		msg := fmt.Sprintf("base credentials %s are long-term and no session token could be minted for them", v.AccessKeyID)
+		if aerr, ok := err.(awserr.Error); ok {
+			return Credentials{}, awserr.New(aerr.Code(), msg, err)
+		}
+
+		return Credentials{}, fmt.Errorf("%s: %s", msg, err)
+	}
+
+	var creds Credentials
+	if c := resp.Credentials; c != nil {
+		creds.SetCredentials(aws.StringValue(c.AccessKeyId), aws.StringValue(c.SecretAccessKey), aws.StringValue(c.SessionToken))
+		creds.Expiration = aws.TimeValue(c.Expiration)
+	}
+
+	return creds, nil
+}
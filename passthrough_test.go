@@ -0,0 +1,109 @@
+package finto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// A mock client that mints a canned session, or fails with err.
+type mockSessionTokenClient struct {
+	err   error
+	input *sts.GetSessionTokenInput
+}
+
+func (c *mockSessionTokenClient) GetSessionTokenWithContext(ctx aws.Context, input *sts.GetSessionTokenInput, opts ...request.Option) (*sts.GetSessionTokenOutput, error) {
+	c.input = input
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return &sts.GetSessionTokenOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("ASIASESSION"),
+			Expiration:      &MockExpiry,
+			SecretAccessKey: aws.String("session-key"),
+			SessionToken:    aws.String("session-token"),
+		},
+	}, nil
+}
+
+func TestPassthroughLongTerm(t *testing.T) {
+	base := credentials.NewStaticCredentials("AKIABASE", "base-key", "")
+	client := &mockSessionTokenClient{}
+
+	rs := NewRoleSet(&FailingAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("base", "", WithPassthrough(base, client), WithSessionDuration(2*time.Hour)))
+	role, _ := rs.Role("base")
+
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ASIASESSION", creds.AccessKeyId)
+		assert.Equal(t, "session-key", creds.SecretAccessKey)
+		assert.Equal(t, "session-token", creds.SessionToken)
+		assert.WithinDuration(t, MockExpiry, creds.Expiration, time.Second)
+	}
+
+	if assert.NotNil(t, client.input) {
+		assert.Equal(t, int64(7200), aws.Int64Value(client.input.DurationSeconds))
+	}
+}
+
+func TestPassthroughTemporary(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	base := credentials.NewStaticCredentials("ASIABASE", "base-key", "base-token")
+	client := &mockSessionTokenClient{}
+
+	rs := NewRoleSet(&FailingAssumeRoleClient{})
+	rs.SetClock(clock)
+	assert.NoError(t, rs.SetRole("base", "", WithPassthrough(base, client)))
+	role, _ := rs.Role("base")
+
+	// Temporary credentials are served as they are, and read anew shortly, as
+	// static credentials don't report their expiration.
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "ASIABASE", creds.AccessKeyId)
+		assert.Equal(t, "base-key", creds.SecretAccessKey)
+		assert.Equal(t, "base-token", creds.SessionToken)
+		assert.WithinDuration(t, clock.Now().Add(passthroughRecheck), creds.Expiration, time.Second)
+	}
+
+	assert.Nil(t, client.input)
+}
+
+func TestPassthroughNoSessionToken(t *testing.T) {
+	base := credentials.NewStaticCredentials("AKIABASE", "base-key", "")
+	client := &mockSessionTokenClient{err: awserr.New("AccessDenied", "not authorized to perform sts:GetSessionToken", nil)}
+
+	rs := NewRoleSet(&FailingAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("base", "", WithPassthrough(base, client)))
+	role, _ := rs.Role("base")
+
+	_, err := role.Credentials(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "base credentials AKIABASE are long-term")
+		assert.Contains(t, err.Error(), "AccessDenied")
+	}
+
+	// Base credentials that can't be read at all are reported as such.
+	base = credentials.NewCredentials(&credentials.ErrorProvider{
+		Err:          awserr.New("NoCredentialProviders", "no valid providers in chain", nil),
+		ProviderName: "ErrorProvider",
+	})
+
+	assert.NoError(t, rs.SetRole("base", "", WithPassthrough(base, client)))
+	role, _ = rs.Role("base")
+
+	_, err = role.Credentials(context.Background())
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "failed to retrieve base credentials")
+	}
+}
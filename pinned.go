@@ -0,0 +1,42 @@
+package finto
+
+import (
+	"context"
+	"net/http"
+)
+
+type pinnedRoleKey struct{}
+
+// Returns a handler serving only the metadata mock, as an instance whose role
+// is always the given one: the active role is ignored, as is the fallback
+// role, and no other role's credentials are served. Each listener pinned this
+// way mocks a separate instance, e.g. so that containers bound to a particular
+// address get a particular identity.
+func PinnedMetadataRouter(fc *fintoContext, role string) (http.Handler, error) {
+	if _, err := fc.set.Role(role); err != nil {
+		return nil, err
+	}
+
+	role = fc.set.canonical(role)
+	router := MetadataRouter(fc)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		router.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), pinnedRoleKey{}, role)))
+	}), nil
+}
+
+// Returns the role pinned to the listener a request arrived on, if any.
+func pinnedRole(r *http.Request) (string, bool) {
+	role, ok := r.Context().Value(pinnedRoleKey{}).(string)
+	return role, ok
+}
+
+// Returns the instance role as a request sees it: the role pinned to its
+// listener, or else the active role.
+func (fc *fintoContext) instanceRoleFor(r *http.Request) string {
+	if role, ok := pinnedRole(r); ok {
+		return role
+	}
+
+	return fc.getInstanceRole()
+}
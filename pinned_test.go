@@ -0,0 +1,68 @@
+package finto
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPinnedMetadataRouter(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	pinned, err := PinnedMetadataRouter(fc, "another-alias")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// The active role has no bearing on the pinned instance.
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	pinned.ServeHTTP(rec, req)
+	assert.Equal(t, "another-alias", rec.Body.String())
+
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/another-alias", nil, t)
+	pinned.ServeHTTP(rec, req)
+	if assert.Equal(t, http.StatusOK, rec.Code) {
+		var body map[string]string
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, anotherArn, body["RoleArn"])
+	}
+
+	// Nor is any other role served.
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	pinned.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// The control API isn't served at all.
+	req, rec = setupTestRequest("GET", "/roles", nil, t)
+	pinned.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	// While the shared router still serves the active role.
+	req, rec = setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, "test-alias", rec.Body.String())
+
+	_, err = PinnedMetadataRouter(fc, "missing-alias")
+	assert.Error(t, err)
+}
+
+func TestPinnedMetadataRouterNoFallback(t *testing.T) {
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+
+	fc := setupTestFintoContext()
+	fc.set.roles["test-alias"] = NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{denied}})
+	assert.NoError(t, fc.SetFallbackRole("another-alias"))
+
+	pinned, err := PinnedMetadataRouter(fc, "test-alias")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	pinned.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
@@ -0,0 +1,138 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// CredentialProvider retrieves a role's credentials. Roles assume themselves
+// through STS unless given another provider with WithCredentialProvider, e.g.
+// to serve credentials from web identity, SSO, or a secrets store.
+//
+// Retrieve returns fresh credentials and their expiration; the role caches
+// them, refreshes them as they expire, and retries transient failures per its
+// RetryPolicy. The request is abandoned if ctx is cancelled or its deadline
+// passes.
+type CredentialProvider interface {
+	Retrieve(ctx context.Context) (Credentials, error)
+}
+
+// Retrieves the role's credentials through p, rather than by assuming it
+// through STS. The role's client, source identity, and session duration are
+// ignored, being particular to AssumeRole.
+func WithCredentialProvider(p CredentialProvider) RoleOption {
+	return func(r *Role) {
+		r.provider = p
+	}
+}
+
+// The Type IMDS serves credentials with, and finto does unless told otherwise.
+const DefaultCredentialType = "AWS-HMAC"
+
+// CredentialTyper is implemented by providers whose credentials are served with
+// a Type other than DefaultCredentialType, for clients that tell them apart.
+type CredentialTyper interface {
+	CredentialType() string
+}
+
+// Serves the role's credentials with t as their Type, in place of its
+// provider's.
+func WithCredentialType(t string) RoleOption {
+	return func(r *Role) {
+		r.credType = t
+	}
+}
+
+// Returns the Type the role's credentials are served with: the one it was
+// given, else its provider's, else DefaultCredentialType.
+func (r *Role) CredentialType() string {
+	if r.credType != "" {
+		return r.credType
+	}
+
+	if t, ok := r.credentialProvider().(CredentialTyper); ok && t.CredentialType() != "" {
+		return t.CredentialType()
+	}
+
+	return DefaultCredentialType
+}
+
+// Implemented by providers that can describe the assumption behind the
+// credentials they retrieve.
+type detailedProvider interface {
+	retrieveDetails(ctx context.Context) (Credentials, AssumeDetails, error)
+}
+
+// Returns the role's provider: the one it was given, or else assumption
+// through its client.
+func (r *Role) credentialProvider() CredentialProvider {
+	if r.provider != nil {
+		return r.provider
+	}
+
+	return assumeRoleProvider{r}
+}
+
+// Assumes a role through its AssumeRoleClient, with its session name, source
+// identity, and session duration.
+type assumeRoleProvider struct {
+	role *Role
+}
+
+func (p assumeRoleProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	creds, _, err := p.retrieveDetails(ctx)
+	return creds, err
+}
+
+func (p assumeRoleProvider) retrieveDetails(ctx context.Context) (Credentials, AssumeDetails, error) {
+	r := p.role
+
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(r.Arn()),
+		RoleSessionName: aws.String(r.SessionName()),
+	}
+
+	// Only roles that ask for one set a source identity, as trust policies
+	// that don't allow it reject the assumption.
+	if r.sourceIdentity != "" {
+		input.SourceIdentity = aws.String(r.sourceIdentity)
+	}
+
+	if r.duration > 0 {
+		input.DurationSeconds = aws.Int64(int64(r.duration / time.Second))
+	}
+
+	resp, err := r.client.AssumeRoleWithContext(ctx, input)
+	if isDurationExceeded(err) {
+		return Credentials{}, AssumeDetails{}, awserr.New("ValidationError", fmt.Sprintf(
+			"session duration %s of role %s exceeds its MaxSessionDuration; lower the role's duration or raise its maximum in IAM",
+			r.duration, r.arn), err)
+	}
+
+	if err != nil {
+		return Credentials{}, AssumeDetails{}, err
+	}
+
+	var creds Credentials
+	if c := resp.Credentials; c != nil {
+		creds.SetCredentials(aws.StringValue(c.AccessKeyId), aws.StringValue(c.SecretAccessKey), aws.StringValue(c.SessionToken))
+		creds.Expiration = aws.TimeValue(c.Expiration)
+	}
+
+	details := AssumeDetails{
+		PackedPolicySize: aws.Int64Value(resp.PackedPolicySize),
+		SourceIdentity:   aws.StringValue(resp.SourceIdentity),
+	}
+
+	if user := resp.AssumedRoleUser; user != nil {
+		details.AssumedRoleArn = aws.StringValue(user.Arn)
+		details.AssumedRoleId = aws.StringValue(user.AssumedRoleId)
+	}
+
+	return creds, details, nil
+}
@@ -0,0 +1,125 @@
+package finto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/stretchr/testify/assert"
+)
+
+// A provider serving credentials held in memory, failing with each of errs in
+// turn first. For testing purposes.
+type memoryProvider struct {
+	creds Credentials
+	errs  []error
+	calls int
+}
+
+func (p *memoryProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.calls += 1
+	if p.calls <= len(p.errs) {
+		return Credentials{}, p.errs[p.calls-1]
+	}
+
+	return p.creds, nil
+}
+
+func TestCredentialProvider(t *testing.T) {
+	provider := &memoryProvider{
+		creds: Credentials{
+			AccessKeyId:     "memory-id",
+			SecretAccessKey: "memory-key",
+			SessionToken:    "memory-token",
+			Expiration:      time.Now().Add(time.Hour),
+		},
+		errs: []error{awserr.New("Throttling", "slow down", nil)},
+	}
+
+	client := &FailingAssumeRoleClient{}
+	rs := NewRoleSet(client)
+	rs.SetRetryPolicy(RetryPolicy{MaxAttempts: 2})
+	assert.NoError(t, rs.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+	role, _ := rs.Role("test-alias")
+
+	// The provider serves in place of STS, with the role's retries and cache.
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "memory-id", creds.AccessKeyId)
+		assert.Equal(t, "memory-key", creds.SecretAccessKey)
+		assert.Equal(t, "memory-token", creds.SessionToken)
+		assert.False(t, creds.LastUpdated.IsZero())
+	}
+
+	_, err = role.Credentials(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, provider.calls)
+	assert.Equal(t, 0, client.calls)
+	assert.Equal(t, AssumeDetails{}, role.AssumeDetails())
+
+	// Its failures are recorded like any other.
+	provider.errs = append(provider.errs, errors.New("vault sealed"), errors.New("vault sealed"))
+	assert.EqualError(t, role.Refresh(context.Background()), "vault sealed")
+	assert.EqualError(t, role.Status().LastError, "vault sealed")
+}
+
+// A memoryProvider whose credentials are served with a type of its own.
+type typedProvider struct {
+	memoryProvider
+	credType string
+}
+
+func (p *typedProvider) CredentialType() string {
+	return p.credType
+}
+
+func TestCredentialType(t *testing.T) {
+	memory := memoryProvider{creds: Credentials{AccessKeyId: "memory-id", Expiration: time.Now().Add(time.Hour)}}
+	base := credentials.NewStaticCredentials("ASIABASE", "base-key", "base-token")
+
+	fc := setupTestFintoContext()
+	fc.set.SetRole("passthrough", "", WithPassthrough(base, &mockSessionTokenClient{}))
+	fc.set.SetRole("memory", testArn, WithCredentialProvider(&memoryProvider{creds: memory.creds}))
+	fc.set.SetRole("typed", testArn, WithCredentialProvider(&typedProvider{memory, "Vault"}))
+	fc.set.SetRole("untyped", testArn, WithCredentialProvider(&typedProvider{memory, ""}))
+	fc.set.SetRole("overridden", testArn, WithCredentialProvider(&typedProvider{memory, "Vault"}),
+		WithCredentialType("AWS-HMAC-Session"))
+	fc.set.SetRole("assume-overridden", testArn, WithCredentialType("Static"))
+	router := FintoRouter(fc)
+
+	for alias, expected := range map[string]string{
+		"test-alias":        DefaultCredentialType,
+		"passthrough":       DefaultCredentialType,
+		"memory":            DefaultCredentialType,
+		"typed":             "Vault",
+		"untyped":           DefaultCredentialType,
+		"overridden":        "AWS-HMAC-Session",
+		"assume-overridden": "Static",
+	} {
+		role, _ := fc.set.Role(alias)
+		assert.Equal(t, expected, role.CredentialType(), alias)
+
+		// Metadata and the control API serve the same type, and Code reports
+		// success alike.
+		for _, path := range []string{
+			"/latest/meta-data/iam/security-credentials/" + alias,
+			"/roles/" + alias + "/credentials",
+		} {
+			assert.NoError(t, fc.setInstanceRole(alias))
+
+			req, rec := setupTestRequest("GET", path, nil, t)
+			router.ServeHTTP(rec, req)
+
+			var resp map[string]string
+			if assert.Equal(t, http.StatusOK, rec.Code, path) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp)) {
+				assert.Equal(t, expected, resp["Type"], path)
+				assert.Equal(t, "Success", resp["Code"], path)
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package finto
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the proxies whose X-Forwarded-For headers are believed,
+// by IP address.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// Returns TrustedProxies from a list of IP addresses and CIDR blocks, e.g.
+// "127.0.0.1" or "172.17.0.0/16".
+func ParseTrustedProxies(addrs []string) (*TrustedProxies, error) {
+	nets, err := parseNets(addrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrustedProxies{nets}, nil
+}
+
+// Returns the address of the client behind a request. When the request comes
+// from a trusted proxy, X-Forwarded-For is read from the right, skipping the
+// hops of trusted proxies; the first hop that isn't one is the client, as any
+// further left may have been made up by it. A request that only passed
+// through trusted proxies is from the leftmost hop.
+func (p *TrustedProxies) clientIP(r *http.Request) net.IP {
+	ip := clientIP(r)
+	if p == nil || ip == nil || !containsIP(p.nets, ip) {
+		return ip
+	}
+
+	hops := strings.Split(strings.Join(r.Header["X-Forwarded-For"], ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			// A malformed hop can't be trusted, nor can anything past it.
+			break
+		}
+
+		ip = hop
+		if !containsIP(p.nets, hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// Wraps a handler so that requests from trusted proxies appear to come from
+// the client behind them: their RemoteAddr is the address X-Forwarded-For
+// gives, without a port. Client ACLs and request logs both see that address.
+// With nil proxies, X-Forwarded-For is ignored, as any client could send it.
+func TrustedProxyHandler(proxies *TrustedProxies, h http.Handler) http.Handler {
+	if proxies == nil {
+		return h
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := proxies.clientIP(r); ip != nil && !ip.Equal(clientIP(r)) {
+			r = r.WithContext(r.Context())
+			r.RemoteAddr = ip.String()
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
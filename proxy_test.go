@@ -0,0 +1,76 @@
+package finto
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxyClientIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		name   string
+		remote string
+		xff    []string
+		client string
+	}{
+		{"direct", "192.0.2.1:1234", nil, "192.0.2.1"},
+		{"untrusted peer", "192.0.2.1:1234", []string{"198.51.100.7"}, "192.0.2.1"},
+		{"trusted peer", "127.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"trusted peer, no header", "127.0.0.1:1234", nil, "127.0.0.1"},
+		{"rightmost untrusted hop", "127.0.0.1:1234", []string{"203.0.113.9, 198.51.100.7, 10.1.2.3"}, "198.51.100.7"},
+		{"repeated headers", "127.0.0.1:1234", []string{"203.0.113.9", "198.51.100.7, 10.1.2.3"}, "198.51.100.7"},
+		{"only trusted hops", "127.0.0.1:1234", []string{"10.1.2.3, 10.4.5.6"}, "10.1.2.3"},
+		{"malformed hop", "127.0.0.1:1234", []string{"198.51.100.7, bogus, 10.1.2.3"}, "10.1.2.3"},
+	}
+
+	for _, c := range cases {
+		r := &http.Request{RemoteAddr: c.remote, Header: http.Header{}}
+		for _, v := range c.xff {
+			r.Header.Add("X-Forwarded-For", v)
+		}
+
+		assert.Equal(t, c.client, proxies.clientIP(r).String(), c.name)
+	}
+
+	_, err = ParseTrustedProxies([]string{"proxy"})
+	assert.Error(t, err)
+}
+
+func TestTrustedProxyHandler(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	acl, _ := ParseClientACL([]string{"198.51.100.7"}, nil)
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithClientACL(acl)))
+
+	proxies, _ := ParseTrustedProxies([]string{"127.0.0.1"})
+	path := "/latest/meta-data/iam/security-credentials/test-alias"
+
+	// Without trusted proxies, the header is ignored, as anyone may send it.
+	for _, p := range []*TrustedProxies{nil, proxies} {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		req.RemoteAddr = "127.0.0.1:54321"
+		req.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+		TrustedProxyHandler(p, FintoRouter(fc)).ServeHTTP(rec, req)
+
+		if p == nil {
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+		} else {
+			assert.Equal(t, http.StatusOK, rec.Code)
+		}
+	}
+
+	// The header of an untrusted client is ignored too.
+	req, rec := setupTestRequest("GET", path, nil, t)
+	req.RemoteAddr = "192.0.2.1:54321"
+	req.Header.Set("X-Forwarded-For", "198.51.100.7")
+
+	TrustedProxyHandler(proxies, FintoRouter(fc)).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
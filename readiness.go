@@ -0,0 +1,135 @@
+package finto
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// CallerIdentityClient is a basic interface that wraps GetCallerIdentity,
+// which any valid credentials may call.
+//
+// https://godoc.org/github.com/aws/aws-sdk-go/service/sts#GetCallerIdentityInput
+type CallerIdentityClient interface {
+	GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error)
+}
+
+// How long the outcome of an STS check is reused by default.
+const DefaultReadinessCache = 30 * time.Second
+
+// The bound on a single STS check, so that a probe doesn't hang on a
+// blackholed endpoint.
+const readinessTimeout = 5 * time.Second
+
+// Checks that STS is reachable, and accepts finto's credentials, for readiness
+// probes. Outcomes are reused for a while, so frequent probes don't hammer STS.
+type stsCheck struct {
+	client CallerIdentityClient
+	cache  time.Duration
+
+	checkedAt time.Time
+	err       error
+	m         sync.Mutex // Held while checking, so concurrent probes share a check
+}
+
+// Returns the outcome of the latest check and when it was made, checking again
+// if it's older than the cache.
+func (c *stsCheck) check(ctx context.Context) (time.Time, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < c.cache {
+		return c.checkedAt, c.err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	_, c.err = c.client.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	c.checkedAt = time.Now()
+
+	return c.checkedAt, c.err
+}
+
+// Makes /readyz check that STS is reachable through c, calling
+// GetCallerIdentity, e.g. with the base credentials. Outcomes are reused for
+// cache, or DefaultReadinessCache if it's zero. A nil c disables the check.
+func (fc *fintoContext) SetReadinessCheck(c CallerIdentityClient, cache time.Duration) {
+	if cache <= 0 {
+		cache = DefaultReadinessCache
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.stsCheck = nil
+	if c != nil {
+		fc.stsCheck = &stsCheck{client: c, cache: cache}
+	}
+}
+
+// Checks that STS is reachable as /readyz does, sharing its cached outcome.
+// Returns false without checking if the readiness check is disabled.
+func (fc *fintoContext) CheckSTS(ctx context.Context) (bool, error) {
+	fc.m.Lock()
+	check := fc.stsCheck
+	fc.m.Unlock()
+
+	if check == nil {
+		return false, nil
+	}
+
+	_, err := check.check(ctx)
+	return true, err
+}
+
+// Report whether finto is ready to serve credentials: whether an instance role
+// is set, and if enabled, whether STS is reachable. Responds 503 if not, for
+// readiness probes.
+func readyShow(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type checkResult struct {
+			OK        bool   `json:"ok"`
+			Error     string `json:"error,omitempty"`
+			CheckedAt string `json:"checked_at,omitempty"`
+		}
+
+		checks := make(map[string]checkResult)
+
+		active := checkResult{OK: fc.getInstanceRole() != ""}
+		if !active.OK {
+			active.Error = "no role is active"
+		}
+		checks["active_role"] = active
+
+		fc.m.Lock()
+		check := fc.stsCheck
+		fc.m.Unlock()
+
+		if check != nil {
+			// Not bound to the probe, whose giving up would be cached as
+			// STS failing.
+			at, err := check.check(context.Background())
+
+			result := checkResult{OK: err == nil, CheckedAt: formatTime(at)}
+			if err != nil {
+				result.Error = RedactSecrets(err.Error())
+			}
+			checks["sts"] = result
+		}
+
+		ready, status := true, http.StatusOK
+		for _, c := range checks {
+			if !c.OK {
+				ready, status = false, http.StatusServiceUnavailable
+			}
+		}
+
+		jsonStatusResponse(w, map[string]interface{}{"ready": ready, "checks": checks}, status)
+	})
+}
@@ -0,0 +1,105 @@
+package finto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// A mock client whose GetCallerIdentity fails with err, or else reports arn,
+// counting calls.
+type mockCallerIdentityClient struct {
+	arn   string
+	err   error
+	calls int
+}
+
+func (c *mockCallerIdentityClient) GetCallerIdentityWithContext(ctx aws.Context, input *sts.GetCallerIdentityInput, opts ...request.Option) (*sts.GetCallerIdentityOutput, error) {
+	c.calls += 1
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return &sts.GetCallerIdentityOutput{Account: aws.String("123456789012"), Arn: aws.String(c.arn)}, nil
+}
+
+func TestReadiness(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	type result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	probe := func() (int, bool, map[string]result) {
+		req, rec := setupTestRequest("GET", "/readyz", nil, t)
+		router.ServeHTTP(rec, req)
+
+		var resp struct {
+			Ready  bool              `json:"ready"`
+			Checks map[string]result `json:"checks"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &resp))
+
+		return rec.Code, resp.Ready, resp.Checks
+	}
+
+	// Without the STS check, readiness only needs an active role.
+	code, ready, checks := probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ready)
+	assert.Equal(t, map[string]result{"active_role": {OK: true}}, checks)
+
+	checked, _ := fc.CheckSTS(context.Background())
+	assert.False(t, checked)
+
+	client := &mockCallerIdentityClient{}
+	fc.SetReadinessCheck(client, time.Minute)
+
+	code, ready, checks = probe()
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ready)
+	assert.True(t, checks["sts"].OK)
+
+	// Outcomes are cached, so STS isn't called on every probe.
+	client.err = errors.New("dial tcp: i/o timeout")
+	probe()
+	assert.Equal(t, 1, client.calls)
+
+	// An unreachable STS makes finto unready.
+	client = &mockCallerIdentityClient{err: errors.New("dial tcp: i/o timeout")}
+	fc.SetReadinessCheck(client, time.Minute)
+
+	checked, err := fc.CheckSTS(context.Background())
+	assert.True(t, checked)
+	assert.EqualError(t, err, "dial tcp: i/o timeout")
+
+	code, ready, checks = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ready)
+	assert.Equal(t, result{Error: "dial tcp: i/o timeout"}, checks["sts"])
+
+	// The cache expires.
+	fc.SetReadinessCheck(client, time.Nanosecond)
+	probe()
+	time.Sleep(time.Millisecond)
+	probe()
+	assert.Equal(t, 3, client.calls)
+
+	fc.SetReadinessCheck(nil, 0)
+	fc.instanceRole = ""
+
+	code, ready, checks = probe()
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ready)
+	assert.Equal(t, map[string]result{"active_role": {Error: "no role is active"}}, checks)
+}
@@ -0,0 +1,90 @@
+package finto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Returns a stand-in for a secret, to show in its place: a short fingerprint,
+// so that occurrences of the same secret can be correlated without revealing
+// it.
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(secret))
+	return "<redacted:" + hex.EncodeToString(sum[:4]) + ">"
+}
+
+// The secrets of the credentials finto has retrieved, kept until they expire
+// so that they can be scrubbed from diagnostic output.
+var secrets = &secretSet{values: make(map[string]time.Time)}
+
+type secretSet struct {
+	values map[string]time.Time // Secret->expiration pairs; zero if unknown
+	m      sync.RWMutex
+}
+
+// Adds secrets valid until expiration, and forgets those that have expired.
+func (s *secretSet) add(expiration time.Time, values ...string) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	now := time.Now()
+	for v, exp := range s.values {
+		if !exp.IsZero() && exp.Before(now) {
+			delete(s.values, v)
+		}
+	}
+
+	for _, v := range values {
+		if v != "" {
+			s.values[v] = expiration
+		}
+	}
+}
+
+// Returns text with every secret in the set replaced by its fingerprint.
+func (s *secretSet) scrub(text string) string {
+	s.m.RLock()
+	defer s.m.RUnlock()
+
+	for v := range s.values {
+		if strings.Contains(text, v) {
+			text = strings.Replace(text, v, redact(v), -1)
+		}
+	}
+
+	return text
+}
+
+// Returns s with the secret access keys and session tokens of credentials
+// finto holds replaced by fingerprints, e.g. <redacted:1a2b3c4d>.
+func RedactSecrets(s string) string {
+	return secrets.scrub(s)
+}
+
+// Returns a writer that redacts credentials' secrets from what's written
+// through it before passing it on to w, e.g. for log output. Each write is
+// scrubbed whole, so a secret split across writes goes unnoticed; a
+// log.Logger writes each line at once.
+func RedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w}
+}
+
+type redactingWriter struct {
+	io.Writer
+}
+
+func (w redactingWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(w.Writer, RedactSecrets(string(b))); err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
@@ -0,0 +1,79 @@
+package finto
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	assert.Regexp(t, regexp.MustCompile(`^<redacted:[0-9a-f]{8}>$`), redact("secret"))
+	assert.Equal(t, redact("secret"), redact("secret"))
+	assert.NotEqual(t, redact("secret"), redact("other secret"))
+	assert.Equal(t, "", redact(""))
+}
+
+func TestSecretsNeverLogged(t *testing.T) {
+	const (
+		secret = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYSECRETKEY"
+		token  = "FwoGZXIvYXdzEXAMPLESESSIONTOKEN"
+	)
+
+	var logged bytes.Buffer
+	log.SetOutput(RedactingWriter(&logged))
+	defer log.SetOutput(os.Stderr)
+
+	provider := &memoryProvider{creds: Credentials{
+		AccessKeyId:     "ASIAEXAMPLE",
+		SecretAccessKey: secret,
+		SessionToken:    token,
+		Expiration:      time.Now().Add(time.Hour),
+	}}
+
+	fc := setupTestFintoContext()
+	assert.NoError(t, fc.set.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+	role, _ := fc.set.Role("test-alias")
+
+	_, err := role.Credentials(context.Background())
+	assert.NoError(t, err)
+
+	// A provider whose failure quotes the credentials, logged and reported
+	// through both the metadata mock and the control API.
+	provider.errs = []error{
+		errors.New("refused key " + secret + " with token " + token),
+		errors.New("refused key " + secret + " with token " + token),
+	}
+	provider.calls = 0
+	role.creds.SetExpiration(time.Now().Add(-time.Minute), 0)
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	req, rec = setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), secret)
+	assert.NotContains(t, rec.Body.String(), token)
+
+	var body errorBody
+	if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Contains(t, body.Error, redact(secret))
+	}
+
+	log.Printf("webhook failed for %s:%s", secret, token)
+
+	assert.NotEmpty(t, logged.String())
+	assert.NotContains(t, logged.String(), secret)
+	assert.NotContains(t, logged.String(), token)
+	assert.Contains(t, logged.String(), redact(token))
+}
@@ -0,0 +1,124 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RefreshWindow sets when the refresher renews credentials: a fixed Lead before
+// they expire, or once an Elapsed fraction of their lifetime has passed, which
+// adapts to sessions of any length. Elapsed takes precedence when both are set.
+type RefreshWindow struct {
+	Lead    time.Duration // Refresh this long before expiry
+	Elapsed float64       // Refresh once this fraction of the lifetime has passed, in (0, 1)
+}
+
+// Returns a RefreshWindow parsed from a duration before expiry, e.g. "5m", or a
+// percentage of the lifetime elapsed, e.g. "80%".
+func ParseRefreshWindow(s string) (RefreshWindow, error) {
+	if p := strings.TrimSuffix(s, "%"); p != s {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v <= 0 || v >= 100 {
+			return RefreshWindow{}, fmt.Errorf("invalid refresh percentage: %q", s)
+		}
+
+		return RefreshWindow{Elapsed: v / 100}, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return RefreshWindow{}, fmt.Errorf("invalid refresh duration: %q", s)
+	}
+
+	return RefreshWindow{Lead: d}, nil
+}
+
+// Returns whether the window refreshes at all; the zero RefreshWindow doesn't.
+func (w RefreshWindow) IsZero() bool {
+	return w.Lead == 0 && w.Elapsed == 0
+}
+
+// Backoff between failed background refreshes. Attempts are unbounded; they
+// stop only when the refresher does.
+var refresherRetry = RetryPolicy{
+	BaseDelay: 5 * time.Second,
+	MaxDelay:  5 * time.Minute,
+}
+
+// Refreshes the instance role's credentials in the background within window,
+// so requests are served from the cache rather than waiting on STS. It follows
+// the instance role as it changes, backs off on repeated failures, and returns
+// once ctx is cancelled.
+func (fc *fintoContext) RunRefresher(ctx context.Context, window RefreshWindow) {
+	failures := 0
+
+	for {
+		alias := fc.getInstanceRole()
+
+		// Without a role to refresh, wait for the instance role to change.
+		var wait <-chan time.Time
+		var timer *time.Timer
+
+		role, err := fc.set.Role(alias)
+		if err == nil {
+			timer = time.NewTimer(refreshDelay(role, window, failures))
+			wait = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-fc.roleChanged:
+			failures = 0
+		case <-wait:
+			if err := role.Refresh(ctx); err != nil && ctx.Err() == nil {
+				failures += 1
+				log.Printf("warning: background refresh of role %s failed: %s", alias, err)
+			} else {
+				failures = 0
+			}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Returns how long to wait before refreshing role. With a fixed lead,
+// credentials that live for less than twice it are refreshed halfway through
+// their lifetime instead.
+func refreshDelay(role *Role, window RefreshWindow, failures int) time.Duration {
+	if failures > 0 {
+		return refresherRetry.backoff(failures)
+	}
+
+	now, skew := role.clockSkew()
+	expiration, refreshed := role.Expiration(), role.Status().LastRefresh
+	life := expiration.Sub(refreshed)
+
+	lead := window.Lead
+	if window.Elapsed > 0 {
+		lead = time.Duration(float64(life) * (1 - window.Elapsed))
+	} else if lead > life/2 {
+		lead = life / 2
+	}
+
+	delay := expiration.Add(-lead).Sub(now.Add(skew))
+
+	// Credentials minted within the skew are kept, however due they look.
+	if skew > 0 {
+		if fresh := refreshed.Add(skew).Sub(now); delay < fresh {
+			delay = fresh
+		}
+	}
+
+	return delay
+}
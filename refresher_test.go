@@ -0,0 +1,146 @@
+package finto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+)
+
+// Waits up to a second for role to be refreshed successfully.
+func waitForRefresh(t *testing.T, role *Role) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if !role.Status().LastRefresh.IsZero() {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return assert.Fail(t, "role was not refreshed", role.Arn())
+}
+
+func TestRunRefresher(t *testing.T) {
+	fc := setupTestFintoContext()
+	test, _ := fc.set.Role("test-alias")
+	another, _ := fc.set.Role("another-alias")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		fc.RunRefresher(ctx, RefreshWindow{Lead: time.Minute})
+		close(done)
+	}()
+
+	// The instance role is refreshed without a request for it.
+	waitForRefresh(t, test)
+	assert.False(t, test.IsExpired())
+	assert.True(t, another.Status().LastRefresh.IsZero())
+
+	// The refresher follows the instance role.
+	fc.setInstanceRole("another-alias")
+	waitForRefresh(t, another)
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		assert.Fail(t, "refresher did not stop")
+	}
+}
+
+func TestRunRefresherBackoff(t *testing.T) {
+	defer func(p RetryPolicy) { refresherRetry = p }(refresherRetry)
+	refresherRetry = RetryPolicy{BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+
+	fc := setupTestFintoContext()
+	role := NewRole(testArn, "finto-test-alias",
+		&FailingAssumeRoleClient{errs: []error{denied, denied}})
+	fc.set.roles["test-alias"] = role
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go fc.RunRefresher(ctx, RefreshWindow{Lead: time.Minute})
+
+	// Refreshes are retried after failing.
+	waitForRefresh(t, role)
+	assert.NoError(t, role.Status().LastError)
+}
+
+func TestRefreshDelay(t *testing.T) {
+	role := NewRole(testArn, "finto-test-alias", &MockAssumeRoleClient{})
+	minute := RefreshWindow{Lead: time.Minute}
+
+	// Credentials that have never been retrieved are refreshed right away.
+	assert.True(t, refreshDelay(role, minute, 0) <= 0)
+
+	role.lastRefresh = time.Now()
+	role.creds.SetExpiration(role.lastRefresh.Add(time.Hour), 0)
+
+	delay := refreshDelay(role, RefreshWindow{Lead: 5 * time.Minute}, 0)
+	assert.True(t, delay > 54*time.Minute && delay <= 55*time.Minute, delay)
+
+	// Short-lived credentials are refreshed halfway through their lifetime.
+	delay = refreshDelay(role, RefreshWindow{Lead: 2 * time.Hour}, 0)
+	assert.True(t, delay > 29*time.Minute && delay <= 30*time.Minute, delay)
+
+	// Failures back off regardless of expiration.
+	assert.True(t, refreshDelay(role, minute, 1) <= refresherRetry.BaseDelay)
+}
+
+func TestRefreshDelayElapsed(t *testing.T) {
+	role := NewRole(testArn, "finto-test-alias", &MockAssumeRoleClient{})
+	window := RefreshWindow{Lead: 5 * time.Minute, Elapsed: 0.8}
+
+	cases := []struct {
+		life, delay time.Duration
+	}{
+		{15 * time.Minute, 12 * time.Minute},
+		{time.Hour, 48 * time.Minute},
+		{12 * time.Hour, 576 * time.Minute},
+	}
+
+	// The elapsed fraction takes precedence over the lead, and scales with
+	// the lifetime.
+	for _, c := range cases {
+		role.lastRefresh = time.Now()
+		role.creds.SetExpiration(role.lastRefresh.Add(c.life), 0)
+
+		delay := refreshDelay(role, window, 0)
+		assert.True(t, delay > c.delay-time.Second && delay <= c.delay, c.life)
+	}
+}
+
+func TestParseRefreshWindow(t *testing.T) {
+	cases := []struct {
+		s      string
+		window RefreshWindow
+		err    bool
+	}{
+		{"5m", RefreshWindow{Lead: 5 * time.Minute}, false},
+		{"0", RefreshWindow{}, false},
+		{"80%", RefreshWindow{Elapsed: 0.8}, false},
+		{"12.5%", RefreshWindow{Elapsed: 0.125}, false},
+		{"0%", RefreshWindow{}, true},
+		{"100%", RefreshWindow{}, true},
+		{"soon%", RefreshWindow{}, true},
+		{"-5m", RefreshWindow{}, true},
+		{"soon", RefreshWindow{}, true},
+	}
+
+	for _, c := range cases {
+		window, err := ParseRefreshWindow(c.s)
+		assert.Equal(t, c.err, err != nil, c.s)
+		assert.Equal(t, c.window, window, c.s)
+	}
+
+	assert.True(t, RefreshWindow{}.IsZero())
+	assert.False(t, RefreshWindow{Elapsed: 0.8}.IsZero())
+}
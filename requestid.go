@@ -0,0 +1,63 @@
+package finto
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// The header carrying a request's ID, from clients and in responses.
+const RequestIDHeader = "X-Request-Id"
+
+// The header carrying the ID AWS gave a failed STS request, in responses to
+// requests for credentials that couldn't be retrieved.
+const AWSRequestIDHeader = "X-Finto-Aws-Request-Id"
+
+type requestIDKey struct{}
+
+// Wraps a handler so that each request has an ID for correlating it with
+// finto's logs: the client's X-Request-Id if it sent a usable one, and
+// otherwise a generated one. The ID is returned in the response's
+// X-Request-Id header and in error bodies, and is available to inner handlers
+// through RequestID.
+func RequestIDHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// Returns the ID of a request handled by RequestIDHandler, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// Returns whether a client's request ID can be used as is: short, and printable
+// without spaces, so it can't break up log lines.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,58 @@
+package finto
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := RequestIDHandler(FintoRouter(fc))
+
+	// A generated ID is returned in the header and any error body.
+	req, rec := setupTestRequest("GET", "/roles/missing-alias", nil, t)
+	router.ServeHTTP(rec, req)
+
+	id := rec.Header().Get(RequestIDHeader)
+	assert.Len(t, id, 32)
+
+	var body errorBody
+	if assert.NoError(t, json.NewDecoder(rec.Body).Decode(&body)) {
+		assert.Equal(t, id, body.RequestID)
+	}
+
+	// Each request gets its own.
+	req, rec = setupTestRequest("GET", "/roles", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotEqual(t, id, rec.Header().Get(RequestIDHeader))
+	assert.NotContains(t, rec.Body.String(), "request_id")
+
+	// A client's ID is honored, unless it could break up log lines.
+	for given, honored := range map[string]bool{
+		"sdk-call-1234":          true,
+		"two words":              false,
+		strings.Repeat("x", 129): false,
+	} {
+		req, rec = setupTestRequest("GET", "/roles", nil, t)
+		req.Header.Set(RequestIDHeader, given)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, honored, rec.Header().Get(RequestIDHeader) == given, given)
+	}
+
+	// Inner handlers can read it.
+	var seen string
+	h := RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = RequestID(r.Context())
+	}))
+
+	req, rec = setupTestRequest("GET", "/", nil, t)
+	req.Header.Set(RequestIDHeader, "abc")
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "abc", seen)
+}
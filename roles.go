@@ -1,12 +1,20 @@
 package finto
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"net"
+	"regexp"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
@@ -16,6 +24,7 @@ type Credentials struct {
 	Expiration      time.Time
 	SecretAccessKey string
 	SessionToken    string
+	LastUpdated     time.Time // When the credentials were minted
 }
 
 func (c *Credentials) IsExpired() bool {
@@ -36,31 +45,137 @@ func (c *Credentials) SetExpiration(t time.Time, offset time.Duration) {
 
 // AssumeRoleClient is a basic interface that wraps role assumption.
 //
-// AssumeRole takes the input of a role ARN and session name, and returns a set
-// of credentials including: an access key ID, a secret access key, a session
-// token, and their expiration.
+// AssumeRoleWithContext takes the input of a role ARN and session name, and
+// returns a set of credentials including: an access key ID, a secret access
+// key, a session token, and their expiration. The request is abandoned if ctx
+// is cancelled or its deadline passes.
 //
 // https://godoc.org/github.com/aws/aws-sdk-go/service/sts#AssumeRoleInput
 // https://godoc.org/github.com/aws/aws-sdk-go/service/sts#AssumeRoleOutput
 type AssumeRoleClient interface {
-	AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error)
+	AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error)
+}
+
+// RetryPolicy bounds the retries of transient AssumeRole failures. Delays
+// between attempts grow exponentially from BaseDelay up to MaxDelay, with
+// jitter.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts, including the first
+	BaseDelay   time.Duration // Delay before the first retry
+	MaxDelay    time.Duration // Cap on the delay between attempts; zero for none
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+// Returns the delay before retrying the given attempt. The delay doubles with
+// each attempt until it reaches MaxDelay, and half of it is randomized to
+// spread out retries.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay << uint(attempt-1)
+	if p.MaxDelay > 0 && (d > p.MaxDelay || d < p.BaseDelay) {
+		d = p.MaxDelay
+	}
+
+	if d <= 0 {
+		return 0
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// Returns whether err is a transient failure worth retrying: throttling,
+// server-side errors, and network timeouts.
+func isRetryable(err error) bool {
+	if rf, ok := err.(awserr.RequestFailure); ok && rf.StatusCode() >= 500 {
+		return true
+	}
+
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "Throttling", "ThrottlingException", "RequestLimitExceeded",
+			"RequestThrottled", "RequestError", "RequestTimeout",
+			"RequestTimeoutException", "IDPCommunicationError":
+			return true
+		}
+
+		err = aerr.OrigErr()
+	}
+
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// Returns the ID AWS gave a failed request, which support cases need, or an
+// empty string if err didn't come from AWS. For a chain, it's the ID of the
+// last source's failure that has one.
+func awsRequestID(err error) string {
+	switch e := err.(type) {
+	case awserr.RequestFailure:
+		return e.RequestID()
+	case awserr.Error:
+		return awsRequestID(e.OrigErr())
+	case *ChainError:
+		for i := len(e.Failures) - 1; i >= 0; i-- {
+			if id := awsRequestID(e.Failures[i].Err); id != "" {
+				return id
+			}
+		}
+	}
+
+	return ""
 }
 
 // Implements a role, the retrieval of its credentials, and management of their
 // expiration.
 type Role struct {
-	arn         string      // The role's Amazon Resource Name
-	creds       Credentials // The role's credentials
-	sessionName string      // The session name recorded by assumption
-
-	client AssumeRoleClient // An AssumeRoleClient for retrieving credentials
-	m      sync.Mutex
+	arn            string        // The role's Amazon Resource Name
+	creds          Credentials   // The role's credentials
+	sessionName    string        // The session name recorded by assumption
+	sourceProfile  string        // The credentials profile the role is assumed from
+	aliases        []string      // Additional aliases the role is known by
+	sourceIdentity string        // Set on assumption for CloudTrail, if not empty
+	faults         *faults       // Failures injected in place of refreshes
+	profileName    string        // The instance profile name advertised by metadata
+	retry          RetryPolicy   // Retries for transient AssumeRole failures
+	limit          CallLimit     // Shared bound on retrievals in flight, across roles
+	clients        *ClientACL    // The clients the role is served to; all if nil
+	duration       time.Duration // The requested session duration; STS's default if zero
+	assumed        AssumeDetails // Details of the most recent assumption
+	caller         *callerCheck  // The identity its credentials must have; unchecked if nil
+
+	onRefresh func(Credentials) // Called with freshly refreshed credentials
+
+	lastErr     error     // The error of the most recent failed refresh
+	lastErrAt   time.Time // When the most recent refresh failed
+	lastRefresh time.Time // When credentials were last refreshed
+
+	clock   Clock         // The clock credentials' expiration is judged by
+	skew    time.Duration // How far the clock may disagree with STS's
+	maxSkew time.Duration // How far it may disagree before a warning is logged
+	maxTTL  time.Duration // How long credentials are served after minting; as long as STS allows if zero
+
+	refreshing       chan struct{}    // Closed once an in-flight refresh ends; nil if none is
+	refreshingPolicy RefreshingPolicy // What to serve meanwhile, once credentials have expired
+
+	client   AssumeRoleClient   // An AssumeRoleClient for retrieving credentials
+	provider CredentialProvider // Retrieves credentials in place of client, if set
+	credType string             // Type credentials are served with, in place of the provider's, if set
+	m        sync.Mutex
 }
 
 func NewRole(a, s string, c AssumeRoleClient) *Role {
 	return &Role{
 		arn:         a,
 		sessionName: s,
+		retry:       DefaultRetryPolicy,
+		clock:       systemClock{},
 		client:      c,
 	}
 }
@@ -73,6 +188,167 @@ func (r *Role) SessionName() string {
 	return r.sessionName
 }
 
+// Returns the credentials profile the role is assumed from, or an empty string
+// if it uses its set's client.
+func (r *Role) SourceProfile() string {
+	return r.sourceProfile
+}
+
+// Returns the additional aliases the role is known by, besides its canonical
+// alias.
+func (r *Role) Aliases() []string {
+	return r.aliases
+}
+
+// Returns the instance profile name the role is advertised under by metadata,
+// or an empty string if it is advertised under its alias.
+func (r *Role) ProfileName() string {
+	return r.profileName
+}
+
+// Returns the names, besides its canonical alias, that the role resolves by:
+// its aliases and its profile name.
+func (r *Role) names() []string {
+	names := r.aliases
+
+	if r.profileName != "" {
+		for _, a := range names {
+			if a == r.profileName {
+				return names
+			}
+		}
+
+		names = append(names[:len(names):len(names)], r.profileName)
+	}
+
+	return names
+}
+
+// Returns the source identity set when assuming the role, or an empty string if
+// none is set.
+func (r *Role) SourceIdentity() string {
+	return r.sourceIdentity
+}
+
+// RoleOption configures a role added to a RoleSet.
+type RoleOption func(*Role)
+
+// Assumes the role from the named credentials profile through c, rather than
+// through the set's client.
+func WithSourceProfile(profile string, c AssumeRoleClient) RoleOption {
+	return func(r *Role) {
+		r.sourceProfile = profile
+		r.client = c
+	}
+}
+
+// Assumes the role through c, rather than through the set's client.
+func WithClient(c AssumeRoleClient) RoleOption {
+	return func(r *Role) {
+		r.client = c
+	}
+}
+
+// Makes the role available under additional aliases, which resolve to the same
+// role as its canonical alias.
+func WithAliases(aliases ...string) RoleOption {
+	return func(r *Role) {
+		r.aliases = append(r.aliases, aliases...)
+	}
+}
+
+// Advertises the role in metadata under an instance profile name other than its
+// alias. The role also resolves by the name, so SDKs can fetch credentials
+// using the name they were given.
+func WithProfileName(name string) RoleOption {
+	return func(r *Role) {
+		r.profileName = name
+	}
+}
+
+// Sets a source identity on each assumption of the role. It is recorded by
+// CloudTrail and carried into sessions the role goes on to assume. The role's
+// trust policy must allow sts:SetSourceIdentity.
+func WithSourceIdentity(id string) RoleOption {
+	return func(r *Role) {
+		r.sourceIdentity = id
+	}
+}
+
+// Serves the role's credentials only to the clients acl permits. Other clients
+// are refused, whichever route they request the role through.
+func WithClientACL(acl *ClientACL) RoleOption {
+	return func(r *Role) {
+		r.clients = acl
+	}
+}
+
+// Returns whether the role's credentials may be served to the client at ip.
+func (r *Role) Permits(ip net.IP) bool {
+	return r.clients.Permits(ip)
+}
+
+// Requests sessions of the role lasting d, rather than STS's default of an
+// hour. Durations beyond the role's MaxSessionDuration are rejected by STS.
+func WithSessionDuration(d time.Duration) RoleOption {
+	return func(r *Role) {
+		r.duration = d
+	}
+}
+
+// Bounds on the session durations AssumeRole accepts. Roles assumed by roles,
+// chained, are further limited to an hour.
+const (
+	MinSessionDuration = 15 * time.Minute
+	MaxSessionDuration = 12 * time.Hour
+)
+
+// The session duration STS grants when none is requested.
+const DefaultSessionDuration = time.Hour
+
+// Returns an error if d isn't a session duration STS would accept.
+func ValidateSessionDuration(d time.Duration) error {
+	if d < MinSessionDuration || d > MaxSessionDuration || d%time.Second != 0 {
+		return fmt.Errorf("invalid session duration: %s; must be whole seconds from %s to %s",
+			d, MinSessionDuration, MaxSessionDuration)
+	}
+
+	return nil
+}
+
+// Returns whether err is STS's rejection of a session duration beyond the
+// role's MaxSessionDuration.
+func isDurationExceeded(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "ValidationError" &&
+		strings.Contains(aerr.Message(), "MaxSessionDuration")
+}
+
+// Source identities are 2 to 64 characters drawn from those allowed by STS.
+var sourceIdentityPattern = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
+// Returns an error if id isn't a source identity STS would accept.
+func ValidateSourceIdentity(id string) error {
+	if !sourceIdentityPattern.MatchString(id) {
+		return fmt.Errorf("invalid source identity: %q", id)
+	}
+
+	return nil
+}
+
+// Names a role can't be known by, as the control API's paths would shadow
+// them, e.g. /roles/active that of a role aliased active.
+var reservedAliases = map[string]bool{"active": true}
+
+// Returns an error if alias is reserved, and so can't name a role.
+func ValidateAlias(alias string) error {
+	if reservedAliases[alias] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+
+	return nil
+}
+
 // Returns whether the role's current credentials are expired.
 func (r *Role) IsExpired() bool {
 	r.m.Lock()
@@ -82,52 +358,365 @@ func (r *Role) IsExpired() bool {
 }
 
 func (r *Role) isExpired() bool {
-	return r.creds.IsExpired()
+	return expiredWithSkew(r.now(), r.creds.LastUpdated, r.creds.Expiration, r.skew)
 }
 
 // Returns the role's credentials. If expired, credentials are refreshed through
-// the client.
-func (r *Role) Credentials() (Credentials, error) {
+// the role's provider, or should a refresh already be in flight, handled per
+// the role's RefreshingPolicy. Transient failures are retried per the role's
+// RetryPolicy for as long as ctx allows, and an in-flight request is cancelled
+// along with ctx.
+func (r *Role) Credentials(ctx context.Context) (Credentials, error) {
+	creds, _, err := r.credentials(ctx)
+	return creds, err
+}
+
+// Returns the role's credentials as Credentials does, and whether they were
+// fetched by this call rather than served from the cache.
+func (r *Role) credentials(ctx context.Context) (Credentials, bool, error) {
 	r.m.Lock()
 	defer r.m.Unlock()
 
-	if r.isExpired() {
-		resp, err := r.client.AssumeRole(&sts.AssumeRoleInput{
-			RoleArn:         aws.String(r.Arn()),
-			RoleSessionName: aws.String(r.SessionName()),
-		})
+	fetched := false
+
+	for r.isExpired() {
+		done := r.refreshing
+		if done == nil {
+			if err := r.refresh(ctx); err != nil {
+				return Credentials{}, false, err
+			}
 
-		if err != nil {
-			return Credentials{}, err
+			// Served even if they're already expired, as fetching again
+			// would only fetch the same.
+			fetched = true
+			break
 		}
 
-		creds := resp.Credentials
-		r.creds.SetCredentials(*creds.AccessKeyId, *creds.SecretAccessKey, *creds.SessionToken)
-		r.creds.SetExpiration(*creds.Expiration, 300)
+		switch r.refreshingPolicy {
+		case RefreshingServeStale:
+			// Credentials only due for a refresh, e.g. within the clock
+			// skew, are still good to serve.
+			if r.creds.AccessKeyId != "" && r.now().Before(r.creds.Expiration) {
+				return r.creds, false, nil
+			}
+		case RefreshingUnavailable:
+			return Credentials{}, false, ErrRefreshing
+		}
+
+		r.m.Unlock()
+		select {
+		case <-ctx.Done():
+			r.m.Lock()
+			return Credentials{}, false, ctx.Err()
+		case <-done:
+		}
+		r.m.Lock()
+	}
+
+	return r.creds, fetched, nil
+}
+
+// Refreshes the role's credentials whether or not they have expired. Unlike
+// Credentials, the role isn't locked while its provider is called, so requests
+// keep being served the current credentials in the meantime.
+func (r *Role) Refresh(ctx context.Context) error {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.refresh(ctx)
+}
+
+// Retrieves fresh credentials. The role must be locked, and is unlocked while
+// its provider is called, during which it's marked as refreshing.
+func (r *Role) refresh(ctx context.Context) error {
+	if err := r.nextFault(); err != nil {
+		return r.update(Credentials{}, AssumeDetails{}, err)
+	}
+
+	done := make(chan struct{})
+	retry, limit := r.retry, r.limit
+	r.refreshing = done
+	r.m.Unlock()
+
+	creds, details, err := r.retrieve(ctx, retry, limit)
+
+	r.m.Lock()
+	if r.refreshing == done {
+		r.refreshing = nil
+	}
+	close(done)
+
+	return r.update(creds, details, err)
+}
+
+// Returns when the role's current credentials expire, or the zero time if none
+// have been retrieved.
+func (r *Role) Expiration() time.Time {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.creds.Expiration
+}
+
+// Records the outcome of a retrieval. The role must be locked.
+func (r *Role) update(creds Credentials, details AssumeDetails, err error) error {
+	if err != nil {
+		r.lastErr, r.lastErrAt = err, r.now()
+		return err
+	}
+
+	r.lastErr, r.lastRefresh = nil, r.now()
+	r.checkClockSkew(creds.Expiration)
+	secrets.add(creds.Expiration, creds.SecretAccessKey, creds.SessionToken)
+
+	r.creds.SetCredentials(creds.AccessKeyId, creds.SecretAccessKey, creds.SessionToken)
+	r.creds.SetExpiration(capExpiration(creds.Expiration, r.lastRefresh, r.maxTTL), 300)
+	r.creds.LastUpdated = r.lastRefresh
+	r.assumed = details
+
+	if r.onRefresh != nil {
+		r.onRefresh(r.creds)
+	}
+
+	return nil
+}
+
+// Serves creds, e.g. cached by an earlier run, until they expire, should the
+// role have none of its own yet. Returns whether they were taken.
+func (r *Role) restoreCredentials(creds Credentials) bool {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	if r.creds.AccessKeyId != "" || expiredWithSkew(r.now(), creds.LastUpdated, creds.Expiration, r.skew) {
+		return false
+	}
+
+	secrets.add(creds.Expiration, creds.SecretAccessKey, creds.SessionToken)
+	r.creds = creds
+	r.creds.Expiration = capExpiration(creds.Expiration, creds.LastUpdated, r.maxTTL)
+
+	return true
+}
+
+// AssumeDetails describes an assumption of a role beyond its credentials, for
+// diagnosing trust policies.
+type AssumeDetails struct {
+	AssumedRoleArn   string // The ARN of the assumed-role user, naming its session
+	AssumedRoleId    string // The assumed-role ID, as recorded by CloudTrail
+	PackedPolicySize int64  // Percentage of the session policy size limit used
+	SourceIdentity   string // The source identity set on the session, if any
+}
+
+// Returns the details of the role's most recent assumption.
+func (r *Role) AssumeDetails() AssumeDetails {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.assumed
+}
+
+// Returns the role's most recently retrieved credentials, even if they have
+// since expired, and whether any have been retrieved at all.
+func (r *Role) LastCredentials() (Credentials, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return r.creds, r.creds.AccessKeyId != ""
+}
+
+// RoleStatus reports the outcome of a role's recent credential refreshes.
+type RoleStatus struct {
+	LastError   error     // The error of the most recent refresh, if it failed
+	LastErrorAt time.Time // When the most recent failed refresh happened
+	LastRefresh time.Time // When credentials were last refreshed successfully
+}
+
+func (r *Role) Status() RoleStatus {
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	return RoleStatus{
+		LastError:   r.lastErr,
+		LastErrorAt: r.lastErrAt,
+		LastRefresh: r.lastRefresh,
 	}
+}
+
+// Retrieves credentials from the role's provider, retrying transient failures
+// per retry. Each attempt waits its turn under limit, and first checks the
+// caller identity, should the role expect one.
+func (r *Role) retrieve(ctx context.Context, retry RetryPolicy, limit CallLimit) (creds Credentials, details AssumeDetails, err error) {
+	ctx, span := startAssumeRoleSpan(ctx, r)
+	defer func() { endSpan(span, err) }()
+
+	provider := r.credentialProvider()
+
+	for attempt := 1; ; attempt++ {
+		if err := limit.acquire(ctx); err != nil {
+			return Credentials{}, AssumeDetails{}, err
+		}
+
+		if err = r.checkCaller(ctx); err == nil {
+			if dp, ok := provider.(detailedProvider); ok {
+				creds, details, err = dp.retrieveDetails(ctx)
+			} else {
+				creds, err = provider.Retrieve(ctx)
+			}
+		}
+		limit.release()
 
-	return r.creds, nil
+		if err == nil || attempt >= retry.MaxAttempts || !isRetryable(err) {
+			return creds, details, err
+		}
+
+		// Give up early rather than sleep past the caller's deadline.
+		delay := retry.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			return Credentials{}, AssumeDetails{}, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Credentials{}, AssumeDetails{}, err
+		case <-time.After(delay):
+		}
+	}
 }
 
-// A collection of aliased roles.
+// A collection of aliased roles. It is safe for concurrent use, so roles may be
+// resolved by metadata requests while the control API changes them.
 type RoleSet struct {
-	roles map[string]*Role
+	roles     map[string]*Role
+	aliases   map[string]string // Additional alias->canonical alias pairs
+	retry     RetryPolicy
+	limit     CallLimit // Bounds retrievals in flight across the set's roles
+	onRefresh RefreshHook
+	clock     Clock
+	skew      time.Duration
+	maxSkew   time.Duration
+	maxTTL    time.Duration
+	inFlight  RefreshingPolicy // What roles serve while refreshing expired credentials
 
 	client AssumeRoleClient
-	m      sync.Mutex
+	m      sync.RWMutex
 }
 
 func NewRoleSet(c AssumeRoleClient) *RoleSet {
 	return &RoleSet{
-		client: c,
-		roles:  make(map[string]*Role),
+		client:  c,
+		retry:   DefaultRetryPolicy,
+		clock:   systemClock{},
+		roles:   make(map[string]*Role),
+		aliases: make(map[string]string),
 	}
 }
 
-func (rs *RoleSet) Role(alias string) (*Role, error) {
+// RefreshHook is called with a role's alias and credentials each time they are
+// refreshed. It is called while the role is locked, so it must not block.
+type RefreshHook func(alias string, creds Credentials)
+
+// Sets the refresh hook of the set's roles, including those added later.
+func (rs *RoleSet) SetRefreshHook(hook RefreshHook) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.onRefresh = hook
+	for alias, role := range rs.roles {
+		role.m.Lock()
+		role.onRefresh = rs.refreshHookFor(alias)
+		role.m.Unlock()
+	}
+}
+
+// Adds a refresh hook to the set's roles, called after any set before it.
+func (rs *RoleSet) AddRefreshHook(hook RefreshHook) {
+	rs.m.RLock()
+	prev := rs.onRefresh
+	rs.m.RUnlock()
+
+	if prev == nil {
+		rs.SetRefreshHook(hook)
+		return
+	}
+
+	rs.SetRefreshHook(func(alias string, creds Credentials) {
+		prev(alias, creds)
+		hook(alias, creds)
+	})
+}
+
+func (rs *RoleSet) refreshHookFor(alias string) func(Credentials) {
+	hook := rs.onRefresh
+	if hook == nil {
+		return nil
+	}
+
+	return func(creds Credentials) { hook(alias, creds) }
+}
+
+// Sets the retry policy of the set's roles, including those added later.
+func (rs *RoleSet) SetRetryPolicy(p RetryPolicy) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.retry = p
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.retry = p
+		role.m.Unlock()
+	}
+}
+
+// RefreshingPolicy determines what is served when a role's credentials have
+// expired while a refresh of them is already in flight.
+type RefreshingPolicy int
+
+const (
+	RefreshingBlock       RefreshingPolicy = iota // Wait for the refresh to end
+	RefreshingServeStale                          // Serve credentials not yet past their expiration, else wait
+	RefreshingUnavailable                         // Fail with ErrRefreshing, so clients retry
+)
+
+// ErrRefreshing is returned in place of credentials that are being refreshed,
+// under RefreshingUnavailable.
+var ErrRefreshing = errors.New("credentials are being refreshed")
+
+// Parses a RefreshingPolicy from its name: "block", "stale", or "unavailable".
+func ParseRefreshingPolicy(s string) (RefreshingPolicy, error) {
+	switch s {
+	case "block":
+		return RefreshingBlock, nil
+	case "stale":
+		return RefreshingServeStale, nil
+	case "unavailable":
+		return RefreshingUnavailable, nil
+	}
+
+	return RefreshingBlock, fmt.Errorf("unknown refreshing policy: %s", s)
+}
+
+// Sets the refreshing policy of the set's roles, including those added later.
+// RefreshingBlock is the default.
+func (rs *RoleSet) SetRefreshingPolicy(p RefreshingPolicy) {
 	rs.m.Lock()
 	defer rs.m.Unlock()
 
+	rs.inFlight = p
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.refreshingPolicy = p
+		role.m.Unlock()
+	}
+}
+
+func (rs *RoleSet) Role(alias string) (*Role, error) {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+
+	if canonical, ok := rs.aliases[alias]; ok {
+		alias = canonical
+	}
+
 	if role, ok := rs.roles[alias]; ok {
 		return role, nil
 	}
@@ -135,9 +724,57 @@ func (rs *RoleSet) Role(alias string) (*Role, error) {
 	return &Role{}, fmt.Errorf("unknown role: %s", alias)
 }
 
+// Returns the canonical alias of the role with the given ARN. It is an error
+// for more than one role to have the ARN, as the alias served would then
+// depend on which role was found first.
+func (rs *RoleSet) AliasByArn(arn string) (string, error) {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+
+	var matches []string
+	for alias, role := range rs.roles {
+		if role.arn == arn {
+			matches = append(matches, alias)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("unknown role arn: %s", arn)
+	case 1:
+		return matches[0], nil
+	}
+
+	sort.Strings(matches)
+	return "", &AmbiguousArnError{Arn: arn, Aliases: matches}
+}
+
+// AmbiguousArnError reports that more than one role has an ARN looked up.
+type AmbiguousArnError struct {
+	Arn     string
+	Aliases []string // The aliases of the roles with the ARN, sorted
+}
+
+func (e *AmbiguousArnError) Error() string {
+	return fmt.Sprintf("role arn %s is ambiguous: aliases %s", e.Arn, strings.Join(e.Aliases, ", "))
+}
+
+// Returns the canonical alias of the role alias resolves to. Unknown aliases
+// are returned as is.
+func (rs *RoleSet) canonical(alias string) string {
+	rs.m.RLock()
+	defer rs.m.RUnlock()
+
+	if canonical, ok := rs.aliases[alias]; ok {
+		return canonical
+	}
+
+	return alias
+}
+
 func (rs *RoleSet) Roles() (roles []string) {
-	rs.m.Lock()
-	defer rs.m.Unlock()
+	rs.m.RLock()
+	defer rs.m.RUnlock()
 
 	roles = make([]string, len(rs.roles))
 
@@ -151,10 +788,141 @@ func (rs *RoleSet) Roles() (roles []string) {
 	return
 }
 
-// Set an alias's role configuration.
-func (rs *RoleSet) SetRole(alias, arn string) {
+// Set an alias's role configuration. Returns an error, and leaves the set
+// unchanged, if the alias or any of the role's additional aliases already
+// belong to another role.
+func (rs *RoleSet) SetRole(alias, arn string, opts ...RoleOption) error {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	return rs.setRole(alias, arn, opts...)
+}
+
+// Adds a role under a new alias. Returns an error if the alias is taken.
+func (rs *RoleSet) AddRole(alias, arn string, opts ...RoleOption) error {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	if _, ok := rs.roles[alias]; ok {
+		return fmt.Errorf("role already exists: %s", alias)
+	}
+
+	return rs.setRole(alias, arn, opts...)
+}
+
+// Replaces the configuration of an existing role. Credentials are retrieved
+// afresh for the new configuration. Returns an error if alias isn't a role's
+// canonical alias.
+func (rs *RoleSet) UpdateRole(alias, arn string, opts ...RoleOption) error {
 	rs.m.Lock()
 	defer rs.m.Unlock()
 
-	rs.roles[alias] = NewRole(arn, fmt.Sprintf("finto-%s", alias), rs.client)
+	if _, ok := rs.roles[alias]; !ok {
+		return fmt.Errorf("unknown role: %s", alias)
+	}
+
+	return rs.setRole(alias, arn, opts...)
+}
+
+// Removes a role, along with its additional aliases. Any of the role's aliases
+// may be given.
+func (rs *RoleSet) RemoveRole(alias string) error {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	if canonical, ok := rs.aliases[alias]; ok {
+		alias = canonical
+	}
+
+	role, ok := rs.roles[alias]
+	if !ok {
+		return fmt.Errorf("unknown role: %s", alias)
+	}
+
+	for _, a := range role.names() {
+		delete(rs.aliases, a)
+	}
+
+	delete(rs.roles, alias)
+	return nil
+}
+
+// Sets an alias's role configuration. The set must be locked.
+func (rs *RoleSet) setRole(alias, arn string, opts ...RoleOption) error {
+	role := NewRole(arn, fmt.Sprintf("finto-%s", alias), rs.client)
+	role.retry = rs.retry
+	role.limit = rs.limit
+	role.clock, role.skew, role.maxSkew = rs.clock, rs.skew, rs.maxSkew
+	role.maxTTL = rs.maxTTL
+	role.refreshingPolicy = rs.inFlight
+	role.onRefresh = rs.refreshHookFor(alias)
+
+	for _, opt := range opts {
+		opt(role)
+	}
+
+	if role.faults != nil {
+		if err := ValidateFaultKind(role.faults.kind); err != nil {
+			return fmt.Errorf("role %s: %s", alias, err)
+		}
+	}
+
+	if role.sourceIdentity != "" {
+		if err := ValidateSourceIdentity(role.sourceIdentity); err != nil {
+			return fmt.Errorf("role %s: %s", alias, err)
+		}
+	}
+
+	if role.duration != 0 {
+		if err := ValidateSessionDuration(role.duration); err != nil {
+			return fmt.Errorf("role %s: %s", alias, err)
+		}
+	}
+
+	for _, name := range append([]string{alias}, role.names()...) {
+		if err := ValidateAlias(name); err != nil {
+			return fmt.Errorf("role %s: %s", alias, err)
+		}
+	}
+
+	if owner, ok := rs.aliases[alias]; ok {
+		return fmt.Errorf("alias %s already belongs to role %s", alias, owner)
+	}
+
+	// A role named after its alias is advertised under it anyway.
+	if role.profileName == alias {
+		role.profileName = ""
+	}
+
+	names := role.names()
+
+	seen := map[string]bool{alias: true}
+	for _, a := range names {
+		if seen[a] {
+			return fmt.Errorf("alias %s is declared more than once by role %s", a, alias)
+		}
+		seen[a] = true
+
+		if _, ok := rs.roles[a]; ok {
+			return fmt.Errorf("alias %s of role %s is already a role", a, alias)
+		}
+
+		if owner, ok := rs.aliases[a]; ok && owner != alias {
+			return fmt.Errorf("alias %s of role %s already belongs to role %s", a, alias, owner)
+		}
+	}
+
+	// Replacing a role drops the aliases it was previously known by.
+	if old, ok := rs.roles[alias]; ok {
+		for _, a := range old.names() {
+			delete(rs.aliases, a)
+		}
+	}
+
+	for _, a := range names {
+		rs.aliases[a] = alias
+	}
+
+	rs.roles[alias] = role
+	return nil
 }
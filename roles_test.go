@@ -1,10 +1,16 @@
 package finto
 
 import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/stretchr/testify/assert"
 )
@@ -16,19 +22,51 @@ var MockExpiry time.Time = time.Unix(11833862400, 0)
 type MockAssumeRoleClient struct{}
 
 // Return a canned sts.AssumeRoleOutput.
-func (c *MockAssumeRoleClient) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+func (c *MockAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
 	mockId := *input.RoleArn + "-" + *input.RoleSessionName
 
 	return &sts.AssumeRoleOutput{
+		AssumedRoleUser: &sts.AssumedRoleUser{
+			Arn:           aws.String(*input.RoleArn + "/" + *input.RoleSessionName),
+			AssumedRoleId: aws.String("AROAMOCK:" + *input.RoleSessionName),
+		},
 		Credentials: &sts.Credentials{
 			AccessKeyId:     aws.String(mockId),
 			Expiration:      &MockExpiry,
 			SecretAccessKey: aws.String("mock-key"),
 			SessionToken:    aws.String("mock-token"),
 		},
+		PackedPolicySize: aws.Int64(6),
 	}, nil
 }
 
+// A mock client that fails with each of errs in turn before deferring to
+// MockAssumeRoleClient.
+type FailingAssumeRoleClient struct {
+	errs  []error
+	calls int
+}
+
+func (c *FailingAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	c.calls += 1
+	if c.calls <= len(c.errs) {
+		return nil, c.errs[c.calls-1]
+	}
+
+	return (&MockAssumeRoleClient{}).AssumeRoleWithContext(ctx, input)
+}
+
+// A mock client that records the input of each assumption before deferring to
+// MockAssumeRoleClient.
+type RecordingAssumeRoleClient struct {
+	inputs []*sts.AssumeRoleInput
+}
+
+func (c *RecordingAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	c.inputs = append(c.inputs, input)
+	return (&MockAssumeRoleClient{}).AssumeRoleWithContext(ctx, input)
+}
+
 func TestCredentials(t *testing.T) {
 	var (
 		uxt = time.Now().Add(10 * time.Minute)
@@ -95,13 +133,41 @@ func TestRole(t *testing.T) {
 
 	for _, c := range cases {
 		r := NewRole(c.arn, c.session, &MockAssumeRoleClient{})
-		creds, _ := r.Credentials()
+		creds, _ := r.Credentials(context.Background())
 
 		assert.Equal(t, c.expired, r.IsExpired())
 		assert.Equal(t, c.return_id, creds.AccessKeyId)
 	}
 }
 
+func TestRoleRefresh(t *testing.T) {
+	client := &FailingAssumeRoleClient{}
+	r := NewRole("test-arn", "test-session", client)
+
+	creds, _ := r.Credentials(context.Background())
+
+	// Refresh assumes the role even though its credentials are current.
+	if assert.NoError(t, r.Refresh(context.Background())) {
+		assert.Equal(t, 2, client.calls)
+		assert.Equal(t, creds.Expiration, r.Expiration())
+	}
+
+	refreshed, _ := r.LastCredentials()
+	assert.False(t, refreshed.LastUpdated.Before(creds.LastUpdated))
+
+	denied := awserr.New("AccessDenied", "not authorized", nil)
+	client.errs = []error{nil, nil, denied}
+
+	assert.Equal(t, denied, r.Refresh(context.Background()))
+	assert.Equal(t, denied, r.Status().LastError)
+
+	// A failed refresh keeps the current credentials.
+	current, err := r.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, refreshed, current)
+	}
+}
+
 func TestRoleSet(t *testing.T) {
 	rs := NewRoleSet(&MockAssumeRoleClient{})
 	rs.SetRole("test-alias", "test-arn")
@@ -118,3 +184,518 @@ func TestRoleSet(t *testing.T) {
 	_, err = rs.Role("fake-role")
 	assert.Error(t, err)
 }
+
+func TestRoleSetSourceProfile(t *testing.T) {
+	client := &FailingAssumeRoleClient{}
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("test-alias", "test-arn", WithSourceProfile("test-profile", client))
+
+	role, err := rs.Role("test-alias")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test-profile", role.SourceProfile())
+
+		_, err = role.Credentials(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, 1, client.calls)
+	}
+}
+
+func TestRoleSetAliases(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithAliases("test", "testing")))
+	assert.NoError(t, rs.SetRole("active-alias", "active-arn"))
+
+	assert.Equal(t, []string{"active-alias", "test-alias"}, rs.Roles())
+
+	canonical, _ := rs.Role("test-alias")
+	for _, alias := range []string{"test", "testing"} {
+		role, err := rs.Role(alias)
+		if assert.NoError(t, err) {
+			assert.Equal(t, canonical, role)
+		}
+	}
+
+	collisions := []struct {
+		alias   string
+		aliases []string
+	}{
+		{"test", nil},
+		{"other-alias", []string{"testing"}},
+		{"other-alias", []string{"active-alias"}},
+		{"other-alias", []string{"other", "other"}},
+	}
+
+	for _, c := range collisions {
+		assert.Error(t, rs.SetRole(c.alias, "other-arn", WithAliases(c.aliases...)), c.alias)
+	}
+
+	assert.Equal(t, []string{"active-alias", "test-alias"}, rs.Roles())
+
+	// Replacing a role releases its previous aliases.
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithAliases("test")))
+	_, err := rs.Role("testing")
+	assert.Error(t, err)
+}
+
+func TestRoleSetMutation(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+
+	assert.NoError(t, rs.AddRole("test-alias", "test-arn", WithAliases("test")))
+	assert.Error(t, rs.AddRole("test-alias", "other-arn"))
+	assert.Error(t, rs.AddRole("test", "other-arn"))
+
+	assert.NoError(t, rs.UpdateRole("test-alias", "updated-arn"))
+	assert.Error(t, rs.UpdateRole("missing-alias", "updated-arn"))
+
+	role, err := rs.Role("test-alias")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "updated-arn", role.Arn())
+	}
+
+	// Updating replaces the role's aliases along with the rest of it.
+	_, err = rs.Role("test")
+	assert.Error(t, err)
+
+	assert.NoError(t, rs.UpdateRole("test-alias", "updated-arn", WithAliases("test")))
+	assert.NoError(t, rs.RemoveRole("test"))
+	assert.Error(t, rs.RemoveRole("test-alias"))
+
+	_, err = rs.Role("test")
+	assert.Error(t, err)
+	assert.Empty(t, rs.Roles())
+}
+
+func TestReservedAlias(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+
+	// /roles/active would shadow the role's /roles/{alias}.
+	assert.Error(t, rs.SetRole("active", testArn))
+	assert.Error(t, rs.AddRole("test-alias", testArn, WithAliases("active")))
+	assert.Error(t, rs.AddRole("test-alias", testArn, WithProfileName("active")))
+	assert.Empty(t, rs.Roles())
+}
+
+// Exercises concurrent readers and writers; run with -race.
+func TestRoleSetConcurrency(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("test-alias", "test-arn")
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		alias := fmt.Sprintf("alias-%d", i)
+
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				rs.AddRole(alias, "arn", WithAliases(alias+"-other"))
+				rs.UpdateRole(alias, "updated-arn")
+				rs.RemoveRole(alias)
+			}
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				rs.Roles()
+
+				if role, err := rs.Role("test-alias"); assert.NoError(t, err) {
+					role.Credentials(context.Background())
+				}
+
+				rs.Role(alias)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, []string{"test-alias"}, rs.Roles())
+}
+
+func TestRoleSourceIdentity(t *testing.T) {
+	client := &RecordingAssumeRoleClient{}
+
+	rs := NewRoleSet(client)
+	assert.NoError(t, rs.SetRole("plain-alias", "plain-arn"))
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithSourceIdentity("demo@example.com")))
+
+	for _, alias := range []string{"plain-alias", "test-alias"} {
+		role, _ := rs.Role(alias)
+		role.Credentials(context.Background())
+	}
+
+	if assert.Len(t, client.inputs, 2) {
+		assert.Nil(t, client.inputs[0].SourceIdentity)
+		assert.Equal(t, "demo@example.com", aws.StringValue(client.inputs[1].SourceIdentity))
+	}
+
+	for _, id := range []string{"x", "has space", "slash/ed", strings.Repeat("x", 65)} {
+		assert.Error(t, rs.SetRole("invalid-alias", "arn", WithSourceIdentity(id)), id)
+	}
+
+	_, err := rs.Role("invalid-alias")
+	assert.Error(t, err)
+}
+
+func TestRoleSessionDuration(t *testing.T) {
+	client := &RecordingAssumeRoleClient{}
+
+	rs := NewRoleSet(client)
+	assert.NoError(t, rs.SetRole("plain-alias", "plain-arn"))
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithSessionDuration(2*time.Hour)))
+
+	for _, alias := range []string{"plain-alias", "test-alias"} {
+		role, _ := rs.Role(alias)
+		role.Credentials(context.Background())
+	}
+
+	if assert.Len(t, client.inputs, 2) {
+		assert.Nil(t, client.inputs[0].DurationSeconds)
+		assert.Equal(t, int64(7200), aws.Int64Value(client.inputs[1].DurationSeconds))
+	}
+
+	for _, d := range []time.Duration{time.Minute, 13 * time.Hour, time.Hour + time.Millisecond} {
+		assert.Error(t, rs.SetRole("invalid-alias", "arn", WithSessionDuration(d)), d.String())
+	}
+
+	// STS's rejection of a duration beyond the role's maximum names the role.
+	exceeded := awserr.New("ValidationError",
+		"The requested DurationSeconds exceeds the MaxSessionDuration set for this role.", nil)
+	assert.NoError(t, rs.SetRole("long-alias", "long-arn", WithSessionDuration(12*time.Hour),
+		WithClient(&FailingAssumeRoleClient{errs: []error{exceeded}})))
+
+	role, _ := rs.Role("long-alias")
+	_, err := role.Credentials(context.Background())
+	if aerr, ok := err.(awserr.Error); assert.True(t, ok) {
+		assert.Equal(t, "ValidationError", aerr.Code())
+		assert.Contains(t, aerr.Message(), "session duration 12h0m0s of role long-arn exceeds its MaxSessionDuration")
+	}
+}
+
+func TestRoleRetry(t *testing.T) {
+	var (
+		throttled = awserr.NewRequestFailure(
+			awserr.New("Throttling", "Rate exceeded", nil), 400, "req-id")
+		unavailable = awserr.NewRequestFailure(
+			awserr.New("ServiceUnavailable", "unavailable", nil), 503, "req-id")
+		denied = awserr.NewRequestFailure(
+			awserr.New("AccessDenied", "not authorized", nil), 403, "req-id")
+	)
+
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	cases := []struct {
+		errs  []error
+		calls int
+		fails bool
+	}{
+		{[]error{throttled}, 2, false},
+		{[]error{unavailable, throttled}, 3, false},
+		{[]error{throttled, throttled, throttled}, 3, true},
+		{[]error{denied}, 1, true},
+	}
+
+	for _, c := range cases {
+		client := &FailingAssumeRoleClient{errs: c.errs}
+		r := NewRole("test-arn", "test-session", client)
+		r.retry = policy
+
+		_, err := r.Credentials(context.Background())
+
+		assert.Equal(t, c.fails, err != nil)
+		assert.Equal(t, c.calls, client.calls)
+	}
+}
+
+func TestAWSRequestID(t *testing.T) {
+	denied := awserr.NewRequestFailure(
+		awserr.New("AccessDenied", "not authorized", nil), 403, "req-id")
+
+	cases := []struct {
+		err error
+		id  string
+	}{
+		{denied, "req-id"},
+		{awserr.New("ValidationError", "duration too long", denied), "req-id"},
+		{&ChainError{Failures: []SourceFailure{
+			{Source: "sso", Err: awserr.NewRequestFailure(awserr.New("ExpiredToken", "expired", nil), 400, "sso-id")},
+			{Source: "env", Err: denied},
+			{Source: "profile", Err: fmt.Errorf("no credentials")},
+		}}, "req-id"},
+		{awserr.New("RequestError", "send request failed", nil), ""},
+		{fmt.Errorf("vault sealed"), ""},
+		{nil, ""},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.id, awsRequestID(c.err), fmt.Sprint(c.err))
+	}
+}
+
+func TestRoleRetrySucceedsOnThirdAttempt(t *testing.T) {
+	throttled := awserr.NewRequestFailure(
+		awserr.New("Throttling", "Rate exceeded", nil), 400, "req-id")
+	client := &FailingAssumeRoleClient{errs: []error{throttled, throttled}}
+
+	r := NewRole("test-arn", "test-session", client)
+	r.retry = RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Millisecond}
+
+	creds, err := r.Credentials(context.Background())
+
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test-arn-test-session", creds.AccessKeyId)
+		assert.Equal(t, 3, client.calls)
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	cases := []struct {
+		attempt  int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{2, 100 * time.Millisecond, 200 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{5, 500 * time.Millisecond, time.Second},
+		{64, 500 * time.Millisecond, time.Second},
+	}
+
+	for _, c := range cases {
+		for i := 0; i < 10; i++ {
+			d := p.backoff(c.attempt)
+
+			assert.True(t, d >= c.min && d <= c.max, "attempt %d: %s", c.attempt, d)
+		}
+	}
+}
+
+func TestRoleRetryRespectsContext(t *testing.T) {
+	throttled := awserr.New("Throttling", "Rate exceeded", nil)
+	client := &FailingAssumeRoleClient{errs: []error{throttled, throttled}}
+
+	r := NewRole("test-arn", "test-session", client)
+	r.retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	_, err := r.Credentials(ctx)
+
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 1, client.calls)
+}
+
+// A mock client that blocks until its request is cancelled.
+type BlockingAssumeRoleClient struct{}
+
+func (c *BlockingAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	<-ctx.Done()
+	return nil, awserr.New(request.CanceledErrorCode, "request context canceled", ctx.Err())
+}
+
+func TestRoleCredentialsCancelled(t *testing.T) {
+	r := NewRole("test-arn", "test-session", &BlockingAssumeRoleClient{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	creds, err := r.Credentials(ctx)
+
+	if assert.Error(t, err) {
+		assert.Equal(t, request.CanceledErrorCode, err.(awserr.Error).Code())
+		assert.Equal(t, Credentials{}, creds)
+	}
+}
+
+func TestRoleSetRefreshHook(t *testing.T) {
+	var refreshed []string
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("test-alias", "test-arn")
+	rs.SetRefreshHook(func(alias string, creds Credentials) {
+		refreshed = append(refreshed, alias+":"+creds.AccessKeyId)
+	})
+	rs.SetRole("active-alias", "active-arn")
+
+	for _, alias := range []string{"test-alias", "active-alias", "test-alias"} {
+		role, _ := rs.Role(alias)
+		role.Credentials(context.Background())
+	}
+
+	// Cached credentials are not refreshed, and so not reported again.
+	assert.Equal(t, []string{
+		"test-alias:test-arn-finto-test-alias",
+		"active-alias:active-arn-finto-active-alias",
+	}, refreshed)
+}
+
+func TestRoleSetAddRefreshHook(t *testing.T) {
+	var refreshed []string
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	rs.SetRole("test-alias", "test-arn")
+	rs.AddRefreshHook(func(alias string, creds Credentials) {
+		refreshed = append(refreshed, "first:"+alias)
+	})
+	rs.AddRefreshHook(func(alias string, creds Credentials) {
+		refreshed = append(refreshed, "second:"+alias)
+	})
+
+	role, _ := rs.Role("test-alias")
+	role.Credentials(context.Background())
+
+	assert.Equal(t, []string{"first:test-alias", "second:test-alias"}, refreshed)
+}
+
+func TestAliasByArn(t *testing.T) {
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithAliases("test-extra")))
+	assert.NoError(t, rs.SetRole("another-alias", "another-arn"))
+
+	// Additional aliases don't make a role ambiguous.
+	alias, err := rs.AliasByArn("test-arn")
+	assert.NoError(t, err)
+	assert.Equal(t, "test-alias", alias)
+
+	_, err = rs.AliasByArn("missing-arn")
+	assert.EqualError(t, err, "unknown role arn: missing-arn")
+
+	assert.NoError(t, rs.SetRole("duplicate-alias", "test-arn"))
+	_, err = rs.AliasByArn("test-arn")
+	assert.Equal(t, &AmbiguousArnError{"test-arn", []string{"duplicate-alias", "test-alias"}}, err)
+}
+
+// A provider that reports each retrieval on started, then blocks until it's
+// released. For testing purposes.
+type gatedProvider struct {
+	creds   Credentials
+	started chan struct{}
+	release chan struct{}
+}
+
+func newGatedProvider(creds Credentials) *gatedProvider {
+	return &gatedProvider{
+		creds:   creds,
+		started: make(chan struct{}, 1),
+		release: make(chan struct{}, 1),
+	}
+}
+
+func (p *gatedProvider) Retrieve(ctx context.Context) (Credentials, error) {
+	p.started <- struct{}{}
+
+	select {
+	case <-p.release:
+		return p.creds, nil
+	case <-ctx.Done():
+		return Credentials{}, ctx.Err()
+	}
+}
+
+func TestRefreshingPolicy(t *testing.T) {
+	now := time.Now()
+
+	cases := []struct {
+		policy RefreshingPolicy
+		age    time.Duration // How long after being minted credentials are requested
+		id     string
+		err    error
+	}{
+		// Expired by the clock skew, but not yet past their expiration.
+		{RefreshingBlock, 6 * time.Minute, "fresh-id", nil},
+		{RefreshingServeStale, 6 * time.Minute, "stale-id", nil},
+		{RefreshingUnavailable, 6 * time.Minute, "", ErrRefreshing},
+
+		// Past their expiration, so too stale to serve.
+		{RefreshingServeStale, 11 * time.Minute, "fresh-id", nil},
+		{RefreshingUnavailable, 11 * time.Minute, "", ErrRefreshing},
+	}
+
+	for _, c := range cases {
+		clock := &fakeClock{now: now}
+		provider := newGatedProvider(Credentials{AccessKeyId: "stale-id", Expiration: now.Add(10 * time.Minute)})
+
+		rs := NewRoleSet(&MockAssumeRoleClient{})
+		rs.SetClock(clock)
+		rs.SetClockSkew(5 * time.Minute)
+		rs.SetRefreshingPolicy(c.policy)
+		assert.NoError(t, rs.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+		role, _ := rs.Role("test-alias")
+
+		provider.release <- struct{}{}
+		_, err := role.Credentials(context.Background())
+		assert.NoError(t, err)
+		<-provider.started
+
+		// Hold a refresh in flight while credentials are requested.
+		clock.Advance(c.age)
+		provider.creds = Credentials{AccessKeyId: "fresh-id", Expiration: clock.Now().Add(time.Hour)}
+
+		refreshed := make(chan error)
+		go func() { refreshed <- role.Refresh(context.Background()) }()
+		<-provider.started
+
+		served := make(chan Credentials)
+		go func() {
+			creds, err := role.Credentials(context.Background())
+			assert.Equal(t, c.err, err, "policy %d", c.policy)
+			served <- creds
+		}()
+
+		if c.id == "fresh-id" {
+			// The request waits on the refresh.
+			select {
+			case <-served:
+				t.Errorf("policy %d: served credentials mid-refresh", c.policy)
+			case <-time.After(10 * time.Millisecond):
+			}
+
+			provider.release <- struct{}{}
+			assert.Equal(t, "fresh-id", (<-served).AccessKeyId)
+		} else {
+			assert.Equal(t, c.id, (<-served).AccessKeyId, "policy %d", c.policy)
+			provider.release <- struct{}{}
+		}
+
+		assert.NoError(t, <-refreshed)
+	}
+}
+
+func TestCredentialsAlreadyExpired(t *testing.T) {
+	provider := &memoryProvider{creds: Credentials{AccessKeyId: "expired-id", Expiration: time.Now().Add(-time.Minute)}}
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+	role, _ := rs.Role("test-alias")
+
+	// Credentials that are expired as soon as they're fetched are served
+	// once, rather than fetched over and over.
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "expired-id", creds.AccessKeyId)
+	}
+	assert.Equal(t, 1, provider.calls)
+}
+
+func TestParseRefreshingPolicy(t *testing.T) {
+	for name, policy := range map[string]RefreshingPolicy{
+		"block":       RefreshingBlock,
+		"stale":       RefreshingServeStale,
+		"unavailable": RefreshingUnavailable,
+	} {
+		p, err := ParseRefreshingPolicy(name)
+		if assert.NoError(t, err) {
+			assert.Equal(t, policy, p)
+		}
+	}
+
+	_, err := ParseRefreshingPolicy("ignore")
+	assert.Error(t, err)
+}
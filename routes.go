@@ -18,6 +18,12 @@ type Route struct {
 type Routes []Route
 
 var routes = Routes{
+	Route{
+		Handler: webUI,
+		Name:    "web-ui",
+		Method:  "GET",
+		Pattern: "/",
+	},
 	Route{
 		Handler: rolesList,
 		Name:    "list-role",
@@ -30,6 +36,12 @@ var routes = Routes{
 		Method:  "PUT",
 		Pattern: "/roles",
 	},
+	Route{
+		Handler: rolesActive,
+		Name:    "show-active-role",
+		Method:  "GET",
+		Pattern: "/roles/active",
+	},
 	Route{
 		Handler: rolesShow,
 		Name:    "show-role",
@@ -37,11 +49,130 @@ var routes = Routes{
 		Pattern: "/roles/{alias}",
 	},
 	Route{
-		Handler: mockProfileCreds,
+		Handler: rolesCredentials,
 		Name:    "get-role-credentials",
 		Method:  "GET",
 		Pattern: "/roles/{alias}/credentials",
 	},
+	Route{
+		Handler: rolesActivateTemporary,
+		Name:    "activate-role-temporary",
+		Method:  "POST",
+		Pattern: "/roles/{alias}/activate-temporary",
+	},
+	Route{
+		Handler: rolesAssumeDetails,
+		Name:    "show-role-assume-details",
+		Method:  "GET",
+		Pattern: "/roles/{alias}/assume-details",
+	},
+	Route{
+		Handler: defaultRoleShow,
+		Name:    "show-default-role",
+		Method:  "GET",
+		Pattern: "/default-role",
+	},
+	Route{
+		Handler: defaultRoleSet,
+		Name:    "set-default-role",
+		Method:  "PUT",
+		Pattern: "/default-role",
+	},
+	Route{
+		Handler: groupCredentials,
+		Name:    "get-group-credentials",
+		Method:  "GET",
+		Pattern: "/roles/group/{name}/{member}",
+	},
+	Route{
+		Handler: arnCredentials,
+		Name:    "get-arn-credentials",
+		Method:  "GET",
+		Pattern: "/credentials",
+	},
+	Route{
+		Handler: versionShow,
+		Name:    "show-version",
+		Method:  "GET",
+		Pattern: "/version",
+	},
+	Route{
+		Handler: readyShow,
+		Name:    "show-readiness",
+		Method:  "GET",
+		Pattern: "/readyz",
+	},
+	Route{
+		Handler: metricsShow,
+		Name:    "show-metrics",
+		Method:  "GET",
+		Pattern: "/metrics",
+	},
+	Route{
+		Handler: instancesList,
+		Name:    "list-instances",
+		Method:  "GET",
+		Pattern: "/instances",
+	},
+	Route{
+		Handler: metadataShow,
+		Name:    "show-metadata",
+		Method:  "GET",
+		Pattern: "/metadata",
+	},
+	Route{
+		Handler: metadataSet,
+		Name:    "set-metadata",
+		Method:  "PUT",
+		Pattern: "/metadata",
+	},
+}
+
+// Routes that mock the EC2 instance metadata service. These are subject to
+// the metadata service being disabled.
+var metadataRoutes = Routes{
+	Route{
+		Handler: mockToken,
+		Name:    "metadata-token",
+		Method:  "PUT",
+		Pattern: "/latest/api/token",
+	},
+	Route{
+		Handler: mockMetadataIndex,
+		Name:    "metadata-index",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/",
+	},
+	Route{
+		Handler: mockAmiId,
+		Name:    "metadata-ami-id",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/ami-id",
+	},
+	Route{
+		Handler: mockInstanceId,
+		Name:    "metadata-instance-id",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/instance-id",
+	},
+	Route{
+		Handler: mockInstanceType,
+		Name:    "metadata-instance-type",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/instance-type",
+	},
+	Route{
+		Handler: mockIamIndex,
+		Name:    "metadata-iam",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/iam/",
+	},
+	Route{
+		Handler: mockIamInfo,
+		Name:    "metadata-iam-info",
+		Method:  "GET",
+		Pattern: "/latest/meta-data/iam/info",
+	},
 	Route{
 		Handler: mockProfile,
 		Name:    "metadata-iam-secreds",
@@ -54,18 +185,124 @@ var routes = Routes{
 		Method:  "GET",
 		Pattern: "/latest/meta-data/iam/security-credentials/{alias}",
 	},
+	Route{
+		Handler: mockIdentityDocument,
+		Name:    "metadata-identity-document",
+		Method:  "GET",
+		Pattern: "/latest/dynamic/instance-identity/document",
+	},
+	Route{
+		Handler: mockIdentitySignature(false),
+		Name:    "metadata-identity-signature",
+		Method:  "GET",
+		Pattern: "/latest/dynamic/instance-identity/signature",
+	},
+	Route{
+		Handler: mockIdentitySignature(true),
+		Name:    "metadata-identity-pkcs7",
+		Method:  "GET",
+		Pattern: "/latest/dynamic/instance-identity/pkcs7",
+	},
 }
 
+// Returns a router serving both the control API and the metadata mock.
 func FintoRouter(fc *fintoContext) *mux.Router {
 	router := mux.NewRouter().StrictSlash(true)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(notFound)
+	addControlRoutes(router, fc)
+	addMetadataRoutes(router, fc)
+
+	return router
+}
+
+// Returns a router serving only the control API, for use when it listens on
+// a separate address from the metadata mock.
+func ControlRouter(fc *fintoContext) *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(notFound)
+	addControlRoutes(router, fc)
+
+	return router
+}
+
+// Returns a router serving only the metadata mock.
+func MetadataRouter(fc *fintoContext) *mux.Router {
+	router := mux.NewRouter().StrictSlash(true)
+	router.NotFoundHandler = http.HandlerFunc(notFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(notFound)
+	addMetadataRoutes(router, fc)
+
+	return router
+}
+
+func addControlRoutes(router *mux.Router, fc *fintoContext) {
+	cors := fc.corsHandler()
+	_, server := fc.getServerHeaders()
+
+	// The methods each path's routes accept, in the order paths first appear.
+	var paths []string
+	allowed := make(map[string][]string)
 
 	for _, route := range routes {
+		if _, ok := allowed[route.Pattern]; !ok {
+			paths = append(paths, route.Pattern)
+		}
+		allowed[route.Pattern] = append(allowed[route.Pattern], route.Method)
+
+		handler := fc.routeLatencyHandler(route.Pattern, route.Handler(fc))
+		if route.Method != "GET" {
+			handler = readOnlyHandler(fc, handler)
+		}
+
+		handler = tracedHandler(fc, route.Name, serverHandler(server, handler))
+		methods := []string{route.Method}
+
+		// Preflight requests must reach the CORS middleware.
+		if cors != nil {
+			methods = append(methods, "OPTIONS")
+			handler = cors(handler)
+		}
+
+		router.
+			Methods(methods...).
+			Name(route.Name).
+			Path(route.Pattern).
+			Handler(handler)
+	}
+
+	// Other methods get a 405 rather than falling through to a 404. Being
+	// added last, these routes only match what no other does.
+	for _, path := range paths {
+		methods := allowed[path]
+		if cors != nil {
+			methods = append(methods, "OPTIONS")
+		}
+
+		router.
+			Path(path).
+			Handler(serverHandler(server, methodNotAllowed(methods)))
+	}
+}
+
+func addMetadataRoutes(router *mux.Router, fc *fintoContext) {
+	server, _ := fc.getServerHeaders()
+
+	for _, route := range metadataRoutes {
+		handler := fc.routeLatencyHandler(route.Pattern, route.Handler(fc))
+
+		// Reads require a session token; the token itself is fetched by PUT.
+		if route.Method == "GET" {
+			handler = tokenHandler(fc, handler)
+		}
+
 		router.
 			Methods(route.Method).
 			Name(route.Name).
 			Path(route.Pattern).
-			Handler(route.Handler(fc))
+			Handler(tracedHandler(fc, route.Name, serverHandler(server, metadataHandler(fc, handler))))
 	}
 
-	return router
+	addInstanceRoutes(router, fc)
 }
@@ -0,0 +1,110 @@
+package finto
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitRouters(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	cases := []struct {
+		path              string
+		control, metadata int
+	}{
+		{"/roles", http.StatusOK, http.StatusNotFound},
+		{"/latest/meta-data/iam/security-credentials/", http.StatusNotFound, http.StatusOK},
+	}
+
+	for _, c := range cases {
+		req, rec := setupTestRequest("GET", c.path, nil, t)
+		ControlRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, c.control, rec.Code, c.path)
+
+		req, rec = setupTestRequest("GET", c.path, nil, t)
+		MetadataRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, c.metadata, rec.Code, c.path)
+	}
+}
+
+func TestServerHeaders(t *testing.T) {
+	paths := []string{"/roles", "/latest/meta-data/iam/security-credentials/"}
+
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	// Only metadata responses mimic EC2 by default.
+	req, rec := setupTestRequest("GET", paths[1], nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "EC2ws", rec.Header().Get("Server"))
+
+	req, rec = setupTestRequest("GET", paths[0], nil, t)
+	router.ServeHTTP(rec, req)
+	_, ok := rec.Header()["Server"]
+	assert.False(t, ok)
+
+	fc.SetServerHeaders("metadata-server", "finto")
+	router = FintoRouter(fc)
+
+	for path, server := range map[string]string{paths[0]: "finto", paths[1]: "metadata-server"} {
+		req, rec := setupTestRequest("GET", path, nil, t)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, server, rec.Header().Get("Server"), path)
+	}
+
+	fc.SetServerHeaders("", "finto")
+	req, rec = setupTestRequest("GET", paths[1], nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	_, ok = rec.Header()["Server"]
+	assert.False(t, ok)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	fc := setupTestFintoContext()
+	router := FintoRouter(fc)
+
+	allowed := make(map[string][]string)
+	for _, route := range routes {
+		allowed[route.Pattern] = append(allowed[route.Pattern], route.Method)
+	}
+
+	vars := strings.NewReplacer("{alias}", "test-alias", "{name}", "dev", "{member}", "test-alias")
+
+	for pattern, methods := range allowed {
+		path := vars.Replace(pattern)
+
+		req, rec := setupTestRequest("DELETE", path, nil, t)
+		router.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, path)
+		assert.Equal(t, strings.Join(methods, ", "), rec.Header().Get("Allow"), path)
+		assert.Contains(t, rec.Body.String(), ErrCodeMethodNotAllowed, path)
+	}
+
+	// A path shared by routes of different methods accepts each of them.
+	req, rec := setupTestRequest("POST", "/roles", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "GET, PUT", rec.Header().Get("Allow"))
+
+	// Specific paths aren't mistaken for those with variables.
+	req, rec = setupTestRequest("POST", "/roles/active", nil, t)
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, "GET", rec.Header().Get("Allow"))
+
+	// Unknown paths are still not found, and metadata keeps EC2's behavior.
+	for _, path := range []string{"/nowhere", "/latest/meta-data/instance-id"} {
+		req, rec := setupTestRequest("DELETE", path, nil, t)
+		router.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusNotFound, rec.Code, path)
+	}
+
+	// Preflight requests are allowed alongside CORS.
+	fc.SetCORS(CORSConfig{AllowedOrigins: []string{"http://localhost:8080"}})
+	req, rec = setupTestRequest("DELETE", "/roles", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, "GET, PUT, OPTIONS", rec.Header().Get("Allow"))
+}
@@ -0,0 +1,71 @@
+package finto
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// SAMLClient is a basic interface that wraps role assumption with a SAML
+// assertion.
+//
+// https://godoc.org/github.com/aws/aws-sdk-go/service/sts#AssumeRoleWithSAMLInput
+type SAMLClient interface {
+	AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, opts ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error)
+}
+
+// SAMLAssertionFunc returns a base64-encoded SAML assertion from the identity
+// provider. It is called on each assumption, as assertions are short-lived.
+type SAMLAssertionFunc func(ctx context.Context) (string, error)
+
+// Assumes roles with SAML assertions, in place of long-lived credentials.
+type samlAssumeRoleClient struct {
+	principalArn string // The ARN of the IAM SAML provider
+	assertion    SAMLAssertionFunc
+	client       SAMLClient
+}
+
+// Returns an AssumeRoleClient that assumes roles through AssumeRoleWithSAML,
+// trusting the SAML provider principalArn, with assertions obtained from
+// assertion. Pass it to a role with WithClient.
+func NewSAMLAssumeRoleClient(principalArn string, assertion SAMLAssertionFunc, c SAMLClient) AssumeRoleClient {
+	return &samlAssumeRoleClient{
+		principalArn: principalArn,
+		assertion:    assertion,
+		client:       c,
+	}
+}
+
+func (s *samlAssumeRoleClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	assertion, err := s.assertion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain SAML assertion: %s", err)
+	}
+
+	// The session name and source identity come from the assertion's
+	// attributes, so only the role is passed along.
+	resp, err := s.client.AssumeRoleWithSAMLWithContext(ctx, &sts.AssumeRoleWithSAMLInput{
+		PrincipalArn:    aws.String(s.principalArn),
+		RoleArn:         input.RoleArn,
+		SAMLAssertion:   aws.String(assertion),
+		DurationSeconds: input.DurationSeconds,
+	}, opts...)
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == sts.ErrCodeExpiredTokenException {
+			return nil, awserr.New(aerr.Code(), "SAML assertion has expired; sign in to the identity provider again for a new one", aerr)
+		}
+
+		return nil, err
+	}
+
+	return &sts.AssumeRoleOutput{
+		AssumedRoleUser:  resp.AssumedRoleUser,
+		Credentials:      resp.Credentials,
+		PackedPolicySize: resp.PackedPolicySize,
+		SourceIdentity:   resp.SourceIdentity,
+	}, nil
+}
@@ -0,0 +1,85 @@
+package finto
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+)
+
+// A mock client that satisfies the SAMLClient interface, recording the input of
+// each assumption. It fails with err, if set.
+type MockSAMLClient struct {
+	inputs []*sts.AssumeRoleWithSAMLInput
+	err    error
+}
+
+func (c *MockSAMLClient) AssumeRoleWithSAMLWithContext(ctx aws.Context, input *sts.AssumeRoleWithSAMLInput, opts ...request.Option) (*sts.AssumeRoleWithSAMLOutput, error) {
+	c.inputs = append(c.inputs, input)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	return &sts.AssumeRoleWithSAMLOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String(*input.RoleArn + "-saml"),
+			Expiration:      &MockExpiry,
+			SecretAccessKey: aws.String("mock-key"),
+			SessionToken:    aws.String("mock-token"),
+		},
+	}, nil
+}
+
+func staticAssertion(assertion string) SAMLAssertionFunc {
+	return func(context.Context) (string, error) {
+		return assertion, nil
+	}
+}
+
+func TestSAMLAssumeRoleClient(t *testing.T) {
+	saml := &MockSAMLClient{}
+	client := NewSAMLAssumeRoleClient("test-provider", staticAssertion("test-assertion"), saml)
+
+	rs := NewRoleSet(&MockAssumeRoleClient{})
+	assert.NoError(t, rs.SetRole("test-alias", "test-arn", WithClient(client)))
+	role, _ := rs.Role("test-alias")
+
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test-arn-saml", creds.AccessKeyId)
+	}
+
+	if assert.Len(t, saml.inputs, 1) {
+		assert.Equal(t, "test-provider", *saml.inputs[0].PrincipalArn)
+		assert.Equal(t, "test-arn", *saml.inputs[0].RoleArn)
+		assert.Equal(t, "test-assertion", *saml.inputs[0].SAMLAssertion)
+	}
+}
+
+func TestSAMLAssumeRoleClientErrors(t *testing.T) {
+	saml := &MockSAMLClient{
+		err: awserr.New(sts.ErrCodeExpiredTokenException, "Token must be redeemed within 5 minutes of issuance", nil),
+	}
+	client := NewSAMLAssumeRoleClient("test-provider", staticAssertion("test-assertion"), saml)
+
+	_, err := client.AssumeRoleWithContext(context.Background(), &sts.AssumeRoleInput{RoleArn: aws.String("test-arn")})
+	if aerr, ok := err.(awserr.Error); assert.True(t, ok) {
+		assert.Equal(t, sts.ErrCodeExpiredTokenException, aerr.Code())
+		assert.True(t, strings.Contains(aerr.Message(), "SAML assertion has expired"))
+		assert.False(t, isRetryable(err))
+	}
+
+	failing := func(context.Context) (string, error) {
+		return "", errors.New("exit status 1")
+	}
+	client = NewSAMLAssumeRoleClient("test-provider", failing, &MockSAMLClient{})
+
+	_, err = client.AssumeRoleWithContext(context.Background(), &sts.AssumeRoleInput{RoleArn: aws.String("test-arn")})
+	assert.EqualError(t, err, "failed to obtain SAML assertion: exit status 1")
+}
@@ -0,0 +1,138 @@
+package finto
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// State is what finto is serving, as changed at runtime through the control
+// API, e.g. to persist across restarts.
+type State struct {
+	ActiveRole  string `json:"active_role"`
+	ActiveGroup string `json:"active_group,omitempty"` // Set if the active role is a group's primary
+}
+
+// Returns the current state.
+func (fc *fintoContext) Snapshot() State {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	return State{ActiveRole: fc.instanceRole, ActiveGroup: fc.activeGroup}
+}
+
+// Returns to a state from Snapshot, activating its group or role, or the
+// default role should the role no longer exist. Returns an error, leaving the
+// state as it was, if the group no longer exists, or the role doesn't and
+// there's no default.
+func (fc *fintoContext) Restore(s State) error {
+	if s.ActiveGroup != "" {
+		fc.m.Lock()
+		g, ok := fc.groups[s.ActiveGroup]
+		fc.m.Unlock()
+
+		if !ok {
+			return fmt.Errorf("unknown group: %s", s.ActiveGroup)
+		}
+
+		if g.Primary != s.ActiveRole {
+			return fmt.Errorf("group %s's primary is no longer %s", s.ActiveGroup, s.ActiveRole)
+		}
+
+		return fc.setActiveGroup(s.ActiveGroup)
+	}
+
+	// A role since removed gives way to the default role, as it would have
+	// had it been removed while active.
+	if _, err := fc.set.Role(s.ActiveRole); err != nil {
+		def := fc.DefaultRole()
+		if def == "" {
+			return err
+		}
+
+		log.Printf("warning: restored role %s no longer exists, serving default role %s", s.ActiveRole, def)
+		return fc.setInstanceRole(def)
+	}
+
+	return fc.setInstanceRole(s.ActiveRole)
+}
+
+// Persists the state to file on each change, e.g. so that a restart keeps
+// serving the same role. An empty file stops persisting it.
+func (fc *fintoContext) SetStateFile(file string) {
+	fc.stateM.Lock()
+	defer fc.stateM.Unlock()
+
+	fc.stateFile = file
+}
+
+// Writes the current state to the state file, if there is one. The state is
+// taken while writes are serialized, so the last write is of the latest state.
+func (fc *fintoContext) persistState() {
+	fc.stateM.Lock()
+	defer fc.stateM.Unlock()
+
+	if fc.stateFile == "" {
+		return
+	}
+
+	if err := SaveState(fc.stateFile, fc.Snapshot()); err != nil {
+		log.Printf("warning: failed to persist state: %s", err)
+	}
+}
+
+// Writes s to file as JSON. The file is replaced whole, so a crash mid-write
+// leaves the previous state rather than a truncated one.
+func SaveState(file string, s State) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, b, 0600)
+}
+
+// Replaces file whole with b, so a crash mid-write leaves the previous
+// contents rather than truncated ones.
+func writeFileAtomic(file string, b []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), file)
+}
+
+// Reads a state written by SaveState.
+func LoadState(file string) (State, error) {
+	var s State
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("failed to decode %s: %s", file, err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,79 @@
+package finto
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	fc := setupTestFintoContext()
+	assert.NoError(t, fc.SetRoleGroups(map[string]RoleGroup{
+		"pair": {Primary: "another-alias", Members: []string{"test-alias"}},
+	}))
+
+	assert.Equal(t, State{ActiveRole: "test-alias"}, fc.Snapshot())
+
+	// A group's state restores the group, not only its primary role.
+	assert.NoError(t, fc.setActiveGroup("pair"))
+	grouped := fc.Snapshot()
+	assert.Equal(t, State{ActiveRole: "another-alias", ActiveGroup: "pair"}, grouped)
+
+	assert.NoError(t, fc.setInstanceRole("test-alias"))
+	assert.NoError(t, fc.Restore(grouped))
+	assert.Equal(t, grouped, fc.Snapshot())
+
+	assert.NoError(t, fc.Restore(State{ActiveRole: "test-alias"}))
+	assert.Equal(t, State{ActiveRole: "test-alias"}, fc.Snapshot())
+
+	// States naming groups that no longer exist are refused, and change
+	// nothing.
+	assert.Error(t, fc.Restore(State{ActiveRole: "another-alias", ActiveGroup: "removed"}))
+	assert.Error(t, fc.Restore(State{ActiveRole: "test-alias", ActiveGroup: "pair"}))
+	assert.Equal(t, State{ActiveRole: "test-alias"}, fc.Snapshot())
+
+	// A role that no longer exists gives way to the default role.
+	assert.NoError(t, fc.setInstanceRole("another-alias"))
+	assert.NoError(t, fc.Restore(State{ActiveRole: "removed"}))
+	assert.Equal(t, State{ActiveRole: "test-alias"}, fc.Snapshot())
+}
+
+func TestStateFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "finto-state")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "state.json")
+
+	fc := setupTestFintoContext()
+	fc.SetStateFile(file)
+
+	// Each switch is persisted.
+	req, rec := setupTestRequest("PUT", "/roles", bytes.NewBufferString(`{"alias":"another-alias"}`), t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	s, err := LoadState(file)
+	if assert.NoError(t, err) {
+		assert.Equal(t, State{ActiveRole: "another-alias"}, s)
+	}
+
+	// A restart restores it.
+	restarted := setupTestFintoContext()
+	assert.NoError(t, restarted.Restore(s))
+	assert.Equal(t, "another-alias", restarted.getInstanceRole())
+
+	// Nothing is left behind but the state itself.
+	files, _ := ioutil.ReadDir(dir)
+	assert.Len(t, files, 1)
+
+	_, err = LoadState(filepath.Join(dir, "missing.json"))
+	assert.True(t, os.IsNotExist(err))
+}
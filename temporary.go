@@ -0,0 +1,98 @@
+package finto
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+// Activates role for d, after which the previously active role, or group, is
+// restored. Activating any role or group in the meantime cancels the revert.
+// Returns the role that will be restored and when.
+func (fc *fintoContext) activateTemporarily(role string, d time.Duration) (string, time.Time, error) {
+	fc.m.Lock()
+	prevRole, prevGroup := fc.instanceRole, fc.activeGroup
+	fc.m.Unlock()
+
+	switches, err := fc.switchInstanceRole(role)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	revertAt := time.Now().Add(d)
+
+	// Another switch may have already superseded this one.
+	if fc.switches == switches {
+		fc.revert = time.AfterFunc(d, func() {
+			fc.revertTemporary(switches, prevRole, prevGroup)
+		})
+	}
+
+	return prevRole, revertAt, nil
+}
+
+// Restores the role, or group, that was active before a temporary activation,
+// unless another switch has been made since.
+func (fc *fintoContext) revertTemporary(switches uint64, role, group string) {
+	fc.m.Lock()
+	stale := fc.switches != switches
+	fc.m.Unlock()
+
+	if stale {
+		return
+	}
+
+	var err error
+	if group != "" {
+		err = fc.setActiveGroup(group)
+	} else {
+		err = fc.setInstanceRole(role)
+	}
+	fc.metrics.roleSwitched(err)
+
+	if err != nil {
+		log.Printf("warning: failed to revert temporary activation to role %s: %s", role, err)
+		return
+	}
+
+	log.Printf("reverted temporary activation to role %s", role)
+}
+
+// Serve a role as the instance profile role for a number of seconds, after
+// which the previously active role is restored.
+func rolesActivateTemporary(fc *fintoContext) http.Handler {
+	return VarsHandlerFunc(func(w http.ResponseWriter, r *http.Request, vars map[string]string) {
+		type temporaryRequest struct {
+			Seconds int `json:"seconds"`
+		}
+
+		var req temporaryRequest
+
+		if err := decodeBody(w, r, &req); err != nil {
+			bodyErrorResponse(w, err)
+			return
+		}
+
+		if req.Seconds <= 0 {
+			errorResponse(w, ErrCodeInvalidRequest, "seconds must be positive", http.StatusBadRequest)
+			return
+		}
+
+		prev, revertAt, err := fc.activateTemporarily(vars["alias"], time.Duration(req.Seconds)*time.Second)
+		fc.metrics.roleSwitched(err)
+
+		if err != nil {
+			errorResponse(w, ErrCodeRoleNotFound, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		jsonResponse(w, map[string]string{
+			"active_role":   fc.getInstanceRole(),
+			"previous_role": prev,
+			"revert_at":     formatTime(revertAt),
+		})
+	})
+}
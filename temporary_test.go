@@ -0,0 +1,105 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Waits up to a second for fc's instance role to become role.
+func waitForInstanceRole(t *testing.T, fc *fintoContext, role string) bool {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if fc.getInstanceRole() == role {
+			return true
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	return assert.Fail(t, "instance role was not switched", role)
+}
+
+func TestRolesActivateTemporary(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	req, rec := setupTestRequest("POST", "/roles/another-alias/activate-temporary",
+		bytes.NewBufferString(`{"seconds": 60}`), t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	var body map[string]string
+	if assert.Equal(t, http.StatusOK, rec.Code) && assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body)) {
+		assert.Equal(t, "another-alias", body["active_role"])
+		assert.Equal(t, "test-alias", body["previous_role"])
+		assert.NotEmpty(t, body["revert_at"])
+	}
+	assert.Equal(t, "another-alias", fc.getInstanceRole())
+
+	for _, c := range []struct {
+		path, body string
+		code       int
+	}{
+		{"/roles/another-alias/activate-temporary", `{}`, http.StatusBadRequest},
+		{"/roles/another-alias/activate-temporary", `{"seconds": -1}`, http.StatusBadRequest},
+		{"/roles/another-alias/activate-temporary", `not json`, http.StatusBadRequest},
+		{"/roles/missing-alias/activate-temporary", `{"seconds": 60}`, http.StatusNotFound},
+	} {
+		req, rec := setupTestRequest("POST", c.path, bytes.NewBufferString(c.body), t)
+		FintoRouter(fc).ServeHTTP(rec, req)
+		assert.Equal(t, c.code, rec.Code, c.body)
+	}
+}
+
+func TestActivateTemporarilyReverts(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	prev, _, err := fc.activateTemporarily("another-alias", 10*time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "test-alias", prev)
+		assert.Equal(t, "another-alias", fc.getInstanceRole())
+	}
+
+	waitForInstanceRole(t, fc, "test-alias")
+}
+
+func TestActivateTemporarilyRestoresGroup(t *testing.T) {
+	fc := setupTestFintoContext()
+	assert.NoError(t, fc.SetRoleGroups(map[string]RoleGroup{
+		"pair": {Primary: "test-alias", Members: []string{"another-alias"}},
+	}))
+	assert.NoError(t, fc.setActiveGroup("pair"))
+
+	_, _, err := fc.activateTemporarily("another-alias", 10*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "", fc.getActiveGroup())
+
+	waitForInstanceRole(t, fc, "test-alias")
+	deadline := time.Now().Add(time.Second)
+	for fc.getActiveGroup() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "pair", fc.getActiveGroup())
+}
+
+func TestActivateTemporarilyCancelledBySwitch(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	_, _, err := fc.activateTemporarily("another-alias", 10*time.Millisecond)
+	assert.NoError(t, err)
+
+	// Switching explicitly in the meantime keeps the new role past the window.
+	assert.NoError(t, fc.setInstanceRole("another-alias"))
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, "another-alias", fc.getInstanceRole())
+
+	// As does another temporary activation, whose own revert restores the
+	// role active before it.
+	_, _, err = fc.activateTemporarily("test-alias", time.Hour)
+	assert.NoError(t, err)
+	_, _, err = fc.activateTemporarily("another-alias", 10*time.Millisecond)
+	assert.NoError(t, err)
+	waitForInstanceRole(t, fc, "test-alias")
+}
@@ -0,0 +1,50 @@
+package finto
+
+import (
+	"sync"
+	"time"
+)
+
+// Bounds on the lifetime of session tokens, in seconds, as enforced by IMDSv2.
+const (
+	minTokenTTL = 1
+	maxTokenTTL = 21600
+)
+
+// Issues and validates IMDSv2 session tokens.
+type tokenStore struct {
+	tokens map[string]time.Time // Token->expiration pairs
+	m      sync.Mutex
+}
+
+// Returns a new token valid for ttl.
+func (ts *tokenStore) issue(ttl time.Duration) string {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	if ts.tokens == nil {
+		ts.tokens = make(map[string]time.Time)
+	}
+
+	// Forget expired tokens so the store doesn't grow without bound.
+	now := time.Now()
+	for token, expiration := range ts.tokens {
+		if now.After(expiration) {
+			delete(ts.tokens, token)
+		}
+	}
+
+	token := randomHex(56)
+	ts.tokens[token] = now.Add(ttl)
+
+	return token
+}
+
+// Returns whether token was issued and hasn't expired.
+func (ts *tokenStore) valid(token string) bool {
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	expiration, ok := ts.tokens[token]
+	return ok && time.Now().Before(expiration)
+}
@@ -0,0 +1,105 @@
+package finto
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/threadwaste/finto"
+
+// Sets the provider of the tracer used to trace requests and their AssumeRole
+// calls, and the propagator used to pick up incoming trace context. Both
+// default to no-ops. Must be called before building a router.
+func (fc *fintoContext) SetTracerProvider(tp trace.TracerProvider, p propagation.TextMapPropagator) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	fc.tracer = tp.Tracer(tracerName)
+	fc.propagator = p
+}
+
+func (fc *fintoContext) getTracer() (trace.Tracer, propagation.TextMapPropagator) {
+	fc.m.Lock()
+	defer fc.m.Unlock()
+
+	if fc.tracer == nil {
+		return noop.NewTracerProvider().Tracer(tracerName), propagation.TraceContext{}
+	}
+
+	return fc.tracer, fc.propagator
+}
+
+// Records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.status = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// Wraps a handler in a span named after its route, continuing any trace
+// propagated by the client. The span is tagged with the role alias, if any,
+// and the response status.
+func tracedHandler(fc *fintoContext, name string, h http.Handler) http.Handler {
+	tracer, propagator := fc.getTracer()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		span.SetAttributes(
+			attribute.String("http.method", r.Method),
+			attribute.String("http.route", name),
+		)
+
+		if alias, ok := mux.Vars(r)["alias"]; ok {
+			span.SetAttributes(attribute.String("finto.role.alias", alias))
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", rec.status))
+		if rec.status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
+
+// Starts a span for an AssumeRole call, using the tracer provider of the span
+// already in ctx. Without one, the span is a no-op.
+func startAssumeRoleSpan(ctx context.Context, r *Role) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+
+	return tracer.Start(ctx, "sts.AssumeRole",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("finto.role.arn", r.arn),
+			attribute.String("finto.role.session_name", r.sessionName),
+		),
+	)
+}
+
+// Ends span, recording err if not nil, with any credentials' secrets redacted.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		msg := RedactSecrets(err.Error())
+
+		span.RecordError(errors.New(msg))
+		span.SetStatus(codes.Error, msg)
+	}
+
+	span.End()
+}
@@ -0,0 +1,49 @@
+package finto
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	fc := setupTestFintoContext()
+	fc.SetTracerProvider(tp, propagation.TraceContext{})
+
+	req, rec := setupTestRequest("GET", "/latest/meta-data/iam/security-credentials/test-alias", nil, t)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	spans := recorder.Ended()
+	if !assert.Len(t, spans, 2) {
+		return
+	}
+
+	assume, route := spans[0], spans[1]
+
+	assert.Equal(t, "metadata-iam-secreds-role", route.Name())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", route.SpanContext().TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", route.Parent().SpanID().String())
+	assert.Contains(t, route.Attributes(), attribute.String("finto.role.alias", "test-alias"))
+	assert.Contains(t, route.Attributes(), attribute.Int("http.status_code", 200))
+
+	assert.Equal(t, "sts.AssumeRole", assume.Name())
+	assert.Equal(t, route.SpanContext().SpanID(), assume.Parent().SpanID())
+	assert.Contains(t, assume.Attributes(), attribute.String("finto.role.arn", testArn))
+}
+
+func TestTracingDefaultsToNoop(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	req, rec := setupTestRequest("GET", "/roles/test-alias/credentials", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	assert.Equal(t, 200, rec.Code)
+}
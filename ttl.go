@@ -0,0 +1,34 @@
+package finto
+
+import "time"
+
+// Caps how long the set's roles, including those added later, serve
+// credentials after minting them, whatever session duration STS granted:
+// credentials are reported to expire, and are refreshed, max after they were
+// minted, unless they really expire sooner. Zero removes the cap.
+func (rs *RoleSet) SetMaxCredentialTTL(max time.Duration) {
+	rs.m.Lock()
+	defer rs.m.Unlock()
+
+	rs.maxTTL = max
+	for _, role := range rs.roles {
+		role.m.Lock()
+		role.maxTTL = max
+		role.m.Unlock()
+	}
+}
+
+// Returns the expiration of credentials minted at minted and really expiring
+// at expiration, capped at max after minting. It's never later than the real
+// expiration.
+func capExpiration(expiration, minted time.Time, max time.Duration) time.Time {
+	if max <= 0 || minted.IsZero() {
+		return expiration
+	}
+
+	if capped := minted.Add(max); capped.Before(expiration) {
+		return capped
+	}
+
+	return expiration
+}
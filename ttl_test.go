@@ -0,0 +1,62 @@
+package finto
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapExpiration(t *testing.T) {
+	minted := time.Date(2016, 1, 3, 18, 40, 30, 0, time.UTC)
+	expiration := minted.Add(12 * time.Hour)
+
+	assert.Equal(t, minted.Add(time.Hour), capExpiration(expiration, minted, time.Hour))
+	assert.Equal(t, expiration, capExpiration(expiration, minted, 24*time.Hour))
+	assert.Equal(t, expiration, capExpiration(expiration, minted, 0))
+	assert.Equal(t, expiration, capExpiration(expiration, time.Time{}, time.Hour))
+}
+
+func TestMaxCredentialTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	provider := &memoryProvider{
+		creds: Credentials{
+			AccessKeyId:     "memory-id",
+			SecretAccessKey: "memory-key",
+			SessionToken:    "memory-token",
+			Expiration:      clock.Now().Add(12 * time.Hour),
+		},
+	}
+
+	rs := NewRoleSet(&FailingAssumeRoleClient{})
+	rs.SetClock(clock)
+	rs.SetMaxCredentialTTL(time.Hour)
+	assert.NoError(t, rs.SetRole("test-alias", testArn, WithCredentialProvider(provider)))
+	role, _ := rs.Role("test-alias")
+
+	// A 12-hour session is reported, and served, for an hour.
+	creds, err := role.Credentials(context.Background())
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, clock.Now().Add(time.Hour), creds.Expiration, time.Second)
+	}
+
+	clock.Advance(59 * time.Minute)
+	role.Credentials(context.Background())
+	assert.Equal(t, 1, provider.calls)
+
+	clock.Advance(2 * time.Minute)
+	role.Credentials(context.Background())
+	assert.Equal(t, 2, provider.calls)
+
+	// Sessions shorter than the cap keep their own expiration.
+	provider.creds.Expiration = clock.Now().Add(30 * time.Minute)
+	assert.NoError(t, role.Refresh(context.Background()))
+	assert.WithinDuration(t, provider.creds.Expiration, role.Expiration(), time.Second)
+
+	// Removing the cap applies from the next refresh.
+	rs.SetMaxCredentialTTL(0)
+	provider.creds.Expiration = clock.Now().Add(12 * time.Hour)
+	assert.NoError(t, role.Refresh(context.Background()))
+	assert.WithinDuration(t, provider.creds.Expiration, role.Expiration(), time.Second)
+}
@@ -0,0 +1,22 @@
+package finto
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed ui/index.html
+var indexHTML []byte
+
+// Serve the web UI for switching roles, unless it is disabled.
+func webUI(fc *fintoContext) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !fc.WebUIEnabled() {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(indexHTML)
+	})
+}
@@ -0,0 +1,26 @@
+package finto
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebUI(t *testing.T) {
+	fc := setupTestFintoContext()
+
+	req, rec := setupTestRequest("GET", "/", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Body.String(), "<title>finto</title>")
+
+	fc.SetWebUI(false)
+
+	req, rec = setupTestRequest("GET", "/", nil, t)
+	FintoRouter(fc).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
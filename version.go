@@ -1,3 +1,37 @@
 package finto
 
-const Version = "0.1.0"
+import (
+	"runtime"
+	"strings"
+)
+
+// Build metadata. Commit and BuildDate are set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/threadwaste/finto.Commit=$(git rev-parse HEAD)"
+//
+// and are empty otherwise. Version may be overridden the same way, e.g. by a
+// release's tag.
+var (
+	Version   = "0.1.0"
+	Commit    = ""
+	BuildDate = ""
+)
+
+// Returns the running build on one line, for logs and support requests: its
+// version, and those of its commit, build date, and Go toolchain that are
+// known, e.g. "finto 0.1.0 (commit abc123, built 2016-01-03T18:40:30Z, go1.16)".
+func VersionString() string {
+	details := []string{}
+
+	if Commit != "" {
+		details = append(details, "commit "+Commit)
+	}
+
+	if BuildDate != "" {
+		details = append(details, "built "+BuildDate)
+	}
+
+	details = append(details, runtime.Version())
+
+	return "finto " + Version + " (" + strings.Join(details, ", ") + ")"
+}
@@ -0,0 +1,96 @@
+package finto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Webhook posts a notice to a URL each time a role's credentials are
+// refreshed, e.g. to update an external secret store. Notices carry no secret
+// material unless IncludeSecrets is set.
+type Webhook struct {
+	URL            string
+	IncludeSecrets bool         // Include the credentials themselves in notices
+	MaxAttempts    int          // Delivery attempts per notice; at least one
+	Client         *http.Client // Defaults to a client with a 10 second timeout
+	Retry          RetryPolicy  // Backoff between delivery attempts
+}
+
+func NewWebhook(url string) *Webhook {
+	return &Webhook{
+		URL:         url,
+		MaxAttempts: 3,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		Retry:       DefaultRetryPolicy,
+	}
+}
+
+// The body posted to a webhook.
+type refreshNotice struct {
+	Alias           string `json:"alias"`
+	Expiration      string `json:"expiration"`
+	AccessKeyId     string `json:"access_key_id,omitempty"`
+	SecretAccessKey string `json:"secret_access_key,omitempty"`
+	SessionToken    string `json:"session_token,omitempty"`
+}
+
+// Delivers a notice of refreshed credentials in the background. Satisfies
+// RefreshHook, so it never blocks the refresh.
+func (wh *Webhook) Notify(alias string, creds Credentials) {
+	notice := refreshNotice{
+		Alias:      alias,
+		Expiration: formatTime(creds.Expiration),
+	}
+
+	if wh.IncludeSecrets {
+		notice.AccessKeyId = creds.AccessKeyId
+		notice.SecretAccessKey = creds.SecretAccessKey
+		notice.SessionToken = creds.SessionToken
+	}
+
+	go func() {
+		if err := wh.deliver(notice); err != nil {
+			log.Printf("warning: webhook for role %s failed: %s", alias, err)
+		}
+	}()
+}
+
+// Posts a notice, retrying failures up to MaxAttempts times in total.
+func (wh *Webhook) deliver(notice refreshNotice) error {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; ; attempt++ {
+		err = wh.post(body)
+		if err == nil || attempt >= wh.MaxAttempts {
+			return err
+		}
+
+		time.Sleep(wh.Retry.backoff(attempt))
+	}
+}
+
+func (wh *Webhook) post(body []byte) error {
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Post(wh.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package finto
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns a webhook receiver that fails the first failures requests, and sends
+// each notice it accepts on the returned channel.
+func setupWebhookReceiver(failures int) (*httptest.Server, chan map[string]string) {
+	notices := make(chan map[string]string, 1)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures -= 1
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var notice map[string]string
+		json.NewDecoder(r.Body).Decode(&notice)
+		notices <- notice
+	}))
+
+	return ts, notices
+}
+
+func setupTestWebhook(url string) *Webhook {
+	wh := NewWebhook(url)
+	wh.Retry = RetryPolicy{BaseDelay: time.Millisecond}
+
+	return wh
+}
+
+var webhookCreds = Credentials{
+	AccessKeyId:     "test-id",
+	Expiration:      MockExpiry,
+	SecretAccessKey: "test-key",
+	SessionToken:    "test-token",
+}
+
+func TestWebhookNotify(t *testing.T) {
+	ts, notices := setupWebhookReceiver(2)
+	defer ts.Close()
+
+	setupTestWebhook(ts.URL).Notify("test-alias", webhookCreds)
+
+	select {
+	case notice := <-notices:
+		assert.Equal(t, map[string]string{
+			"alias":      "test-alias",
+			"expiration": formatTime(MockExpiry),
+		}, notice)
+	case <-time.After(time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestWebhookIncludeSecrets(t *testing.T) {
+	ts, notices := setupWebhookReceiver(0)
+	defer ts.Close()
+
+	wh := setupTestWebhook(ts.URL)
+	wh.IncludeSecrets = true
+	wh.Notify("test-alias", webhookCreds)
+
+	select {
+	case notice := <-notices:
+		assert.Equal(t, "test-id", notice["access_key_id"])
+		assert.Equal(t, "test-key", notice["secret_access_key"])
+		assert.Equal(t, "test-token", notice["session_token"])
+	case <-time.After(time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestWebhookGivesUp(t *testing.T) {
+	ts, _ := setupWebhookReceiver(3)
+	defer ts.Close()
+
+	err := setupTestWebhook(ts.URL).deliver(refreshNotice{Alias: "test-alias"})
+	assert.Error(t, err)
+}